@@ -0,0 +1,51 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// anonymizer redacts results before they are shared publicly.
+type anonymizer struct {
+	salt string
+	// minStars is the star count from which repositories keep their name
+	minStars int
+}
+
+// pseudonym returns a stable name for the repository, derived from the salt.
+func (a anonymizer) pseudonym(name string) string {
+	sum := sha256.Sum256([]byte(a.salt + "\x00" + name))
+	return "repo-" + hex.EncodeToString(sum[:6])
+}
+
+// apply returns redacted copies of the results. Repositories below the star
+// threshold get a pseudonym, the stars are rounded down to the star buckets,
+// and URLs and notes are dropped. Pseudonymized results also lose their
+// go.mod SHA and fork. Usage and versions are kept.
+func (a anonymizer) apply(results []repoResult) []repoResult {
+	redacted := make([]repoResult, 0, len(results))
+	for _, r := range results {
+		if r.stars < a.minStars {
+			r.name = a.pseudonym(r.name)
+			// a blob SHA can be searched for and a fork usually names
+			// the owner
+			r.goModSHA = ""
+			r.fork = ""
+		}
+		r.stars = roundStars(r.stars)
+		r.notes = ""
+		r.redacted = true
+		redacted = append(redacted, r)
+	}
+	return redacted
+}
+
+// roundStars rounds the star count down to the lower bound of its bucket.
+func roundStars(stars int) int {
+	for _, bound := range starBuckets {
+		if stars >= bound {
+			return bound
+		}
+	}
+	return 0
+}
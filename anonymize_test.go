@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnonymize(t *testing.T) {
+	a := anonymizer{salt: "s3cret", minStars: 1000}
+	tests := []struct {
+		name        string
+		result      repoResult
+		wantRenamed bool
+		wantStars   int
+		// wantKept is set when the go.mod SHA and fork are kept
+		wantKept bool
+	}{
+		{name: "popular", result: repoResult{name: "big/project", used: true, stars: 12345, version: "v1.2.0", notes: "internal", goModSHA: "3f1c2a9", fork: "github.com/big/lib@v1.2.1"}, wantStars: 10000, wantKept: true},
+		{name: "at the threshold", result: repoResult{name: "mid/project", used: true, stars: 1000, goModSHA: "9e8d7c6"}, wantStars: 1000, wantKept: true},
+		{name: "small", result: repoResult{name: "jdoe/dotfiles", used: true, stars: 42, version: "v1.0.0", notes: "a friend", goModSHA: "0a1b2c3", fork: "github.com/jdoe/lib@v1.0.1"}, wantRenamed: true, wantStars: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := a.apply([]repoResult{tt.result})[0]
+			if renamed := got.name != tt.result.name; renamed != tt.wantRenamed {
+				t.Errorf("name %q, renamed: %v, want %v", got.name, renamed, tt.wantRenamed)
+			}
+			if tt.wantRenamed && !strings.HasPrefix(got.name, "repo-") {
+				t.Errorf("pseudonym %q", got.name)
+			}
+			if got.stars != tt.wantStars {
+				t.Errorf("%d stars, want %d", got.stars, tt.wantStars)
+			}
+			if got.notes != "" || got.url() != "" {
+				t.Errorf("note %q and URL %q kept", got.notes, got.url())
+			}
+			if kept := got.goModSHA == tt.result.goModSHA && got.fork == tt.result.fork; kept != tt.wantKept {
+				t.Errorf("go.mod SHA %q and fork %q kept: %v, want %v", got.goModSHA, got.fork, kept, tt.wantKept)
+			}
+			if got.used != tt.result.used || got.version != tt.result.version {
+				t.Errorf("usage %v %q, want %v %q", got.used, got.version, tt.result.used, tt.result.version)
+			}
+		})
+	}
+}
+
+func TestPseudonym(t *testing.T) {
+	a := anonymizer{salt: "s3cret"}
+	if a.pseudonym("jdoe/dotfiles") != a.pseudonym("jdoe/dotfiles") {
+		t.Error("pseudonym not stable")
+	}
+	if a.pseudonym("jdoe/dotfiles") == a.pseudonym("jdoe/scripts") {
+		t.Error("repositories share a pseudonym")
+	}
+	if other := (anonymizer{salt: "other"}); a.pseudonym("jdoe/dotfiles") == other.pseudonym("jdoe/dotfiles") {
+		t.Error("pseudonym independent of the salt")
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	// markdownLinkRe matches the target of inline Markdown links and bare URLs.
+	markdownLinkRe = regexp.MustCompile(`https?://[^\s)\]"'<>]+`)
+	// githubRepoRe matches a repository URL, ignoring anything after the name.
+	githubRepoRe = regexp.MustCompile(`^https?://(?:www\.)?github\.com/([A-Za-z0-9-]+)/([A-Za-z0-9._-]+)`)
+)
+
+// reservedGithubOwners are path prefixes on github.com that are not users or
+// organizations.
+var reservedGithubOwners = map[string]bool{
+	"about":            true,
+	"apps":             true,
+	"collections":      true,
+	"features":         true,
+	"marketplace":      true,
+	"orgs":             true,
+	"settings":         true,
+	"site":             true,
+	"sponsors":         true,
+	"topics":           true,
+	"user-attachments": true,
+}
+
+// parseAwesomeList extracts the unique GitHub repositories linked from a
+// Markdown document, in order of appearance. It also returns how many
+// non-GitHub links were skipped.
+func parseAwesomeList(markdown string) ([]string, int) {
+	var repos []string
+	seen := make(map[string]bool)
+	skipped := 0
+
+	for _, link := range markdownLinkRe.FindAllString(markdown, -1) {
+		m := githubRepoRe.FindStringSubmatch(link)
+		if m == nil {
+			skipped++
+			continue
+		}
+
+		owner, name := m[1], strings.TrimSuffix(m[2], ".git")
+		if reservedGithubOwners[strings.ToLower(owner)] || name == "" {
+			skipped++
+			continue
+		}
+
+		// GitHub names are case insensitive
+		key := strings.ToLower(owner + "/" + name)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		repos = append(repos, owner+"/"+name)
+	}
+
+	return repos, skipped
+}
+
+// readAwesomeList reads a Markdown file from a URL or a local path.
+func readAwesomeList(ctx context.Context, source string) (string, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		bb, err := os.ReadFile(source)
+		return string(bb), err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status fetching %s: %s", source, resp.Status)
+	}
+
+	bb, err := io.ReadAll(resp.Body)
+	return string(bb), err
+}
+
+// awesomeCandidates fetches the metadata of the repositories linked from an
+// awesome list. Repositories that no longer exist are skipped.
+func (s *searchResult) awesomeCandidates(ctx context.Context, source string) ([]candidate, error) {
+	markdown, err := readAwesomeList(ctx, source)
+	if err != nil {
+		return nil, fmt.Errorf("error reading awesome list: %v", err)
+	}
+
+	names, skipped := parseAwesomeList(markdown)
+	logf("found %d repositories in %s, skipped %d non-GitHub links\n", len(names), source, skipped)
+
+	var candidates []candidate
+	for _, name := range names {
+		owner, repo, _ := strings.Cut(name, "/")
+		r, _, err := s.client.Repositories.Get(ctx, owner, repo)
+		if err != nil {
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return candidates, nil
+			}
+			logf("error fetching repository %s: %v\n", name, withRequestID(err))
+			continue
+		}
+		candidates = append(candidates, candidateFromRepository(r))
+	}
+
+	return candidates, nil
+}
+
+// SearchAwesome inspects the repositories linked from an awesome list instead
+// of the repositories found by the repository search.
+func (s *searchResult) SearchAwesome(ctx context.Context, source string) (map[string]repoResult, error) {
+	candidates, err := s.awesomeCandidates(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.searchInRepositories(ctx, filterCandidates(candidates))
+}
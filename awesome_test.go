@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseAwesomeListSnapshot(t *testing.T) {
+	markdown, err := os.ReadFile("testdata/awesome-go.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repos, skipped := parseAwesomeList(string(markdown))
+
+	// the badges and links of the header count like the entries
+	if len(repos) != 27 {
+		t.Errorf("%d repositories, want 27: %v", len(repos), repos)
+	}
+	if skipped != 14 {
+		t.Errorf("%d links skipped, want 14", skipped)
+	}
+	for _, want := range []string{"avelino/awesome-go", "pancsta/asyncmachine-go", "spf13/cobra", "mudler/LocalAI", "thedevsir/gosuccinctly"} {
+		if !slices.Contains(repos, want) {
+			t.Errorf("%s missing", want)
+		}
+	}
+	for _, repo := range repos {
+		if owner, _, _ := strings.Cut(repo, "/"); reservedGithubOwners[owner] {
+			t.Errorf("%s is not a repository", repo)
+		}
+	}
+	if n := len(slices.DeleteFunc(slices.Clone(repos), func(repo string) bool { return repo != "spf13/cobra" })); n != 1 {
+		t.Errorf("spf13/cobra listed %d times, want once", n)
+	}
+}
+
+func TestParseAwesomeList(t *testing.T) {
+	tests := []struct {
+		name        string
+		markdown    string
+		want        []string
+		wantSkipped int
+	}{
+		{name: "entry", markdown: "- [lo](https://github.com/samber/lo) - Lodash-style Go library.", want: []string{"samber/lo"}},
+		{name: "anchor and path", markdown: "[a](https://github.com/samber/lo#readme) [b](https://github.com/samber/mo/tree/main/option)", want: []string{"samber/lo", "samber/mo"}},
+		{name: "case and .git", markdown: "https://github.com/Samber/Lo.git and https://www.github.com/samber/lo", want: []string{"Samber/Lo"}},
+		{name: "badge", markdown: "[![Go Reference](https://pkg.go.dev/badge/github.com/samber/lo.svg)](https://pkg.go.dev/github.com/samber/lo)", wantSkipped: 2},
+		{name: "reserved owner", markdown: "[topic](https://github.com/topics/go) [sponsor](https://github.com/sponsors/samber)", wantSkipped: 2},
+		{name: "other hosts", markdown: "[a](https://gitlab.com/a/b) [b](https://codeberg.org/c/d)", wantSkipped: 2},
+		{name: "owner only", markdown: "[samber](https://github.com/samber)", wantSkipped: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repos, skipped := parseAwesomeList(tt.markdown)
+			if !slices.Equal(repos, tt.want) {
+				t.Errorf("repositories %v, want %v", repos, tt.want)
+			}
+			if skipped != tt.wantSkipped {
+				t.Errorf("%d skipped, want %d", skipped, tt.wantSkipped)
+			}
+		})
+	}
+}
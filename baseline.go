@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// regression describes how the current adoption compares to a baseline.
+type regression struct {
+	baselineAdopters int
+	currentAdopters  int
+	dropPct          float64
+}
+
+// loadBaseline reads a previously stored cache file to compare against.
+func loadBaseline(fileName string) (map[string]repoResult, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return readResults(file)
+}
+
+// evaluateRegression compares the number of adopters in the current results
+// to the baseline. A negative dropPct means adoption has grown.
+func evaluateRegression(baseline map[string]repoResult, current []repoResult) regression {
+	r := regression{}
+	for _, result := range baseline {
+		if result.used {
+			r.baselineAdopters++
+		}
+	}
+	for _, result := range current {
+		if result.used {
+			r.currentAdopters++
+		}
+	}
+
+	if r.baselineAdopters > 0 {
+		r.dropPct = float64(r.baselineAdopters-r.currentAdopters) / float64(r.baselineAdopters) * 100
+	}
+
+	return r
+}
+
+// check returns an error if the drop exceeds maxDropPct.
+func (r regression) check(maxDropPct float64) error {
+	if r.dropPct > maxDropPct {
+		return fmt.Errorf("adoption dropped by %.1f%% (from %d to %d adopters), more than the allowed %.1f%%",
+			r.dropPct, r.baselineAdopters, r.currentAdopters, maxDropPct)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEvaluateRegression(t *testing.T) {
+	adopters := func(used ...bool) []repoResult {
+		results := make([]repoResult, len(used))
+		for i, u := range used {
+			results[i] = repoResult{name: string(rune('a' + i)), used: u}
+		}
+		return results
+	}
+	tests := []struct {
+		name       string
+		baseline   []repoResult
+		current    []repoResult
+		maxDropPct float64
+		wantDrop   float64
+		wantErr    bool
+	}{
+		{name: "unchanged", baseline: adopters(true, true, false), current: adopters(true, true, false), maxDropPct: 10},
+		{name: "improving", baseline: adopters(true, true, false, false), current: adopters(true, true, true, false), maxDropPct: 10, wantDrop: -50},
+		{name: "regressing", baseline: adopters(true, true, true, true), current: adopters(true, true, true, false), maxDropPct: 10, wantDrop: 25, wantErr: true},
+		{name: "regressing within the limit", baseline: adopters(true, true, true, true), current: adopters(true, true, true, false), maxDropPct: 25, wantDrop: 25},
+		{name: "empty baseline", current: adopters(true), maxDropPct: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseline := make(map[string]repoResult)
+			for _, r := range tt.baseline {
+				baseline[r.name] = r
+			}
+			r := evaluateRegression(baseline, tt.current)
+			if r.dropPct != tt.wantDrop {
+				t.Errorf("drop %.1f%%, want %.1f%%", r.dropPct, tt.wantDrop)
+			}
+			if err := r.check(tt.maxDropPct); (err != nil) != tt.wantErr {
+				t.Errorf("check error %v, want one: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadBaseline(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "baseline.csv")
+	if err := os.WriteFile(fileName, []byte("a/one,true,10\na/two,false,3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	baseline, err := loadBaseline(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := evaluateRegression(baseline, []repoResult{{name: "a/one"}}); r.baselineAdopters != 1 || r.currentAdopters != 0 || r.dropPct != 100 {
+		t.Errorf("regression %+v, want a drop from 1 to 0 adopters", r)
+	}
+}
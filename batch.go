@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/google/go-github/v63/github"
+	"golang.org/x/mod/module"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// readBatch reads the packages of -pkg -, one per line. Blank lines and
+// lines starting with # are skipped, a malformed path fails the whole batch
+// before anything is searched.
+func readBatch(r io.Reader) ([]string, error) {
+	var (
+		packages []string
+		seen     = make(map[string]bool)
+	)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		pkg := strings.TrimSpace(scanner.Text())
+		if pkg == "" || strings.HasPrefix(pkg, "#") {
+			continue
+		}
+		if err := module.CheckImportPath(modulePrefix(pkg)); err != nil {
+			return nil, fmt.Errorf("invalid package on line %d: %v", line, err)
+		}
+		if seen[pkg] {
+			logf("%s is listed twice, searching for it once\n", pkg)
+			continue
+		}
+		seen[pkg] = true
+		packages = append(packages, pkg)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading the packages from stdin: %v", err)
+	}
+	if len(packages) == 0 {
+		return nil, fmt.Errorf("no packages on stdin")
+	}
+	return packages, nil
+}
+
+// scanBatch scans the packages taking turns: a package checks a repository,
+// then passes the turn on to the next package, round-robin. A package with a
+// few repositories to check doesn't wait for one with thousands, and a run
+// stopped early has results for all of them. Only the package holding the
+// turn runs, scan passes it on by calling yield. A failed package doesn't
+// stop the batch, the failures are reported at the end.
+func scanBatch(ctx context.Context, packages []string, scan func(packageName string, yield func()) error) error {
+	var (
+		turns = newRoundRobin(len(packages))
+		errs  = make([]error, len(packages))
+		wg    sync.WaitGroup
+	)
+	for i, pkg := range packages {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			turns.wait(i)
+			defer turns.leave(i)
+			if errs[i] = ctx.Err(); errs[i] != nil {
+				logf("stopping the batch before %s\n", pkg)
+				return
+			}
+			logf("Scanning package %d/%d: %s\n", i+1, len(packages), pkg)
+			errs[i] = scan(pkg, func() { turns.pass(i) })
+		}()
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	var failed []string
+	for i, err := range errs {
+		if err != nil {
+			logf("error scanning %s: %v\n", packages[i], err)
+			failed = append(failed, packages[i])
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d packages failed: %s", len(failed), len(packages), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// roundRobin passes a turn around the packages of a batch that are still
+// scanning, in their order. The channel of a package holds the turn once it
+// is given to it. Only the package holding the turn changes active.
+type roundRobin struct {
+	turns  []chan struct{}
+	active []bool
+}
+
+func newRoundRobin(n int) *roundRobin {
+	r := &roundRobin{turns: make([]chan struct{}, n), active: make([]bool, n)}
+	for i := range r.turns {
+		r.turns[i] = make(chan struct{}, 1)
+		r.active[i] = true
+	}
+	if n > 0 {
+		r.turns[0] <- struct{}{}
+	}
+	return r
+}
+
+// wait blocks until package i has the turn.
+func (r *roundRobin) wait(i int) {
+	<-r.turns[i]
+}
+
+// next returns the package after i that is still scanning, i itself when it
+// is the only one, -1 when none is left.
+func (r *roundRobin) next(i int) int {
+	for k := 1; k <= len(r.active); k++ {
+		if j := (i + k) % len(r.active); r.active[j] {
+			return j
+		}
+	}
+	return -1
+}
+
+// pass gives the turn of package i to the next package and waits for it to
+// come back.
+func (r *roundRobin) pass(i int) {
+	j := r.next(i)
+	if j == i {
+		return
+	}
+	r.turns[j] <- struct{}{}
+	r.wait(i)
+}
+
+// leave takes package i out of the turns and gives the turn to the next one.
+func (r *roundRobin) leave(i int) {
+	r.active[i] = false
+	if j := r.next(i); j >= 0 {
+		r.turns[j] <- struct{}{}
+	}
+}
+
+// outputExts are the extensions of the files of -output-dir per output
+// format.
+var outputExts = map[string]string{
+	"csv":     ".csv",
+	"json":    ".json",
+	"table":   ".txt",
+	"shell":   ".txt",
+	"parquet": ".parquet",
+	"yaml":    ".yaml",
+}
+
+// outputDirFile returns the file of dir the output or the report of a
+// package is written to, named like its cache, e.g. github.com-samber-lo.json.
+// A report takes the extension of its template without .tmpl.
+func outputDirFile(dir, packageName, format, reportTmpl string) string {
+	ext := outputExts[format]
+	if reportTmpl != "" {
+		ext = filepath.Ext(strings.TrimSuffix(reportTmpl, ".tmpl"))
+		if ext == "" {
+			ext = ".txt"
+		}
+	}
+	return filepath.Join(dir, filepath.Base(trimCacheExt(defaultCacheFile(packageName)))+ext)
+}
+
+// streamable reports whether the outputs of several packages can follow each
+// other on stdout: a table or shell line can, but a second CSV header, JSON
+// or YAML document or Parquet file makes the whole invalid.
+func streamable(format, reportTmpl string) bool {
+	return reportTmpl == "" && (format == "" || format == "table" || format == "shell")
+}
+
+// repoListings keeps the pages of the repository searches of a run. The
+// candidate repositories don't depend on the package, so the packages of a
+// batch list them once.
+type repoListings struct {
+	pages map[string]listingPage
+}
+
+// listingPage is a page of a repository search and the number of the page
+// after it, 0 for the last one.
+type listingPage struct {
+	repos    *github.RepositoriesSearchResult
+	nextPage int
+}
+
+func newRepoListings() *repoListings {
+	return &repoListings{pages: make(map[string]listingPage)}
+}
+
+func listingKey(query string, opts *github.SearchOptions) string {
+	return fmt.Sprintf("%s|%s|%s|%d|%d", query, opts.Sort, opts.Order, opts.PerPage, opts.Page)
+}
+
+// has reports whether the page of the search is listed, nil listings have
+// none.
+func (l *repoListings) has(query string, opts *github.SearchOptions) bool {
+	if l == nil {
+		return false
+	}
+	_, ok := l.pages[listingKey(query, opts)]
+	return ok
+}
+
+// listRepositories returns a page of the repository search, from the
+// listings when a previous package of the batch searched it already.
+func (s *searchResult) listRepositories(ctx context.Context, query string, opts *github.SearchOptions) (listingPage, error) {
+	if s.listings != nil {
+		if page, ok := s.listings.pages[listingKey(query, opts)]; ok {
+			return page, nil
+		}
+	}
+	stop := s.timings.track(phaseRepoSearch, fmt.Sprintf("%s page %d", query, max(opts.Page, 1)))
+	repos, resp, err := s.client.Search.Repositories(ctx, query, opts)
+	stop()
+	if err != nil {
+		return listingPage{}, err
+	}
+	page := listingPage{repos: repos, nextPage: resp.NextPage}
+	if s.listings != nil {
+		s.listings.pages[listingKey(query, opts)] = page
+	}
+	return page, nil
+}
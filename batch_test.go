@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadBatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "three packages",
+			input: "github.com/samber/lo\n\n# comment\ngithub.com/spf13/cobra\n  go.uber.org/zap  \n",
+			want:  []string{"github.com/samber/lo", "github.com/spf13/cobra", "go.uber.org/zap"},
+		},
+		{
+			name:  "duplicate",
+			input: "github.com/samber/lo\ngithub.com/samber/lo\n",
+			want:  []string{"github.com/samber/lo"},
+		},
+		{name: "wildcard", input: "github.com/aws/aws-sdk-go-v2/...\n", want: []string{"github.com/aws/aws-sdk-go-v2/..."}},
+		{name: "malformed", input: "github.com/samber/lo\nnot a path\n", wantErr: true},
+		{name: "empty", input: "# nothing\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readBatch(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want one: %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanBatch(t *testing.T) {
+	packages, err := readBatch(strings.NewReader("github.com/samber/lo\ngithub.com/spf13/cobra\ngo.uber.org/zap\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := make(map[string][]repoResult)
+	scan := func(pkg string, _ func()) error {
+		if pkg == "github.com/spf13/cobra" {
+			return fmt.Errorf("rate limited")
+		}
+		results[pkg] = []repoResult{{name: "a/" + filepath.Base(pkg), used: true}}
+		return nil
+	}
+	err = scanBatch(context.Background(), packages, scan)
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 packages failed: github.com/spf13/cobra") {
+		t.Errorf("error %v, want the failed package", err)
+	}
+	if len(results) != 2 || results["github.com/samber/lo"][0].name != "a/lo" || results["go.uber.org/zap"][0].name != "a/zap" {
+		t.Errorf("results %v, want one set per scanned package", results)
+	}
+}
+
+// TestScanBatchTurns scans a package with a single repository to check
+// along with cold ones, which must not make it wait for them.
+func TestScanBatchTurns(t *testing.T) {
+	toCheck := map[string]int{"a/warm": 1, "b/cold": 4, "c/cool": 2}
+	var checked []string
+	scan := func(pkg string, yield func()) error {
+		for i := 1; i <= toCheck[pkg]; i++ {
+			yield()
+			checked = append(checked, fmt.Sprintf("%s#%d", pkg, i))
+		}
+		return nil
+	}
+	if err := scanBatch(context.Background(), []string{"a/warm", "b/cold", "c/cool"}, scan); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a/warm#1", "b/cold#1", "c/cool#1", "b/cold#2", "c/cool#2", "b/cold#3", "b/cold#4"}
+	if !reflect.DeepEqual(checked, want) {
+		t.Errorf("checked %v, want %v", checked, want)
+	}
+}
+
+func TestOutputDirFile(t *testing.T) {
+	tests := []struct {
+		pkg, format, reportTmpl string
+		want                    string
+	}{
+		{pkg: "github.com/samber/lo", format: "json", want: "github.com-samber-lo.json"},
+		{pkg: "go.uber.org/zap", format: "parquet", want: "go.uber.org-zap.parquet"},
+		{pkg: "go.uber.org/zap", format: "table", want: "go.uber.org-zap.txt"},
+		{pkg: "go.uber.org/zap", reportTmpl: "templates/report.md.tmpl", want: "go.uber.org-zap.md"},
+		{pkg: "go.uber.org/zap", reportTmpl: "report", want: "go.uber.org-zap.txt"},
+	}
+	for _, tt := range tests {
+		got := outputDirFile("out", tt.pkg, tt.format, tt.reportTmpl)
+		if want := filepath.Join("out", tt.want); got != want {
+			t.Errorf("%s %s%s: got %s, want %s", tt.pkg, tt.format, tt.reportTmpl, got, want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// errBudgetSpent is the cause of the cancellation of a run that spent its
+// -request-budget, and the error of the requests made after that.
+var errBudgetSpent = errors.New("request budget spent")
+
+// Kinds of requests the budget report allocates the requests to.
+const (
+	requestListing    = "listing"
+	requestCodeSearch = "code-search"
+	requestDownload   = "download"
+	requestEnrichment = "enrichment"
+	requestOther      = "other"
+)
+
+var requestKinds = []string{requestListing, requestCodeSearch, requestDownload, requestEnrichment, requestOther}
+
+// rawContentHost serves the files of repositories outside of the API.
+const rawContentHost = "raw.githubusercontent.com"
+
+// requestBudget caps the number of GitHub requests of a run. Once the last
+// request of the budget is made the run is stopped, the results so far are
+// still saved. A nil budget counts nothing. It is safe for concurrent use.
+type requestBudget struct {
+	limit int
+
+	mu     sync.Mutex
+	spent  int
+	byKind map[string]int
+	// stops cancel the run when the budget is spent, the search of every
+	// package of a batch
+	stops []context.CancelCauseFunc
+}
+
+func newRequestBudget(limit int) *requestBudget {
+	return &requestBudget{limit: limit, byKind: make(map[string]int)}
+}
+
+// stopWith adds a function canceling the run when the budget is spent.
+func (b *requestBudget) stopWith(cancel context.CancelCauseFunc) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.stops = append(b.stops, cancel)
+}
+
+// spend books a request, or returns errBudgetSpent when none is left.
+// Downloads from raw.githubusercontent.com aren't API requests and cost
+// nothing.
+func (b *requestBudget) spend(req *http.Request) error {
+	if b == nil || req.URL.Host == rawContentHost {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.spent >= b.limit {
+		return errBudgetSpent
+	}
+	b.spent++
+	b.byKind[requestKind(req)]++
+	return nil
+}
+
+// stopIfSpent stops the run once the last request of the budget is done.
+// Canceling the run any earlier would cancel that request too.
+func (b *requestBudget) stopIfSpent() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.spent == b.limit && len(b.stops) > 0 {
+		logf("request budget of %d spent, stopping the run\n", b.limit)
+		for _, stop := range b.stops {
+			stop(errBudgetSpent)
+		}
+		b.stops = nil
+	}
+}
+
+// print logs how the spent requests were allocated.
+func (b *requestBudget) print() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var kinds []string
+	for _, kind := range requestKinds {
+		if n := b.byKind[kind]; n > 0 {
+			kinds = append(kinds, fmt.Sprintf("%s: %d", kind, n))
+		}
+	}
+	logf("requests: %d of a budget of %d (%s)\n", b.spent, b.limit, strings.Join(kinds, ", "))
+}
+
+// requestKind returns what a request is spent on: listing candidate
+// repositories, code searches, downloading files, or GraphQL enrichment.
+func requestKind(req *http.Request) string {
+	p := req.URL.Path
+	switch {
+	case p == "/search/code":
+		return requestCodeSearch
+	case p == "/search/repositories", strings.HasPrefix(p, "/orgs/"), strings.HasPrefix(p, "/users/") && strings.HasSuffix(p, "/repos"):
+		return requestListing
+	case strings.Contains(p, "/contents/"), strings.HasSuffix(p, "/contents"):
+		return requestDownload
+	case p == "/graphql":
+		return requestEnrichment
+	default:
+		return requestOther
+	}
+}
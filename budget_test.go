@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/google/go-github/v63/github"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// budgetClient returns a client for the server of base whose requests are
+// spent from the budget.
+func budgetClient(base *github.Client, budget *requestBudget) *github.Client {
+	transport := newRateLimitTransport(http.DefaultTransport, 0, 0, 0)
+	transport.budget = budget
+	client := github.NewClient(&http.Client{Transport: transport})
+	client.BaseURL = base.BaseURL
+	return client
+}
+
+func TestRequestBudget(t *testing.T) {
+	f := &fakeGitHub{repos: map[string]map[string]string{}}
+	var candidates []candidate
+	for _, name := range []string{"a/one", "a/two", "a/three", "a/four", "a/five"} {
+		f.repos[name] = map[string]string{"go.mod": goModRequiring("v1.0.0")}
+		candidates = append(candidates, fakeCandidate(name, 10))
+	}
+	tests := []struct {
+		name  string
+		limit int
+		// wantChecked are the repositories checked completely
+		wantChecked int
+	}{
+		{name: "one request", limit: 1},
+		// a repository costs a code search, a contents listing and a
+		// download
+		{name: "two repositories", limit: 6, wantChecked: 2},
+		{name: "enough", limit: 100, wantChecked: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f.requests = nil
+			budget := newRequestBudget(tt.limit)
+			ctx, cancel := context.WithCancelCause(context.Background())
+			defer cancel(nil)
+			budget.stopWith(cancel)
+
+			s := newSearchResult("github.com/x/lib", budgetClient(f.client(t), budget), nil)
+			s.paginationDelay, s.searchDelay = 0, 0
+			results, err := s.searchInRepositories(ctx, candidates)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := min(tt.limit, 3*len(candidates))
+			if n := f.requested("/"); n != want {
+				t.Errorf("%d requests made, want %d", n, want)
+			}
+			if budget.spent != want {
+				t.Errorf("%d requests spent, want %d", budget.spent, want)
+			}
+			if spent := errors.Is(context.Cause(ctx), errBudgetSpent); spent != (tt.limit < 3*len(candidates)) {
+				t.Errorf("run stopped by %v", context.Cause(ctx))
+			}
+			checked := 0
+			for _, r := range results {
+				if r.used {
+					checked++
+				}
+			}
+			if checked != tt.wantChecked {
+				t.Errorf("%d repositories checked, want %d", checked, tt.wantChecked)
+			}
+			if budget.byKind[requestCodeSearch] == 0 || tt.limit > 1 && budget.byKind[requestDownload] == 0 {
+				t.Errorf("requests allocated as %v", budget.byKind)
+			}
+		})
+	}
+}
+
+func TestRequestBudgetSpend(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		// wait makes the request wait for the pacer past its context
+		wait      bool
+		wantSpent int
+	}{
+		{name: "api", url: "https://api.github.com/repos/o/r/contents/go.mod", wantSpent: 1},
+		{name: "raw download", url: "https://raw.githubusercontent.com/o/r/main/go.mod"},
+		{name: "canceled while waiting", url: "https://api.github.com/search/code", wait: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := newRateLimitTransport(&recordingTransport{arrivals: make(map[string][]time.Time)}, 0, 0, 0)
+			transport.budget = newRequestBudget(10)
+			ctx := context.Background()
+			if tt.wait {
+				transport.update(http.Header{
+					"X-Ratelimit-Remaining": {"0"},
+					"X-Ratelimit-Reset":     {strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10)},
+					"X-Ratelimit-Resource":  {"code_search"},
+				})
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, 10*time.Millisecond)
+				defer cancel()
+			}
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, tt.url, nil)
+			resp, err := transport.RoundTrip(req)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wait {
+				t.Errorf("error %v", err)
+			}
+			if transport.budget.spent != tt.wantSpent {
+				t.Errorf("%d requests spent, want %d", transport.budget.spent, tt.wantSpent)
+			}
+		})
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheSchemaVersion is bumped whenever cacheColumns change. Version 1 is the
+// original name, used, stars layout.
+const cacheSchemaVersion = 21
+
+// cacheColumns are the columns of the CSV cache, in the order written by
+// writeResults.
+var cacheColumns = []field{
+	{name: "name", kind: "string"},
+	{name: "used", kind: "bool"},
+	{name: "stars", kind: "int"},
+	{name: "version", kind: "string"},
+	{name: "low_confidence", kind: "bool"},
+	{name: "source", kind: "string"},
+	{name: "module_kind", kind: "string"},
+	{name: "branch", kind: "string"},
+	{name: "state", kind: "string"},
+	{name: "vendored", kind: "bool"},
+	{name: "fork", kind: "string"},
+	{name: "size_kb", kind: "int"},
+	{name: "raw_version", kind: "string"},
+	{name: "score", kind: "float"},
+	{name: "confidence", kind: "string"},
+	{name: "forks", kind: "int"},
+	{name: "pushed_at", kind: "time"},
+	{name: "tool", kind: "bool"},
+	{name: "recheck_after", kind: "time"},
+	{name: "created_at", kind: "time"},
+	{name: "stale_indirect", kind: "bool"},
+	{name: "module", kind: "string"},
+	{name: "archived", kind: "bool"},
+	{name: "enriched_at", kind: "time"},
+	{name: "matches", kind: "string"},
+	{name: "default_branch", kind: "string"},
+	{name: "gomod_sha", kind: "string"},
+	{name: "gosum_mismatch", kind: "bool"},
+	{name: "gosum_versions", kind: "string"},
+	{name: "direct_requires", kind: "int"},
+	{name: "usage_files", kind: "int"},
+	{name: "own_module", kind: "string"},
+	{name: "hosting", kind: "string"},
+	{name: "test_only", kind: "bool"},
+	{name: "scan_ms", kind: "int"},
+}
+
+// defaultCacheFile returns the cache file of a package in the state
+// directory.
+func defaultCacheFile(packageName string) string {
+	return filepath.Join(paths.state, strings.ReplaceAll(packageName, "/", "-")+".csv")
+}
+
+// readCacheStream reads the cache from a stream that can't be seeked, e.g.
+// stdin, fully into memory before parsing it.
+func readCacheStream(r io.Reader) (map[string]repoResult, error) {
+	bb, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return readResults(bytes.NewReader(bb))
+}
+
+// readResults reads cached repository results in the CSV cache format
+// (name, used, stars, version, low confidence, source, module kind, branch,
+// state, vendored, fork, size, raw version, score, confidence, forks, pushed
+// at, tool, recheck after, created at, stale indirect, module, archived,
+// enriched at, matches, default branch, go.mod SHA, go.sum mismatch, go.sum
+// versions, direct requires, usage files, own module, hosting, test only, scan
+// milliseconds) and returns them keyed by repository full name. Rows written
+// before the later columns existed are accepted.
+func readResults(r io.Reader) (map[string]repoResult, error) {
+	r, err := decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]repoResult)
+	for _, record := range records {
+		result, err := parseRecord(record)
+		if err != nil {
+			return nil, err
+		}
+		results[result.name] = result
+	}
+
+	return results, nil
+}
+
+// parseRecord parses one row of the CSV cache.
+func parseRecord(record []string) (repoResult, error) {
+	if len(record) < 3 {
+		return repoResult{}, fmt.Errorf("invalid cache record: %v", record)
+	}
+	stars, err := strconv.Atoi(record[2])
+	if err != nil {
+		return repoResult{}, fmt.Errorf("invalid value for star count: %v", record[2])
+	}
+	result := repoResult{
+		name:   record[0],
+		used:   record[1] == "true",
+		stars:  stars,
+		source: sourceCodeSearch,
+	}
+	if len(record) > 3 {
+		result.version = record[3]
+		result.rawVersion = record[3]
+	}
+	if len(record) > 4 {
+		result.lowConfidence = record[4] == "true"
+	}
+	if len(record) > 5 && record[5] != "" {
+		result.source = record[5]
+	}
+	if len(record) > 6 {
+		result.moduleKind = record[6]
+	}
+	if len(record) > 7 {
+		result.branch = record[7]
+	}
+	if len(record) > 8 {
+		result.state = record[8]
+	}
+	if len(record) > 9 && record[9] != "" {
+		result.vendorChecked = true
+		result.vendored = record[9] == "true"
+	}
+	if len(record) > 10 {
+		result.fork = record[10]
+	}
+	if len(record) > 11 && record[11] != "" {
+		result.sizeKB, err = strconv.Atoi(record[11])
+		if err != nil {
+			return repoResult{}, fmt.Errorf("invalid value for size: %v", record[11])
+		}
+	}
+	if len(record) > 12 {
+		result.rawVersion = record[12]
+	}
+	if len(record) > 13 && record[13] != "" {
+		result.score, err = strconv.ParseFloat(record[13], 64)
+		if err != nil {
+			return repoResult{}, fmt.Errorf("invalid value for score: %v", record[13])
+		}
+	}
+	if len(record) > 14 && record[14] != "" {
+		if result.confidence, err = parseConfidence(record[14]); err != nil {
+			return repoResult{}, err
+		}
+	} else {
+		result.confidence = legacyConfidence(result)
+	}
+	if len(record) > 15 && record[15] != "" {
+		result.forks, err = strconv.Atoi(record[15])
+		if err != nil {
+			return repoResult{}, fmt.Errorf("invalid value for forks: %v", record[15])
+		}
+	}
+	if len(record) > 16 && record[16] != "" {
+		result.pushedAt, err = time.Parse(time.RFC3339, record[16])
+		if err != nil {
+			return repoResult{}, fmt.Errorf("invalid value for pushed at: %v", record[16])
+		}
+	}
+	if len(record) > 17 {
+		result.tool = record[17] == "true"
+	}
+	if len(record) > 18 && record[18] != "" {
+		result.recheckAfter, err = time.Parse(time.RFC3339, record[18])
+		if err != nil {
+			return repoResult{}, fmt.Errorf("invalid value for recheck after: %v", record[18])
+		}
+	}
+	if len(record) > 19 && record[19] != "" {
+		result.createdAt, err = time.Parse(time.RFC3339, record[19])
+		if err != nil {
+			return repoResult{}, fmt.Errorf("invalid value for created at: %v", record[19])
+		}
+	}
+	if len(record) > 20 {
+		result.staleIndirect = record[20] == "true"
+	}
+	if len(record) > 21 {
+		result.module = record[21]
+	}
+	if len(record) > 22 {
+		result.archived = record[22] == "true"
+	}
+	if len(record) > 23 && record[23] != "" {
+		result.enrichedAt, err = time.Parse(time.RFC3339, record[23])
+		if err != nil {
+			return repoResult{}, fmt.Errorf("invalid value for enriched at: %v", record[23])
+		}
+	}
+	if len(record) > 24 {
+		result.matches = parseMatches(record[24])
+		if len(result.matches) > 0 {
+			result.goModPath = result.matches[len(result.matches)-1].path
+		}
+	}
+	if len(record) > 25 {
+		result.defaultBranch = record[25]
+	}
+	if len(record) > 26 {
+		result.goModSHA = record[26]
+	}
+	if len(record) > 27 && record[27] != "" {
+		result.goSumChecked = true
+		result.goSumMismatch = record[27] == "true"
+	}
+	if len(record) > 28 && record[28] != "" {
+		result.goSumVersions = strings.Split(record[28], ";")
+	}
+	if len(record) > 29 && record[29] != "" {
+		result.directRequires, err = strconv.Atoi(record[29])
+		if err != nil {
+			return repoResult{}, fmt.Errorf("invalid value for direct requires: %v", record[29])
+		}
+	}
+	if len(record) > 30 && record[30] != "" {
+		result.usageChecked = true
+		result.usageFiles, err = strconv.Atoi(record[30])
+		if err != nil {
+			return repoResult{}, fmt.Errorf("invalid value for usage files: %v", record[30])
+		}
+	}
+	if len(record) > 31 {
+		result.ownModule = record[31]
+	}
+	if len(record) > 32 {
+		result.hosting = record[32]
+	}
+	if len(record) > 33 && record[33] != "" {
+		result.testUsageChecked = true
+		result.testOnly, err = strconv.ParseBool(record[33])
+		if err != nil {
+			return repoResult{}, fmt.Errorf("invalid value for test only: %v", record[33])
+		}
+	}
+	if len(record) > 34 && record[34] != "" {
+		ms, err := strconv.ParseInt(record[34], 10, 64)
+		if err != nil {
+			return repoResult{}, fmt.Errorf("invalid value for scan ms: %v", record[34])
+		}
+		result.scanDuration = time.Duration(ms) * time.Millisecond
+	}
+	// versions cached before normalization existed are normalized here
+	result.version = normalizeVersion(result.version)
+	return result, nil
+}
+
+// writeResults writes the results in the CSV cache format.
+func writeResults(w io.Writer, results []repoResult) error {
+	writer := csv.NewWriter(w)
+
+	for _, repoResult := range results {
+		foundStr := "false"
+		if repoResult.used {
+			foundStr = "true"
+		}
+		vendoredStr := ""
+		if repoResult.vendorChecked {
+			vendoredStr = strconv.FormatBool(repoResult.vendored)
+		}
+		testOnlyStr := ""
+		if repoResult.testUsageChecked {
+			testOnlyStr = strconv.FormatBool(repoResult.testOnly)
+		}
+		scanMsStr := ""
+		if repoResult.scanDuration > 0 {
+			scanMsStr = strconv.FormatInt(repoResult.scanDuration.Milliseconds(), 10)
+		}
+		usageFilesStr := ""
+		if repoResult.usageChecked {
+			usageFilesStr = strconv.Itoa(repoResult.usageFiles)
+		}
+		goSumMismatchStr := ""
+		if repoResult.goSumChecked {
+			goSumMismatchStr = strconv.FormatBool(repoResult.goSumMismatch)
+		}
+		err := writer.Write([]string{
+			repoResult.name,
+			foundStr,
+			strconv.Itoa(repoResult.stars),
+			repoResult.version,
+			strconv.FormatBool(repoResult.lowConfidence),
+			repoResult.source,
+			repoResult.moduleKind,
+			repoResult.branch,
+			repoResult.state,
+			vendoredStr,
+			repoResult.fork,
+			strconv.Itoa(repoResult.sizeKB),
+			repoResult.rawVersion,
+			strconv.FormatFloat(repoResult.score, 'g', -1, 64),
+			repoResult.confidence,
+			strconv.Itoa(repoResult.forks),
+			formatTime(repoResult.pushedAt),
+			strconv.FormatBool(repoResult.tool),
+			formatTime(repoResult.recheckAfter),
+			formatTime(repoResult.createdAt),
+			strconv.FormatBool(repoResult.staleIndirect),
+			repoResult.module,
+			strconv.FormatBool(repoResult.archived),
+			formatTime(repoResult.enrichedAt),
+			formatMatches(repoResult.matches),
+			repoResult.defaultBranch,
+			repoResult.goModSHA,
+			goSumMismatchStr,
+			strings.Join(repoResult.goSumVersions, ";"),
+			strconv.Itoa(repoResult.directRequires),
+			usageFilesStr,
+			repoResult.ownModule,
+			repoResult.hosting,
+			testOnlyStr,
+			scanMsStr,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// checkWritable fails if a file can't be created and written in dir, so a
+// read-only cache or output directory is noticed before any expensive work
+// starts.
+func checkWritable(dir string) error {
+	file, err := os.CreateTemp(dir, ".pkgstats-write-check-*")
+	if err != nil {
+		return fmt.Errorf("directory %s is not writable: %v", dir, err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.WriteString("ok"); err != nil {
+		file.Close()
+		return fmt.Errorf("directory %s is not writable: %v", dir, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("directory %s is not writable: %v", dir, err)
+	}
+
+	return nil
+}
+
+// saveCache replaces the cache file with the results through a temporary
+// file, so a success means the results are on disk and a failure leaves the
+// previous cache as it was.
+func saveCache(fileName string, results []repoResult) error {
+	if err := replaceCache(fileName, results); err != nil {
+		return err
+	}
+	logf("wrote to the file: %s\n", fileName)
+	return nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// errDiskFull is returned by failingWriter once its space is used.
+var errDiskFull = errors.New("no space left on device")
+
+// failingWriter accepts space bytes and then fails like a full disk.
+type failingWriter struct {
+	space int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.space {
+		n := w.space
+		w.space = 0
+		return n, errDiskFull
+	}
+	w.space -= len(p)
+	return len(p), nil
+}
+
+func TestWriteResultsError(t *testing.T) {
+	results := []repoResult{{name: "a/one", used: true, stars: 10, version: "v1.0.0"}, {name: "a/two", stars: 5}}
+	tests := []struct {
+		name     string
+		space    int
+		compress bool
+	}{
+		{name: "full disk", space: 0},
+		{name: "fills up", space: 20},
+		{name: "compressed", space: 0, compress: true},
+		{name: "compressed fills up", space: 15, compress: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := writeCompressed(&failingWriter{space: tt.space}, tt.compress, func(w io.Writer) error {
+				return writeResults(w, results)
+			})
+			if !errors.Is(err, errDiskFull) {
+				t.Errorf("error %v, want %v", err, errDiskFull)
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := writeResults(&buf, results); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeResults(&failingWriter{space: buf.Len()}, results); err != nil {
+		t.Errorf("error %v with just enough space", err)
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	base := t.TempDir()
+	readOnly := filepath.Join(base, "read-only")
+	if err := os.Mkdir(readOnly, 0555); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(base, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		dir     string
+		wantErr bool
+		// skipAsRoot is set for the checks root gets past
+		skipAsRoot bool
+	}{
+		{name: "writable", dir: base},
+		{name: "read-only", dir: readOnly, wantErr: true, skipAsRoot: true},
+		{name: "missing", dir: filepath.Join(base, "missing"), wantErr: true},
+		{name: "not a directory", dir: file, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.skipAsRoot && os.Geteuid() == 0 {
+				t.Skip("root writes to read-only directories")
+			}
+			err := checkWritable(tt.dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want one: %v", err, tt.wantErr)
+			}
+			// the check leaves nothing behind
+			if entries, _ := filepath.Glob(filepath.Join(tt.dir, ".pkgstats-write-check-*")); len(entries) > 0 {
+				t.Errorf("check files left: %v", entries)
+			}
+		})
+	}
+}
+
+func TestReadCacheStream(t *testing.T) {
+	results := []repoResult{{name: "a/one", used: true, stars: 10, version: "v1.0.0"}, {name: "a/two", stars: 5}}
+	var plain, compressed bytes.Buffer
+	if err := writeResults(&plain, results); err != nil {
+		t.Fatal(err)
+	}
+	err := writeCompressed(&compressed, true, func(w io.Writer) error {
+		return writeResults(w, results)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		r       io.Reader
+		want    int
+		wantErr bool
+	}{
+		{name: "plain", r: bytes.NewReader(plain.Bytes()), want: 2},
+		{name: "compressed", r: bytes.NewReader(compressed.Bytes()), want: 2},
+		// a pipe hands out the cache in small reads
+		{name: "one byte at a time", r: iotest.OneByteReader(bytes.NewReader(plain.Bytes())), want: 2},
+		{name: "empty", r: strings.NewReader(""), want: 0},
+		{name: "malformed", r: strings.NewReader("a/one,true,many\n"), wantErr: true},
+		{name: "read error", r: iotest.TimeoutReader(iotest.OneByteReader(bytes.NewReader(plain.Bytes()))), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readCacheStream(tt.r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want one: %v", err, tt.wantErr)
+			}
+			if len(got) != tt.want {
+				t.Errorf("%d results, want %d", len(got), tt.want)
+			}
+			if tt.want > 0 && got["a/one"].version != "v1.0.0" {
+				t.Errorf("a/one read as %+v", got["a/one"])
+			}
+		})
+	}
+}
+
+func TestCacheFileCompression(t *testing.T) {
+	results := []repoResult{{name: "a/one", used: true, stars: 10, version: "v1.0.0"}, {name: "a/two", stars: 5}}
+	tests := []struct {
+		fileName       string
+		wantCompressed bool
+	}{
+		{fileName: "pkg.csv"},
+		{fileName: "pkg.csv.gz", wantCompressed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fileName, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), tt.fileName)
+			if err := saveCache(fileName, results); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if compressed := bytes.HasPrefix(data, gzipMagic); compressed != tt.wantCompressed {
+				t.Errorf("file compressed: %v, want %v", compressed, tt.wantCompressed)
+			}
+
+			got, err := readCacheFile(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(results) || got["a/one"].version != "v1.0.0" || got["a/two"].stars != 5 {
+				t.Errorf("saved results read as %v", got)
+			}
+
+			// a cache renamed to or from .gz is read by its content
+			renamed := filepath.Join(t.TempDir(), "renamed.csv")
+			if !tt.wantCompressed {
+				renamed += ".gz"
+			}
+			if err := os.WriteFile(renamed, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := readCacheFile(renamed); err != nil || len(got) != len(results) {
+				t.Errorf("renamed cache read as %v, %v", got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// cacheIssue is a problem found in a cache file by validateCache.
+type cacheIssue struct {
+	// line is the line of the row in the file, 1-based
+	line    int
+	problem string
+}
+
+// validateCache checks every row of a cache: rows that don't parse, rows with
+// more columns than the current schema, duplicate repositories, negative
+// counts, creation or push times in the future and versions recorded for
+// repositories that don't use the package. It returns the issues and the
+// results a repaired cache would hold: the parsing rows, first occurrence
+// wins, with negative counts set to 0, future times and stray versions
+// cleared.
+func validateCache(r io.Reader) ([]cacheIssue, []repoResult) {
+	r, err := decompress(r)
+	if err != nil {
+		return []cacheIssue{{line: 1, problem: err.Error()}}, nil
+	}
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	var (
+		issues   []cacheIssue
+		repaired []repoResult
+		seenAt   = make(map[string]int)
+	)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// a broken quote or similar makes the rest of the file unreliable,
+			// and leaves no field to take the line from
+			line := 0
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				line = parseErr.StartLine
+			}
+			issues = append(issues, cacheIssue{line: line, problem: err.Error()})
+			break
+		}
+		line, _ := reader.FieldPos(0)
+
+		if len(record) > len(cacheColumns) {
+			issues = append(issues, cacheIssue{line: line, problem: fmt.Sprintf(
+				"%d columns, schema version %d has %d", len(record), cacheSchemaVersion, len(cacheColumns))})
+		}
+
+		result, err := parseRecord(record)
+		if err != nil {
+			issues = append(issues, cacheIssue{line: line, problem: err.Error()})
+			continue
+		}
+
+		if first, ok := seenAt[result.name]; ok {
+			issues = append(issues, cacheIssue{line: line, problem: fmt.Sprintf("duplicate of %s on line %d", result.name, first)})
+			continue
+		}
+		seenAt[result.name] = line
+
+		for _, count := range []struct {
+			name  string
+			value *int
+		}{
+			{name: "stars", value: &result.stars},
+			{name: "size_kb", value: &result.sizeKB},
+			{name: "forks", value: &result.forks},
+		} {
+			if *count.value < 0 {
+				issues = append(issues, cacheIssue{line: line, problem: fmt.Sprintf("negative %s: %d", count.name, *count.value)})
+				*count.value = 0
+			}
+		}
+
+		now := time.Now()
+		for _, t := range []struct {
+			name  string
+			value *time.Time
+		}{
+			{name: "created_at", value: &result.createdAt},
+			{name: "pushed_at", value: &result.pushedAt},
+		} {
+			if t.value.After(now) {
+				issues = append(issues, cacheIssue{line: line, problem: fmt.Sprintf("%s in the future: %s", t.name, formatTime(*t.value))})
+				*t.value = time.Time{}
+			}
+		}
+
+		if !result.used && result.version != "" {
+			issues = append(issues, cacheIssue{line: line, problem: fmt.Sprintf("version %s set but the package is not used", result.version)})
+			result.version, result.rawVersion = "", ""
+		}
+
+		repaired = append(repaired, result)
+	}
+
+	return issues, repaired
+}
+
+// runValidateCache reports the issues of the cache file and, with fix set,
+// rewrites it with the repaired results. Issues left unfixed are an error.
+func runValidateCache(fileName string, fix bool) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return fmt.Errorf("error opening the cache: %v", err)
+	}
+	issues, repaired := validateCache(file)
+	file.Close()
+
+	for _, issue := range issues {
+		logf("%s:%d: %s\n", fileName, issue.line, issue.problem)
+	}
+	if len(issues) == 0 {
+		logf("%s: no issues found, %d rows\n", fileName, len(repaired))
+		return nil
+	}
+	if !fix {
+		return fmt.Errorf("%d issues found in %s, repair it with `pkgstats cache verify -repair`", len(issues), fileName)
+	}
+
+	if err := replaceCache(fileName, repaired); err != nil {
+		return err
+	}
+	logf("%s: repaired, %d rows kept\n", fileName, len(repaired))
+	return nil
+}
+
+// replaceCache writes the results to a temporary file next to the cache and
+// renames it over the cache, so the cache is never left half written.
+func replaceCache(fileName string, results []repoResult) error {
+	tmp, err := os.CreateTemp(filepath.Dir(fileName), ".pkgstats-cache-*")
+	if err != nil {
+		return fmt.Errorf("error creating a temporary cache: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	err = writeCompressed(tmp, isCompressed(fileName), func(w io.Writer) error {
+		return writeResults(w, results)
+	})
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing the temporary cache: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error syncing the temporary cache: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error closing the temporary cache: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), fileName); err != nil {
+		return fmt.Errorf("error replacing the cache: %v", err)
+	}
+	return nil
+}
+
+// warnCacheIssues logs the number of issues of an existing cache, a cheap
+// check before hours of work build on it.
+func warnCacheIssues(fileName string) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	if issues, _ := validateCache(file); len(issues) > 0 {
+		logf("warning: the cache %s has %d issues, run `pkgstats cache verify -cache-file %s` to see them\n", fileName, len(issues), fileName)
+	}
+}
+
+// runCache is the `pkgstats cache` command, with the verify and migrate
+// subcommands.
+func runCache(args []string) error {
+	if len(args) == 1 && args[0] == "migrate" {
+		return migrateLegacyCache(paths.state)
+	}
+	if len(args) == 0 || args[0] != "verify" {
+		return fmt.Errorf("usage: pkgstats cache verify [-pkg package | -cache-file file] [-repair] | pkgstats cache migrate")
+	}
+
+	fs := flag.NewFlagSet("cache verify", flag.ContinueOnError)
+	var (
+		pkg      string
+		fileName string
+		repair   bool
+	)
+	fs.StringVar(&pkg, "pkg", "", "package whose cache to verify")
+	fs.StringVar(&fileName, "cache-file", "", "cache file to verify instead of the one of -pkg")
+	fs.BoolVar(&repair, "repair", false, "rewrite the cache without the issues found")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	return verifyCache(pkg, fileName, repair)
+}
+
+// verifyCache is `pkgstats cache verify` and its -validate-cache alias: it
+// validates the cache file, or the cache of the package, and repairs it
+// with repair set.
+func verifyCache(pkg, fileName string, repair bool) error {
+	if fileName == "" && pkg == "" {
+		return fmt.Errorf("cache verify requires -pkg or -cache-file")
+	}
+	if fileName == "" {
+		fileName = defaultCacheFile(pkg)
+	}
+	if isHistoryFile(fileName) {
+		return fmt.Errorf("%s is the history of a cache, not a cache", fileName)
+	}
+	return runValidateCache(fileName, repair)
+}
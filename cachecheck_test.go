@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateCache(t *testing.T) {
+	tests := []struct {
+		name      string
+		cache     string
+		wantLines []int
+		wantRows  int
+	}{
+		{name: "clean", cache: "a/one,true,10,v1.0.0\na/two,false,5\n", wantRows: 2},
+		{name: "bad star count", cache: "a/one,true,10\na/two,true,many\n", wantLines: []int{2}, wantRows: 1},
+		{name: "duplicate", cache: "a/one,true,10\na/two,false,5\na/one,false,3\n", wantLines: []int{3}, wantRows: 2},
+		{name: "negative stars", cache: "a/one,false,-3\n", wantLines: []int{1}, wantRows: 1},
+		{name: "stray version", cache: "a/one,false,7,v1.0.0\n", wantLines: []int{1}, wantRows: 1},
+		{name: "too many columns", cache: "a/one,true,1" + strings.Repeat(",", len(cacheColumns)) + "\n", wantLines: []int{1}, wantRows: 1},
+		{name: "broken quote", cache: "a/one,true,1\n\"a/two,true,1\n", wantLines: []int{2}, wantRows: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues, repaired := validateCache(strings.NewReader(tt.cache))
+			var lines []int
+			for _, issue := range issues {
+				lines = append(lines, issue.line)
+			}
+			if len(lines) != len(tt.wantLines) {
+				t.Fatalf("issues %v, want them on lines %v", issues, tt.wantLines)
+			}
+			for i := range lines {
+				if lines[i] != tt.wantLines[i] {
+					t.Errorf("issue %d on line %d, want %d", i, lines[i], tt.wantLines[i])
+				}
+			}
+			if len(repaired) != tt.wantRows {
+				t.Errorf("%d repaired rows, want %d", len(repaired), tt.wantRows)
+			}
+		})
+	}
+}
+
+func TestVerifyCacheRepair(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "corrupted.csv")
+	if err := os.WriteFile(fileName, []byte("a/one,true,10,v1.0.0\na/one,true,10\na/two,false,-1,v2.0.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyCache("", fileName, false); err == nil {
+		t.Fatal("no error for a corrupted cache")
+	}
+	if err := verifyCache("", fileName, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyCache("", fileName, false); err != nil {
+		t.Errorf("repaired cache: %v", err)
+	}
+	if err := verifyCache("", historyFile(fileName), false); err == nil {
+		t.Error("no error for a history file")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"github.com/google/go-github/v63/github"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// candidate is a repository to inspect for the package usage. It is
+// independent of the source that enumerated it.
+type candidate struct {
+	id        int64
+	name      string
+	owner     string
+	repo      string
+	stars     int
+	sizeKB    int
+	forks     int
+	pushedAt  time.Time
+	createdAt time.Time
+	archived  bool
+	disabled  bool
+	fork      bool
+
+	description   string
+	mirrorURL     string
+	defaultBranch string
+}
+
+// candidatesFromSearch converts a repository search result page into candidates.
+func candidatesFromSearch(result *github.RepositoriesSearchResult) []candidate {
+	candidates := make([]candidate, 0, len(result.Repositories))
+	for _, repo := range result.Repositories {
+		candidates = append(candidates, candidateFromRepository(repo))
+	}
+	return candidates
+}
+
+func candidateFromRepository(repo *github.Repository) candidate {
+	return candidate{
+		id:        repo.GetID(),
+		name:      repo.GetFullName(),
+		owner:     repo.GetOwner().GetLogin(),
+		repo:      repo.GetName(),
+		stars:     repo.GetStargazersCount(),
+		sizeKB:    repo.GetSize(),
+		forks:     repo.GetForksCount(),
+		pushedAt:  repo.GetPushedAt().Time,
+		createdAt: repo.GetCreatedAt().Time,
+		archived:  repo.GetArchived(),
+		disabled:  repo.GetDisabled(),
+		fork:      repo.GetFork(),
+
+		description:   repo.GetDescription(),
+		mirrorURL:     repo.GetMirrorURL(),
+		defaultBranch: repo.GetDefaultBranch(),
+	}
+}
+
+// youngerThan reports whether the repository was created, or last pushed,
+// less than d ago. A push can be a rename or a history rewrite the code
+// search index hasn't caught up with either.
+func (c candidate) youngerThan(d time.Duration) bool {
+	cutoff := time.Now().Add(-d)
+	return c.createdAt.After(cutoff) || c.pushedAt.After(cutoff)
+}
+
+// filterCandidates drops the candidates that should never be inspected.
+func filterCandidates(candidates []candidate) []candidate {
+	filtered := make([]candidate, 0, len(candidates))
+	for _, c := range candidates {
+		if c.archived || c.disabled || c.fork {
+			logf("Skipping arhived, disabled, forked repository: %s\n", c.name)
+			continue
+		}
+		filtered = append(filtered, c)
+	}
+	return filtered
+}
+
+// mirrorDescriptionRe matches descriptions that say the repository is a
+// mirror of another one. It is kept conservative, "[mirror]" style tags are
+// also used by canonical repositories hosted elsewhere.
+var mirrorDescriptionRe = regexp.MustCompile(`(?i)\b(mirror of|read-only mirror)\b`)
+
+// knownMirrorOwners are accounts that only hold mirrors of other projects.
+var knownMirrorOwners = map[string]bool{
+	"gitmirror": true,
+	"mirror":    true,
+	"mirrors":   true,
+}
+
+// likelyMirror reports whether the candidate is probably a mirror of a
+// repository that is counted on its own.
+func likelyMirror(c candidate) bool {
+	return c.mirrorURL != "" ||
+		knownMirrorOwners[strings.ToLower(c.owner)] ||
+		mirrorDescriptionRe.MatchString(c.description)
+}
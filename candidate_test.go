@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFilterCandidates(t *testing.T) {
+	tests := []struct {
+		name      string
+		candidate candidate
+		want      bool
+	}{
+		{name: "active", candidate: candidate{name: "a/active"}, want: true},
+		{name: "archived", candidate: candidate{name: "a/archived", archived: true}},
+		{name: "disabled", candidate: candidate{name: "a/disabled", disabled: true}},
+		{name: "fork", candidate: candidate{name: "a/fork", fork: true}},
+		{name: "mirror", candidate: candidate{name: "a/mirror", mirrorURL: "https://example.com/a/mirror.git"}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept := len(filterCandidates([]candidate{tt.candidate})) == 1
+			if kept != tt.want {
+				t.Errorf("kept: %v, want %v", kept, tt.want)
+			}
+		})
+	}
+}
+
+func TestLikelyMirror(t *testing.T) {
+	tests := []struct {
+		name      string
+		candidate candidate
+		want      bool
+	}{
+		{name: "mirror URL", candidate: candidate{owner: "acme", mirrorURL: "https://gitlab.com/acme/api.git"}, want: true},
+		{name: "mirror owner", candidate: candidate{owner: "Mirrors"}, want: true},
+		{name: "mirror of", candidate: candidate{owner: "acme", description: "Mirror of https://go.googlesource.com/tools"}, want: true},
+		{name: "read-only mirror", candidate: candidate{owner: "acme", description: "Read-only mirror, send patches to Gerrit"}, want: true},
+		{name: "mirror tag", candidate: candidate{owner: "acme", description: "[mirror] Go supplementary tools"}},
+		{name: "mirroring tool", candidate: candidate{owner: "acme", description: "Mirrors container images between registries"}},
+		{name: "mirror in a word", candidate: candidate{owner: "acme", description: "mirrormaker for Kafka"}},
+		{name: "mirror in the owner", candidate: candidate{owner: "mirror-labs"}},
+		{name: "plain", candidate: candidate{owner: "acme", description: "An API server"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := likelyMirror(tt.candidate); got != tt.want {
+				t.Errorf("likelyMirror = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/go-github/v63/github"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// codeSearchResult is the code search response including the relevance score
+// of each file, which go-github's CodeResult does not expose.
+type codeSearchResult struct {
+	Total             *int                `json:"total_count,omitempty"`
+	IncompleteResults *bool               `json:"incomplete_results,omitempty"`
+	CodeResults       []*scoredCodeResult `json:"items,omitempty"`
+}
+
+type scoredCodeResult struct {
+	github.CodeResult
+	Score *float64 `json:"score,omitempty"`
+}
+
+func (r *codeSearchResult) GetTotal() int {
+	if r == nil || r.Total == nil {
+		return 0
+	}
+	return *r.Total
+}
+
+func (r *codeSearchResult) GetIncompleteResults() bool {
+	if r == nil || r.IncompleteResults == nil {
+		return false
+	}
+	return *r.IncompleteResults
+}
+
+func (r *scoredCodeResult) GetScore() float64 {
+	if r == nil || r.Score == nil {
+		return 0
+	}
+	return *r.Score
+}
+
+// searchCode runs a code search like client.Search.Code, keeping the scores.
+func searchCode(ctx context.Context, client *github.Client, query string) (*codeSearchResult, *github.Response, error) {
+	params := url.Values{"q": {query}, "per_page": {strconv.Itoa(maxPerPage)}}
+	req, err := client.NewRequest("GET", "search/code?"+params.Encode(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3.text-match+json")
+
+	result := new(codeSearchResult)
+	resp, err := client.Do(ctx, req, result)
+	if err != nil {
+		return nil, resp, err
+	}
+	return result, resp, nil
+}
+
+// shallowestGoMods returns the n go.mod files closest to the repository root,
+// the most likely to be real modules rather than fixtures. Files at the same
+// depth are ordered by path.
+func shallowestGoMods(files []*scoredCodeResult, n int) []*scoredCodeResult {
+	sorted := make([]*scoredCodeResult, len(files))
+	copy(sorted, files)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		di, dj := strings.Count(sorted[i].GetPath(), "/"), strings.Count(sorted[j].GetPath(), "/")
+		if di != dj {
+			return di < dj
+		}
+		return sorted[i].GetPath() < sorted[j].GetPath()
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+// maxCodeSearchFailures is the number of consecutive refused code searches
+// after which the code search is considered unavailable for the run.
+const maxCodeSearchFailures = 3
+
+// errCodeSearchUnavailable is returned by searchGoMods when GitHub refuses
+// code searches for the account.
+var errCodeSearchUnavailable = errors.New("code search unavailable")
+
+// searchGoMods searches the go.mod files of the repository that mention the
+// package. Code searches refused with 403, which is not a rate limit, return
+// errCodeSearchUnavailable and after maxCodeSearchFailures in a row no more
+// code searches are made.
+func (s *searchResult) searchGoMods(ctx context.Context, repo candidate) (*codeSearchResult, error) {
+	if s.codeSearchFailures >= maxCodeSearchFailures {
+		return nil, errCodeSearchUnavailable
+	}
+
+	stop := s.timings.track(phaseCodeSearch, repo.name)
+	files, resp, err := searchCode(
+		ctx,
+		s.client,
+		fmt.Sprintf("%s repo:%s filename:go.mod", s.packageName, repo.name),
+	)
+	stop()
+	if err != nil {
+		var errResp *github.ErrorResponse
+		if errors.As(err, &errResp) && errResp.Response != nil && errResp.Response.StatusCode == http.StatusForbidden {
+			s.codeSearchFailures++
+			logf("code search refused for repository %s, checking the root go.mod only: %v\n", repo.name, withRequestID(err))
+			if s.codeSearchFailures == maxCodeSearchFailures {
+				logf("code search refused %d times in a row, only root go.mod files are checked from now on\n", maxCodeSearchFailures)
+			}
+			return nil, errCodeSearchUnavailable
+		}
+		return nil, err
+	}
+	s.codeSearchFailures = 0
+
+	logf("searched repository: %s\n", repo.name)
+	logf("HTTP status code: %d, total files: %d\n", resp.StatusCode, files.GetTotal())
+	return files, nil
+}
+
+// rootGoModOnly is the code search result standing in when the code search
+// is unavailable: the root go.mod, whether it mentions the package or not.
+func rootGoModOnly() *codeSearchResult {
+	return &codeSearchResult{
+		Total: github.Int(1),
+		CodeResults: []*scoredCodeResult{
+			{CodeResult: github.CodeResult{Path: github.String("go.mod")}},
+		},
+	}
+}
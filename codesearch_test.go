@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"github.com/google/go-github/v63/github"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestShallowestGoMods(t *testing.T) {
+	files := func(paths ...string) []*scoredCodeResult {
+		results := make([]*scoredCodeResult, len(paths))
+		for i, p := range paths {
+			results[i] = &scoredCodeResult{CodeResult: github.CodeResult{Path: github.String(p)}}
+		}
+		return results
+	}
+	tests := []struct {
+		name  string
+		paths []string
+		n     int
+		want  []string
+	}{
+		{name: "root first", paths: []string{"a/b/go.mod", "go.mod", "a/go.mod"}, n: 3, want: []string{"go.mod", "a/go.mod", "a/b/go.mod"}},
+		{name: "truncated", paths: []string{"testdata/x/go.mod", "tools/go.mod", "go.mod", "api/go.mod"}, n: 2, want: []string{"go.mod", "api/go.mod"}},
+		{name: "same depth by path", paths: []string{"z/go.mod", "b/go.mod", "m/go.mod"}, n: 2, want: []string{"b/go.mod", "m/go.mod"}},
+		{name: "under the cap", paths: []string{"b/go.mod", "go.mod"}, n: 5, want: []string{"go.mod", "b/go.mod"}},
+		{name: "none", n: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := files(tt.paths...)
+			var got []string
+			for _, f := range shallowestGoMods(in, tt.n) {
+				got = append(got, f.GetPath())
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			// the code search order is left alone
+			for i, f := range in {
+				if f.GetPath() != tt.paths[i] {
+					t.Fatalf("input reordered: %v", in)
+				}
+			}
+		})
+	}
+}
+
+func TestMaxGoModsPerRepo(t *testing.T) {
+	repo := map[string]string{
+		"go.mod":                  "module example.com/app\n\nrequire github.com/x/libx v1.0.0\n",
+		"tools/go.mod":            goModRequiring("v1.1.0"),
+		"internal/deep/go.mod":    goModRequiring("v1.2.0"),
+		"examples/one/sub/go.mod": goModRequiring("v1.3.0"),
+	}
+	tests := []struct {
+		name          string
+		max           int
+		wantDownloads int
+		wantMatches   int
+		wantPartial   bool
+	}{
+		{name: "no cap", max: 0, wantDownloads: 4, wantMatches: 3},
+		{name: "cap over the files", max: 10, wantDownloads: 4, wantMatches: 3},
+		// the root and tools go.mod files are the shallowest
+		{name: "capped", max: 2, wantDownloads: 2, wantMatches: 1, wantPartial: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeGitHub{repos: map[string]map[string]string{"a/mono": repo}}
+			s := newFakeSearch(t, f, "github.com/x/lib")
+			s.maxGoModsPerRepo = tt.max
+			results, err := s.searchInRepositories(context.Background(), []candidate{fakeCandidate("a/mono", 10)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := f.requested("/raw/"); n != tt.wantDownloads {
+				t.Errorf("%d go.mod files downloaded, want %d", n, tt.wantDownloads)
+			}
+			got := results["a/mono"]
+			if len(got.matches) != tt.wantMatches {
+				t.Errorf("matches %v, want %d", got.matches, tt.wantMatches)
+			}
+			if partial := got.state == statePartialScan; partial != tt.wantPartial {
+				t.Errorf("state %q, partial: %v, want %v", got.state, partial, tt.wantPartial)
+			}
+			if partial := summarize([]repoResult{got}).partialScans == 1; partial != tt.wantPartial {
+				t.Errorf("counted as a partial scan in the summary: %v, want %v", partial, tt.wantPartial)
+			}
+		})
+	}
+}
+
+func TestCodeSearchFallback(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		wantUsed     []string
+		wantSource   string
+		wantSearches int
+	}{
+		// after maxCodeSearchFailures refusals the code search isn't tried
+		{name: "refused", status: http.StatusForbidden, wantUsed: []string{"a/one", "a/two", "a/three", "a/four"}, wantSource: sourceRootGoMod, wantSearches: maxCodeSearchFailures},
+		// the nested go.mod of a/four is only found by the code search
+		{name: "available", wantUsed: []string{"a/one", "a/two", "a/three", "a/four", "a/nested"}, wantSource: sourceCodeSearch, wantSearches: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeGitHub{
+				repos: map[string]map[string]string{
+					"a/one":    {"go.mod": goModRequiring("v1.0.0")},
+					"a/two":    {"go.mod": goModRequiring("v1.0.0")},
+					"a/three":  {"go.mod": goModRequiring("v1.0.0")},
+					"a/four":   {"go.mod": goModRequiring("v1.0.0")},
+					"a/nested": {"go.mod": "module example.com/nested\n", "tools/go.mod": goModRequiring("v1.0.0")},
+				},
+				codeSearchStatus: tt.status,
+			}
+			s := newFakeSearch(t, f, "github.com/x/lib")
+			var candidates []candidate
+			for _, name := range []string{"a/one", "a/two", "a/three", "a/four", "a/nested"} {
+				candidates = append(candidates, fakeCandidate(name, 10))
+			}
+			results, err := s.searchInRepositories(context.Background(), candidates)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := f.requested("/search/code"); n != tt.wantSearches {
+				t.Errorf("%d code searches, want %d", n, tt.wantSearches)
+			}
+			var used []string
+			for _, c := range candidates {
+				got := results[c.name]
+				if got.used {
+					used = append(used, c.name)
+				}
+				if got.source != tt.wantSource {
+					t.Errorf("%s from %q, want %q", c.name, got.source, tt.wantSource)
+				}
+			}
+			if strings.Join(used, ",") != strings.Join(tt.wantUsed, ",") {
+				t.Errorf("used by %v, want %v", used, tt.wantUsed)
+			}
+		})
+	}
+}
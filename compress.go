@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+)
+
+// gzipMagic starts every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// isCompressed reports whether a file is written gzip-compressed, which its
+// .gz extension decides.
+func isCompressed(fileName string) bool {
+	return strings.HasSuffix(fileName, ".gz")
+}
+
+// decompress returns the content of r, decompressed when it is a gzip
+// stream whatever the file name, as is otherwise.
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(len(gzipMagic)); !bytes.Equal(magic, gzipMagic) {
+		return br, nil
+	}
+	return gzip.NewReader(br)
+}
+
+// writeCompressed calls write with w, or with a gzip writer to w when
+// compress is set. A file is synced once the stream is complete.
+func writeCompressed(w io.Writer, compress bool, write func(io.Writer) error) error {
+	if !compress {
+		return write(w)
+	}
+	zw := gzip.NewWriter(w)
+	if err := write(zw); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if file, ok := w.(*os.File); ok {
+		return file.Sync()
+	}
+	return nil
+}
+
+// trimCacheExt returns the cache file name without its .csv or .csv.gz
+// extension, the base of the names of its history and manifest.
+func trimCacheExt(cacheFile string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(cacheFile, ".gz"), ".csv")
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Confidence levels of a result, from the evidence it is based on:
+//   - high: a go.mod file of the repository was parsed
+//   - medium: GitHub's dependency graph lists the repository, but its go.mod
+//     was not checked, or the code search was unavailable and the package
+//     is not in the root go.mod
+//   - low: the code search found nothing with incomplete results and the
+//     root go.mod could not be read, or the repository was not checked
+const (
+	confidenceHigh   = "high"
+	confidenceMedium = "medium"
+	confidenceLow    = "low"
+)
+
+// confidenceLevels lists the levels from the strongest to the weakest.
+var confidenceLevels = []string{confidenceHigh, confidenceMedium, confidenceLow}
+
+// confidenceRank returns the position of a level in confidenceLevels, unknown
+// levels rank below low.
+func confidenceRank(level string) int {
+	for i, l := range confidenceLevels {
+		if l == level {
+			return i
+		}
+	}
+	return len(confidenceLevels)
+}
+
+// parseConfidence checks a confidence level given on the command line.
+func parseConfidence(level string) (string, error) {
+	if confidenceRank(level) == len(confidenceLevels) {
+		return "", fmt.Errorf("unknown confidence level %q, supported: %s", level, strings.Join(confidenceLevels, ", "))
+	}
+	return level, nil
+}
+
+// legacyConfidence derives the confidence of a cached result written before
+// the level was stored.
+func legacyConfidence(r repoResult) string {
+	switch {
+	case r.state == stateSkippedMirror || r.lowConfidence:
+		return confidenceLow
+	case r.source == sourceDependents:
+		return confidenceMedium
+	default:
+		return confidenceHigh
+	}
+}
+
+// meetsConfidence reports whether the result is at least as confident as
+// the given level.
+func (r repoResult) meetsConfidence(level string) bool {
+	return confidenceRank(r.confidence) <= confidenceRank(level)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestRequireConfirmed(t *testing.T) {
+	ctx := context.Background()
+	f := &fakeGitHub{
+		repos: map[string]map[string]string{
+			"a/parsed":     {"go.mod": goModRequiring("v1.0.0")},
+			"a/unreadable": {"README.md": "no go.mod"},
+		},
+		incomplete: map[string]bool{"a/unreadable": true},
+	}
+	s := newFakeSearch(t, f, "github.com/x/lib")
+	results, err := s.searchInRepositories(ctx, []candidate{fakeCandidate("a/parsed", 10), fakeCandidate("a/unreadable", 10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dependents, err := dependentsResults(ctx, fakeDependents{dependents: []string{"a/listed"}}, "github.com/x/lib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for repo, r := range dependents {
+		if _, ok := results[repo]; !ok {
+			results[repo] = r
+		}
+	}
+
+	tests := []struct {
+		repo          string
+		wantConfirmed bool
+	}{
+		{repo: "a/parsed", wantConfirmed: true},
+		{repo: "a/unreadable"},
+		{repo: "a/listed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.repo, func(t *testing.T) {
+			r, ok := results[tt.repo]
+			if !ok {
+				t.Fatalf("no result for %s", tt.repo)
+			}
+			// -require-confirmed is -min-confidence high
+			if got := r.meetsConfidence(confidenceHigh); got != tt.wantConfirmed {
+				t.Errorf("confirmed: %v with confidence %q, want %v", got, r.confidence, tt.wantConfirmed)
+			}
+		})
+	}
+}
+
+func TestConfidencePaths(t *testing.T) {
+	tests := []struct {
+		name           string
+		fake           *fakeGitHub
+		candidate      candidate
+		wantUsed       bool
+		wantConfidence string
+	}{
+		{
+			name:           "go.mod parsed",
+			fake:           &fakeGitHub{repos: map[string]map[string]string{"a/repo": {"go.mod": goModRequiring("v1.0.0")}}},
+			candidate:      fakeCandidate("a/repo", 10),
+			wantUsed:       true,
+			wantConfidence: confidenceHigh,
+		},
+		{
+			name:           "go.mod parsed, not used",
+			fake:           &fakeGitHub{repos: map[string]map[string]string{"a/repo": {"go.mod": "module example.com/app\n"}}},
+			candidate:      fakeCandidate("a/repo", 10),
+			wantConfidence: confidenceHigh,
+		},
+		{
+			name:           "code search unavailable, root go.mod used",
+			fake:           &fakeGitHub{repos: map[string]map[string]string{"a/repo": {"go.mod": goModRequiring("v1.0.0")}}, codeSearchStatus: http.StatusForbidden},
+			candidate:      fakeCandidate("a/repo", 10),
+			wantUsed:       true,
+			wantConfidence: confidenceHigh,
+		},
+		{
+			name:           "code search unavailable, root go.mod not using it",
+			fake:           &fakeGitHub{repos: map[string]map[string]string{"a/repo": {"go.mod": "module example.com/app\n", "tools/go.mod": goModRequiring("v1.0.0")}}, codeSearchStatus: http.StatusForbidden},
+			candidate:      fakeCandidate("a/repo", 10),
+			wantConfidence: confidenceMedium,
+		},
+		{
+			name:           "incomplete results, root go.mod unreadable",
+			fake:           &fakeGitHub{repos: map[string]map[string]string{"a/repo": {"README.md": "no go.mod"}}, incomplete: map[string]bool{"a/repo": true}},
+			candidate:      fakeCandidate("a/repo", 10),
+			wantConfidence: confidenceLow,
+		},
+		{
+			name:           "likely mirror",
+			fake:           &fakeGitHub{repos: map[string]map[string]string{"mirrors/repo": {"go.mod": goModRequiring("v1.0.0")}}},
+			candidate:      fakeCandidate("mirrors/repo", 10),
+			wantConfidence: confidenceLow,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeSearch(t, tt.fake, "github.com/x/lib")
+			results, err := s.searchInRepositories(context.Background(), []candidate{tt.candidate})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := results[tt.candidate.name]
+			if got.used != tt.wantUsed || got.confidence != tt.wantConfidence {
+				t.Errorf("used %v with confidence %q, want %v with %q", got.used, got.confidence, tt.wantUsed, tt.wantConfidence)
+			}
+		})
+	}
+
+	t.Run("dependents", func(t *testing.T) {
+		results, err := dependentsResults(context.Background(), fakeDependents{dependents: []string{"a/listed"}}, "github.com/x/lib")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := results["a/listed"]; !got.used || got.confidence != confidenceMedium {
+			t.Errorf("used %v with confidence %q, want a %q adopter", got.used, got.confidence, confidenceMedium)
+		}
+	})
+}
+
+func TestLegacyConfidence(t *testing.T) {
+	tests := []struct {
+		name   string
+		result repoResult
+		want   string
+	}{
+		{name: "code search", result: repoResult{used: true, source: sourceCodeSearch}, want: confidenceHigh},
+		{name: "low confidence", result: repoResult{source: sourceCodeSearch, lowConfidence: true}, want: confidenceLow},
+		{name: "mirror", result: repoResult{state: stateSkippedMirror}, want: confidenceLow},
+		{name: "dependents", result: repoResult{used: true, source: sourceDependents}, want: confidenceMedium},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := legacyConfidence(tt.result); got != tt.want {
+				t.Errorf("legacyConfidence = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// dependentsSource lists the repositories that depend on a repository.
+type dependentsSource interface {
+	Dependents(ctx context.Context, owner, repo string) ([]string, error)
+}
+
+var (
+	// dependentRepoRe matches a dependent repository link in the dependents page.
+	dependentRepoRe = regexp.MustCompile(`data-hovercard-type="repository"[^>]*href="/([^/"]+/[^/"]+)"`)
+	// dependentsNextRe matches the link to the next dependents page.
+	dependentsNextRe = regexp.MustCompile(`<a[^>]*href="([^"]+)"[^>]*>Next</a>`)
+)
+
+// githubDependents scrapes the "Used by" dependents listing of a repository,
+// which GitHub does not expose through the API.
+type githubDependents struct {
+	client    *http.Client
+	baseURL   string
+	maxPages  int
+	pageDelay time.Duration
+}
+
+func newGithubDependents(maxPages int) *githubDependents {
+	const defaultPageDelay = 2 * time.Second
+
+	return &githubDependents{
+		client:    http.DefaultClient,
+		baseURL:   "https://github.com",
+		maxPages:  maxPages,
+		pageDelay: defaultPageDelay,
+	}
+}
+
+func (d *githubDependents) Dependents(ctx context.Context, owner, repo string) ([]string, error) {
+	var dependents []string
+	seen := make(map[string]bool)
+	self := owner + "/" + repo
+
+	url := fmt.Sprintf("%s/%s/network/dependents?dependent_type=REPOSITORY", d.baseURL, self)
+	for page := 1; url != ""; page++ {
+		if d.maxPages > 0 && page > d.maxPages {
+			logf("Reached the maximum of %d dependents pages\n", d.maxPages)
+			break
+		}
+
+		body, err := d.fetch(ctx, url)
+		if err != nil {
+			return dependents, err
+		}
+
+		names, next := parseDependentsPage(body)
+		for _, name := range names {
+			if name == self || seen[name] {
+				continue
+			}
+			seen[name] = true
+			dependents = append(dependents, name)
+		}
+		logf("Fetched dependents page %d of %s, %d dependents so far\n", page, self, len(dependents))
+
+		url = next
+		if url == "" {
+			break
+		}
+		if err := sleepWithContext(ctx, d.pageDelay); err != nil {
+			return dependents, err
+		}
+	}
+
+	return dependents, nil
+}
+
+func (d *githubDependents) fetch(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status fetching %s: %s", url, resp.Status)
+	}
+
+	bb, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(bb), nil
+}
+
+// parseDependentsPage extracts the dependent repositories and the URL of the
+// next page, which is empty on the last page.
+func parseDependentsPage(body string) ([]string, string) {
+	var names []string
+	for _, m := range dependentRepoRe.FindAllStringSubmatch(body, -1) {
+		names = append(names, m[1])
+	}
+
+	next := ""
+	if m := dependentsNextRe.FindStringSubmatch(body); m != nil {
+		next = html.UnescapeString(m[1])
+	}
+
+	return names, next
+}
+
+// packageRepository returns the GitHub owner and repository hosting the
+// package, if it is hosted on GitHub.
+func packageRepository(packageName string) (string, string, bool) {
+	parts := strings.Split(packageName, "/")
+	if len(parts) < 3 || parts[0] != "github.com" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// dependentsResults turns the dependents of the package into unverified
+// results. Their go.mod files were not checked and their stars are unknown.
+func dependentsResults(ctx context.Context, source dependentsSource, packageName string) (map[string]repoResult, error) {
+	owner, repo, ok := packageRepository(packageName)
+	if !ok {
+		return nil, fmt.Errorf("package %s is not hosted on GitHub", packageName)
+	}
+
+	dependents, err := source.Dependents(ctx, owner, repo)
+	results := make(map[string]repoResult, len(dependents))
+	for _, name := range dependents {
+		results[name] = repoResult{
+			name:       name,
+			used:       true,
+			source:     sourceDependents,
+			confidence: confidenceMedium,
+		}
+	}
+
+	return results, err
+}
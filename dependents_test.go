@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+// rewriteHost sends every request to a test server, so the absolute links of
+// recorded pages lead back to it.
+type rewriteHost struct {
+	target *url.URL
+}
+
+func (rt rewriteHost) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = rt.target.Scheme, rt.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// recordedDependents serves the recorded dependents pages of samber/lo.
+func recordedDependents(t *testing.T, maxPages int) (*githubDependents, *int) {
+	t.Helper()
+	pages := map[string]string{
+		"":                "testdata/dependents-page1.html",
+		"MjQ5NjY5OTc3NTk": "testdata/dependents-page2.html",
+	}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		page, ok := pages[r.URL.Query().Get("dependents_after")]
+		if r.URL.Path != "/samber/lo/network/dependents" || !ok {
+			http.NotFound(w, r)
+			return
+		}
+		body, err := os.ReadFile(page)
+		if err != nil {
+			t.Error(err)
+		}
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+
+	target, _ := url.Parse(server.URL)
+	d := newGithubDependents(maxPages)
+	d.client = &http.Client{Transport: rewriteHost{target: target}}
+	d.pageDelay = 0
+	return d, &requests
+}
+
+func TestGithubDependents(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxPages int
+		want     []string
+		wantReqs int
+	}{
+		{name: "all pages", want: []string{"acme/api", "tools-dev/cli.go", "jdoe/dotfiles"}, wantReqs: 2},
+		{name: "max pages", maxPages: 1, want: []string{"acme/api", "tools-dev/cli.go"}, wantReqs: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, requests := recordedDependents(t, tt.maxPages)
+			dependents, err := d.Dependents(context.Background(), "samber", "lo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(dependents, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("dependents %v, want %v", dependents, tt.want)
+			}
+			if *requests != tt.wantReqs {
+				t.Errorf("%d requests, want %d", *requests, tt.wantReqs)
+			}
+		})
+	}
+}
+
+func TestGithubDependentsError(t *testing.T) {
+	d, _ := recordedDependents(t, 0)
+	if _, err := d.Dependents(context.Background(), "samber", "mo"); err == nil {
+		t.Error("no error for a missing dependents page")
+	}
+}
+
+// fakeDependents is a dependentsSource returning fixed dependents.
+type fakeDependents struct {
+	dependents []string
+	err        error
+}
+
+func (f fakeDependents) Dependents(ctx context.Context, owner, repo string) ([]string, error) {
+	return f.dependents, f.err
+}
+
+func TestDependentsResults(t *testing.T) {
+	tests := []struct {
+		name    string
+		pkg     string
+		source  fakeDependents
+		want    int
+		wantErr bool
+	}{
+		{name: "dependents", pkg: "github.com/samber/lo", source: fakeDependents{dependents: []string{"acme/api", "jdoe/dotfiles"}}, want: 2},
+		{name: "package in a module", pkg: "github.com/samber/lo/parallel", source: fakeDependents{dependents: []string{"acme/api"}}, want: 1},
+		{name: "partial listing", pkg: "github.com/samber/lo", source: fakeDependents{dependents: []string{"acme/api"}, err: errors.New("rate limited")}, want: 1, wantErr: true},
+		{name: "not on GitHub", pkg: "go.uber.org/zap", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := dependentsResults(context.Background(), tt.source, tt.pkg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want one: %v", err, tt.wantErr)
+			}
+			if len(results) != tt.want {
+				t.Errorf("%d results, want %d", len(results), tt.want)
+			}
+			for name, r := range results {
+				if !r.used || r.source != sourceDependents || r.confidence != confidenceMedium {
+					t.Errorf("%s: %+v, want an unverified dependents result", name, r)
+				}
+			}
+		})
+	}
+}
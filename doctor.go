@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/google/go-github/v63/github"
+	"github.com/samber/lo"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Statuses of a doctor check.
+const (
+	checkPass = "pass"
+	checkFail = "fail"
+	checkSkip = "skip"
+)
+
+// checkResult is the outcome of one doctor check. hint tells how to fix a
+// failure.
+type checkResult struct {
+	name   string
+	status string
+	detail string
+	hint   string
+}
+
+// doctorEnv is the state shared by the doctor checks. Checks that depend on
+// an earlier one skip when its state is missing.
+type doctorEnv struct {
+	token       string
+	tokenSource string
+	cacheDir    string
+	client      *github.Client
+	// userResp is the response to the authenticated user request
+	userResp *github.Response
+}
+
+// doctorCheck is a named check, run in the order of doctorChecks.
+type doctorCheck struct {
+	name string
+	run  func(ctx context.Context, env *doctorEnv) checkResult
+}
+
+var doctorChecks = []doctorCheck{
+	{name: "token present", run: checkTokenPresent},
+	{name: "token valid", run: checkTokenValid},
+	{name: "token scopes", run: checkTokenScopes},
+	{name: "search quota", run: checkSearchQuota},
+	{name: "clock skew", run: checkClockSkew},
+	{name: "proxy", run: checkProxy},
+	{name: "cache directory", run: checkCacheDir},
+	{name: "cache files", run: checkCacheFiles},
+}
+
+// maxClockSkew is the skew from GitHub's clock above which the waits until
+// rate limit resets become wrong.
+const maxClockSkew = 30 * time.Second
+
+// runDoctor is the `pkgstats doctor` command. It runs every check, prints
+// the results and fails if a check failed.
+func runDoctor(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	var (
+		token    string
+		cacheDir string
+	)
+	fs.StringVar(&token, "token", "", "GitHub access token, $GITHUB_TOKEN or the gh CLI token by default")
+	fs.StringVar(&cacheDir, "cache-dir", paths.state, "cache directory to check")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	env := &doctorEnv{cacheDir: cacheDir}
+	env.token, env.tokenSource = findToken(token)
+	if env.token != "" {
+		env.client = newClient(ctx, env.token, rateLimits{})
+	}
+
+	failed := 0
+	for _, check := range doctorChecks {
+		result := check.run(ctx, env)
+		result.name = check.name
+		printCheck(os.Stdout, result)
+		if result.status == checkFail {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(doctorChecks))
+	}
+	return nil
+}
+
+func printCheck(w io.Writer, r checkResult) {
+	fmt.Fprintf(w, "[%s] %s: %s\n", r.status, r.name, r.detail)
+	if r.status == checkFail && r.hint != "" {
+		fmt.Fprintf(w, "       hint: %s\n", r.hint)
+	}
+}
+
+func checkTokenPresent(_ context.Context, env *doctorEnv) checkResult {
+	if env.token == "" {
+		return checkResult{status: checkFail, detail: "no token found",
+			hint: "pass -token, set GITHUB_TOKEN or log in with `gh auth login`"}
+	}
+	return checkResult{status: checkPass, detail: "found in " + env.tokenSource}
+}
+
+func checkTokenValid(ctx context.Context, env *doctorEnv) checkResult {
+	if env.client == nil {
+		return checkResult{status: checkSkip, detail: "no token"}
+	}
+	user, resp, err := env.client.Users.Get(ctx, "")
+	if err != nil {
+		return checkResult{status: checkFail, detail: withRequestID(err).Error(),
+			hint: "the token may be expired or revoked, create a new one"}
+	}
+	env.userResp = resp
+	return checkResult{status: checkPass, detail: "authenticated as " + user.GetLogin()}
+}
+
+func checkTokenScopes(_ context.Context, env *doctorEnv) checkResult {
+	if env.userResp == nil {
+		return checkResult{status: checkSkip, detail: "token not validated"}
+	}
+	// only classic tokens report their scopes, any token can read public
+	// repositories
+	scopes, ok := env.userResp.Header["X-Oauth-Scopes"]
+	if !ok {
+		return checkResult{status: checkPass, detail: "fine-grained token, scopes are not reported"}
+	}
+	if len(scopes) == 0 || scopes[0] == "" {
+		return checkResult{status: checkPass, detail: "no scopes, public repositories only"}
+	}
+	return checkResult{status: checkPass, detail: scopes[0]}
+}
+
+func checkSearchQuota(ctx context.Context, env *doctorEnv) checkResult {
+	if env.userResp == nil {
+		return checkResult{status: checkSkip, detail: "token not validated"}
+	}
+	limits, _, err := env.client.RateLimit.Get(ctx)
+	if err != nil {
+		return checkResult{status: checkFail, detail: withRequestID(err).Error()}
+	}
+	for _, rate := range []struct {
+		name string
+		rate *github.Rate
+	}{
+		{name: "search", rate: limits.GetSearch()},
+		{name: "code search", rate: limits.GetCodeSearch()},
+	} {
+		if rate.rate != nil && rate.rate.Remaining == 0 {
+			return checkResult{status: checkFail, detail: rate.name + " quota exhausted",
+				hint: "wait until " + rate.rate.Reset.Format(time.TimeOnly) + " or use another token"}
+		}
+	}
+	return checkResult{status: checkPass, detail: fmt.Sprintf("search %d, code search %d remaining",
+		limits.GetSearch().Remaining, limits.GetCodeSearch().Remaining)}
+}
+
+func checkClockSkew(_ context.Context, env *doctorEnv) checkResult {
+	if env.userResp == nil {
+		return checkResult{status: checkSkip, detail: "no response from GitHub"}
+	}
+	date, err := http.ParseTime(env.userResp.Header.Get("Date"))
+	if err != nil {
+		return checkResult{status: checkSkip, detail: "no Date header"}
+	}
+	// the Date header has a one second resolution
+	skew := time.Since(date).Round(time.Second)
+	if skew > maxClockSkew || skew < -maxClockSkew {
+		return checkResult{status: checkFail, detail: fmt.Sprintf("local clock is %s off GitHub's", skew),
+			hint: "sync the system clock with NTP, rate limit waits depend on it"}
+	}
+	return checkResult{status: checkPass, detail: skew.String()}
+}
+
+func checkProxy(_ context.Context, _ *doctorEnv) checkResult {
+	req, _ := http.NewRequest(http.MethodGet, "https://api.github.com", nil)
+	proxy, err := http.ProxyFromEnvironment(req)
+	if err != nil {
+		return checkResult{status: checkFail, detail: err.Error(), hint: "fix the HTTPS_PROXY environment variable"}
+	}
+	if proxy == nil {
+		return checkResult{status: checkPass, detail: "no proxy configured"}
+	}
+	host := proxy.Host
+	if proxy.Port() == "" {
+		host = net.JoinHostPort(proxy.Hostname(), "80")
+	}
+	conn, err := net.DialTimeout("tcp", host, 5*time.Second)
+	if err != nil {
+		return checkResult{status: checkFail, detail: fmt.Sprintf("proxy %s unreachable: %v", proxy.Host, err),
+			hint: "check HTTPS_PROXY and NO_PROXY"}
+	}
+	conn.Close()
+	return checkResult{status: checkPass, detail: "proxy " + proxy.Host + " reachable"}
+}
+
+func checkCacheDir(_ context.Context, env *doctorEnv) checkResult {
+	info, err := os.Stat(env.cacheDir)
+	if os.IsNotExist(err) {
+		return checkResult{status: checkPass, detail: env.cacheDir + " does not exist yet, it is created on the first run"}
+	}
+	if err != nil {
+		return checkResult{status: checkFail, detail: err.Error()}
+	}
+	if !info.IsDir() {
+		return checkResult{status: checkFail, detail: env.cacheDir + " is not a directory", hint: "move the file away"}
+	}
+	if err := checkWritable(env.cacheDir); err != nil {
+		return checkResult{status: checkFail, detail: err.Error(),
+			hint: "fix the permissions or use -read-only-cache"}
+	}
+	return checkResult{status: checkPass, detail: env.cacheDir + " is writable"}
+}
+
+func checkCacheFiles(_ context.Context, env *doctorEnv) checkResult {
+	files, err := filepath.Glob(filepath.Join(env.cacheDir, "*.csv"))
+	if err != nil {
+		return checkResult{status: checkFail, detail: err.Error()}
+	}
+	compressed, _ := filepath.Glob(filepath.Join(env.cacheDir, "*.csv.gz"))
+	files = append(files, compressed...)
+	files = lo.Reject(files, func(fileName string, _ int) bool { return isHistoryFile(fileName) })
+	if len(files) == 0 {
+		return checkResult{status: checkSkip, detail: "no cache files"}
+	}
+
+	var broken []string
+	for _, fileName := range files {
+		file, err := os.Open(fileName)
+		if err != nil {
+			broken = append(broken, fileName)
+			continue
+		}
+		issues, _ := validateCache(file)
+		file.Close()
+		if len(issues) > 0 {
+			broken = append(broken, fileName)
+		}
+	}
+	if len(broken) > 0 {
+		return checkResult{status: checkFail, detail: fmt.Sprintf("%d of %d files have issues: %v", len(broken), len(files), broken),
+			hint: "run `pkgstats cache verify -cache-file <file>` to see them and -repair to repair"}
+	}
+	return checkResult{status: checkPass, detail: fmt.Sprintf("%d files parse", len(files))}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/go-github/v63/github"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckCacheFiles(t *testing.T) {
+	results := []repoResult{{name: "a/b", used: true, stars: 10, version: "v1.0.0"}}
+	transitions := []transition{{at: time.Now().UTC(), repo: "a/b", toUsed: true, toVersion: "v1.0.0"}}
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, dir string)
+		want  string
+	}{
+		{name: "empty", setup: func(*testing.T, string) {}, want: checkSkip},
+		{
+			name: "cache and history",
+			setup: func(t *testing.T, dir string) {
+				for _, fileName := range []string{"a.csv", "b.csv.gz"} {
+					fileName = filepath.Join(dir, fileName)
+					if err := replaceCache(fileName, results); err != nil {
+						t.Fatal(err)
+					}
+					if err := appendHistory(historyFile(fileName), transitions, 0); err != nil {
+						t.Fatal(err)
+					}
+				}
+			},
+			want: checkPass,
+		},
+		{
+			name: "broken cache",
+			setup: func(t *testing.T, dir string) {
+				if err := os.WriteFile(filepath.Join(dir, "a.csv"), []byte("a/b,maybe\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: checkFail,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tt.setup(t, dir)
+			got := checkCacheFiles(context.Background(), &doctorEnv{cacheDir: dir})
+			if got.status != tt.want {
+				t.Errorf("got %s (%s), want %s", got.status, got.detail, tt.want)
+			}
+		})
+	}
+}
+
+// doctorGitHub serves the user and rate limit requests of the doctor checks.
+func doctorGitHub(t *testing.T, status int, header http.Header, searchRemaining int) *github.Client {
+	return newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for name, values := range header {
+			w.Header()[name] = values
+		}
+		switch r.URL.Path {
+		case "/user":
+			w.WriteHeader(status)
+			fmt.Fprint(w, `{"login": "octocat", "message": "Bad credentials"}`)
+		case "/rate_limit":
+			fmt.Fprintf(w, `{"resources": {"search": {"limit": 30, "remaining": %d}, "code_search": {"limit": 10, "remaining": 10}}}`, searchRemaining)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+// userResponse returns a response to the authenticated user request with the
+// header.
+func userResponse(header http.Header) *github.Response {
+	return &github.Response{Response: &http.Response{StatusCode: http.StatusOK, Header: header}}
+}
+
+func TestCheckTokenPresent(t *testing.T) {
+	if got := checkTokenPresent(context.Background(), &doctorEnv{}); got.status != checkFail || got.hint == "" {
+		t.Errorf("no token: %+v, want a failure with a hint", got)
+	}
+	if got := checkTokenPresent(context.Background(), &doctorEnv{token: "t", tokenSource: "GITHUB_TOKEN"}); got.status != checkPass {
+		t.Errorf("token: %+v, want a pass", got)
+	}
+}
+
+func TestCheckTokenValid(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		noAuth bool
+		want   string
+	}{
+		{name: "valid", status: http.StatusOK, want: checkPass},
+		{name: "revoked", status: http.StatusUnauthorized, want: checkFail},
+		{name: "no token", noAuth: true, want: checkSkip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := &doctorEnv{}
+			if !tt.noAuth {
+				env.client = doctorGitHub(t, tt.status, nil, 30)
+			}
+			got := checkTokenValid(context.Background(), env)
+			if got.status != tt.want {
+				t.Errorf("got %s (%s), want %s", got.status, got.detail, tt.want)
+			}
+			// the later checks go on from the response of a valid token
+			if (env.userResp != nil) != (tt.want == checkPass) {
+				t.Errorf("user response kept: %v", env.userResp != nil)
+			}
+		})
+	}
+}
+
+func TestCheckTokenScopes(t *testing.T) {
+	tests := []struct {
+		name       string
+		userResp   *github.Response
+		want       string
+		wantDetail string
+	}{
+		{name: "classic", userResp: userResponse(http.Header{"X-Oauth-Scopes": {"repo, read:org"}}), want: checkPass, wantDetail: "repo, read:org"},
+		{name: "no scopes", userResp: userResponse(http.Header{"X-Oauth-Scopes": {""}}), want: checkPass, wantDetail: "no scopes, public repositories only"},
+		{name: "fine-grained", userResp: userResponse(http.Header{}), want: checkPass, wantDetail: "fine-grained token, scopes are not reported"},
+		{name: "not validated", want: checkSkip, wantDetail: "token not validated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := checkTokenScopes(context.Background(), &doctorEnv{userResp: tt.userResp})
+			if got.status != tt.want || got.detail != tt.wantDetail {
+				t.Errorf("got %s (%s), want %s (%s)", got.status, got.detail, tt.want, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestCheckSearchQuota(t *testing.T) {
+	tests := []struct {
+		name      string
+		remaining int
+		validated bool
+		want      string
+	}{
+		{name: "quota left", remaining: 25, validated: true, want: checkPass},
+		{name: "exhausted", remaining: 0, validated: true, want: checkFail},
+		{name: "not validated", remaining: 25, want: checkSkip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := &doctorEnv{client: doctorGitHub(t, http.StatusOK, nil, tt.remaining)}
+			if tt.validated {
+				env.userResp = userResponse(http.Header{})
+			}
+			got := checkSearchQuota(context.Background(), env)
+			if got.status != tt.want {
+				t.Errorf("got %s (%s), want %s", got.status, got.detail, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckClockSkew(t *testing.T) {
+	tests := []struct {
+		name string
+		date string
+		want string
+	}{
+		{name: "in sync", date: time.Now().UTC().Format(http.TimeFormat), want: checkPass},
+		{name: "behind", date: time.Now().Add(-2 * time.Minute).UTC().Format(http.TimeFormat), want: checkFail},
+		{name: "ahead", date: time.Now().Add(2 * time.Minute).UTC().Format(http.TimeFormat), want: checkFail},
+		{name: "no date", want: checkSkip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.date != "" {
+				header.Set("Date", tt.date)
+			}
+			got := checkClockSkew(context.Background(), &doctorEnv{userResp: userResponse(header)})
+			if got.status != tt.want {
+				t.Errorf("got %s (%s), want %s", got.status, got.detail, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckCacheDir(t *testing.T) {
+	base := t.TempDir()
+	file := filepath.Join(base, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		dir  string
+		want string
+	}{
+		{name: "writable", dir: base, want: checkPass},
+		{name: "not created yet", dir: filepath.Join(base, "missing"), want: checkPass},
+		{name: "a file", dir: file, want: checkFail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := checkCacheDir(context.Background(), &doctorEnv{cacheDir: tt.dir})
+			if got.status != tt.want {
+				t.Errorf("got %s (%s), want %s", got.status, got.detail, tt.want)
+			}
+		})
+	}
+}
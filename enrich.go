@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/samber/lo"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// enrichBatchSize is the number of repositories fetched per GraphQL
+	// query
+	enrichBatchSize = 50
+	// enrichInterval is the time before a row enriched without getting any
+	// stars, or found missing, is tried again
+	enrichInterval = 7 * 24 * time.Hour
+)
+
+// gqlRepository is the repository metadata fetched by the enrichment query.
+type gqlRepository struct {
+	StargazerCount int       `json:"stargazerCount"`
+	ForkCount      int       `json:"forkCount"`
+	DiskUsage      int       `json:"diskUsage"`
+	IsArchived     bool      `json:"isArchived"`
+	PushedAt       time.Time `json:"pushedAt"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+type gqlResponse struct {
+	Data   map[string]*gqlRepository `json:"data"`
+	Errors []struct {
+		Type    string `json:"type"`
+		Path    []any  `json:"path"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// needsEnrichment reports whether a result lacks the repository metadata,
+// e.g. because it comes from the dependents graph, and wasn't enriched
+// recently.
+func needsEnrichment(r repoResult) bool {
+	return r.stars <= 0 && time.Since(r.enrichedAt) > enrichInterval
+}
+
+// Enrich fills in the stars, archived flag and the other repository metadata
+// of the results that need it, fetching them by batches of enrichBatchSize
+// with the GraphQL API. Repositories that don't exist anymore are marked
+// with stateNotFound. It returns the updated results.
+func (s *searchResult) Enrich(ctx context.Context, results map[string]repoResult) (map[string]repoResult, error) {
+	var names []string
+	for name, r := range results {
+		if needsEnrichment(r) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	logf("enriching %d repositories without stars\n", len(names))
+
+	enriched := make(map[string]repoResult)
+	for _, batch := range lo.Chunk(names, enrichBatchSize) {
+		repos, err := s.fetchRepositories(ctx, batch)
+		if err != nil {
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return enriched, nil
+			}
+			return enriched, err
+		}
+
+		now := time.Now().UTC()
+		for _, name := range batch {
+			result := results[name]
+			repo, ok := repos[name]
+			switch {
+			case !ok:
+				// an error other than not found, try again on the next run
+				continue
+			case repo == nil:
+				logf("repository %s not found, flagging it\n", name)
+				result.state = stateNotFound
+			default:
+				result.stars = repo.StargazerCount
+				result.forks = repo.ForkCount
+				result.sizeKB = repo.DiskUsage
+				result.archived = repo.IsArchived
+				result.pushedAt = repo.PushedAt
+				result.createdAt = repo.CreatedAt
+				if result.state == stateNotFound {
+					result.state = ""
+				}
+				logf("repository %s has %d stars\n", name, repo.StargazerCount)
+			}
+			result.enrichedAt = now
+			enriched[name] = result
+			s.progress.touch()
+		}
+	}
+
+	logf("enriched %d repositories\n", len(enriched))
+	return enriched, nil
+}
+
+// fetchRepositories fetches the metadata of owner/repo names with a single
+// GraphQL query. Repositories that don't exist map to nil, the ones that
+// failed otherwise are missing.
+func (s *searchResult) fetchRepositories(ctx context.Context, names []string) (map[string]*gqlRepository, error) {
+	var query strings.Builder
+	query.WriteString("query {")
+	aliases := make(map[string]string)
+	for i, name := range names {
+		owner, repo, ok := strings.Cut(name, "/")
+		if !ok {
+			logf("Skipping repository: %s is not an owner/repo name\n", name)
+			continue
+		}
+		alias := "r" + strconv.Itoa(i)
+		aliases[alias] = name
+		fmt.Fprintf(&query, " %s: repository(owner: %s, name: %s) { stargazerCount forkCount diskUsage isArchived pushedAt createdAt }",
+			alias, strconv.Quote(owner), strconv.Quote(repo))
+	}
+	query.WriteString(" }")
+	if len(aliases) == 0 {
+		return nil, nil
+	}
+
+	req, err := s.client.NewRequest("POST", "graphql", map[string]string{"query": query.String()})
+	if err != nil {
+		return nil, fmt.Errorf("error creating the GraphQL request: %v", err)
+	}
+	var resp gqlResponse
+	if _, err := s.client.Do(ctx, req, &resp); err != nil {
+		return nil, fmt.Errorf("error fetching repository metadata: %v", withRequestID(err))
+	}
+
+	notFound := make(map[string]bool)
+	for _, e := range resp.Errors {
+		if len(e.Path) == 0 {
+			logf("GraphQL error: %s\n", e.Message)
+			continue
+		}
+		alias, _ := e.Path[0].(string)
+		if e.Type == "NOT_FOUND" {
+			notFound[alias] = true
+		} else {
+			logf("error fetching repository %s: %s\n", aliases[alias], e.Message)
+		}
+	}
+
+	repos := make(map[string]*gqlRepository)
+	for alias, name := range aliases {
+		if repo := resp.Data[alias]; repo != nil {
+			repos[name] = repo
+		} else if notFound[alias] {
+			repos[name] = nil
+		}
+	}
+	return repos, nil
+}
+
+// runEnrich is the `pkgstats enrich` command: it enriches the cache of a
+// package without searching.
+func runEnrich(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("enrich", flag.ContinueOnError)
+	var (
+		token     string
+		pkg       string
+		fileName  string
+		reqBudget int
+	)
+	fs.StringVar(&token, "token", "", "GitHub access token, $GITHUB_TOKEN or the gh CLI token by default")
+	fs.StringVar(&pkg, "pkg", "", "package whose cache to enrich")
+	fs.StringVar(&fileName, "cache-file", "", "cache file to enrich instead of the one of -pkg")
+	fs.IntVar(&reqBudget, "request-budget", 0, "maximum number of GitHub requests, the rows left are enriched by the next run, 0 for no limit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fileName == "" && pkg == "" {
+		return fmt.Errorf("enrich requires -pkg or -cache-file")
+	}
+	if fileName == "" {
+		fileName = defaultCacheFile(pkg)
+	}
+	if reqBudget < 0 {
+		return fmt.Errorf("invalid value for request-budget: %d", reqBudget)
+	}
+	token, _ = findToken(token)
+	if token == "" {
+		return fmt.Errorf("no GitHub token found, pass -token, set GITHUB_TOKEN or log in with `gh auth login`")
+	}
+
+	results, err := readCacheFile(fileName)
+	if err != nil {
+		return err
+	}
+	// the results of a run with -cache-log may still be in its log
+	if _, _, err := replayLog(cacheLogFile(fileName), results); err != nil {
+		return err
+	}
+	var budget *requestBudget
+	if reqBudget > 0 {
+		budget = newRequestBudget(reqBudget)
+	}
+	// the rows are enriched in name order and the enriched ones don't need
+	// it anymore, so a run stopped by the budget is resumed by the next one
+	enrichCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	budget.stopWith(cancel)
+	s := newSearchResult(pkg, newClient(ctx, token, rateLimits{budget: budget}), results)
+	enriched, enrichErr := s.Enrich(enrichCtx, results)
+	for name, r := range enriched {
+		results[name] = r
+	}
+	budget.print()
+	if left := len(lo.PickBy(results, func(_ string, r repoResult) bool { return needsEnrichment(r) })); left > 0 && errors.Is(context.Cause(enrichCtx), errBudgetSpent) {
+		logf("%d rows left to enrich, run enrich again to go on\n", left)
+	}
+	sorted := lo.Values(results)
+	sortResults(sorted, "name")
+	if err := (&logStore{fileName: fileName}).compact(sorted); err != nil {
+		return err
+	}
+	if enrichErr != nil {
+		return fmt.Errorf("error enriching %s, saved %d enriched rows: %v", fileName, len(enriched), enrichErr)
+	}
+	logf("%s: enriched %d rows\n", fileName, len(enriched))
+	return nil
+}
+
+// readCacheFile reads the results of a cache file.
+func readCacheFile(fileName string) (map[string]repoResult, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error opening the cache: %v", err)
+	}
+	defer file.Close()
+
+	results, err := readResults(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the cache: %v", err)
+	}
+	return results, nil
+}
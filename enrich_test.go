@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeGraphQL answers the repository queries of the enrichment with the
+// stars of the repositories, the ones missing are not found.
+type fakeGraphQL struct {
+	stars map[string]int
+
+	mu      sync.Mutex
+	queries int
+}
+
+var repositoryQuery = regexp.MustCompile(`(r\d+): repository\(owner: "([^"]*)", name: "([^"]*)"\)`)
+
+func (f *fakeGraphQL) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/graphql" {
+		http.NotFound(w, r)
+		return
+	}
+	f.mu.Lock()
+	f.queries++
+	f.mu.Unlock()
+
+	var body struct {
+		Query string `json:"query"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data := map[string]any{}
+	errs := []map[string]any{}
+	for _, m := range repositoryQuery.FindAllStringSubmatch(body.Query, -1) {
+		alias, name := m[1], m[2]+"/"+m[3]
+		stars, ok := f.stars[name]
+		if !ok {
+			data[alias] = nil
+			errs = append(errs, map[string]any{"type": "NOT_FOUND", "path": []string{alias}, "message": fmt.Sprintf("Could not resolve to a Repository with the name '%s'.", name)})
+			continue
+		}
+		data[alias] = map[string]any{"stargazerCount": stars, "forkCount": 1, "diskUsage": 100, "isArchived": false, "pushedAt": "2024-01-01T00:00:00Z", "createdAt": "2020-01-01T00:00:00Z"}
+	}
+	json.NewEncoder(w).Encode(map[string]any{"data": data, "errors": errs})
+}
+
+func TestEnrich(t *testing.T) {
+	f := &fakeGraphQL{stars: map[string]int{"a/imported": 42, "a/ranked": 7, "a/recent": 3}}
+	s := newSearchResult("github.com/x/lib", newTestClient(t, f), nil)
+	results := map[string]repoResult{
+		"a/imported": {name: "a/imported", used: true},
+		"a/gone":     {name: "a/gone", used: true},
+		"a/ranked":   {name: "a/ranked", used: true, stars: 5},
+		// enriched without getting any stars a moment ago
+		"a/recent": {name: "a/recent", used: true, enrichedAt: time.Now()},
+	}
+
+	enriched, err := s.Enrich(context.Background(), results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(enriched) != 2 {
+		t.Errorf("enriched %v, want a/imported and a/gone only", enriched)
+	}
+	if got := enriched["a/imported"]; got.stars != 42 || got.forks != 1 || got.enrichedAt.IsZero() {
+		t.Errorf("a/imported enriched as %+v, want 42 stars", got)
+	}
+	if got := enriched["a/gone"]; got.state != stateNotFound || got.enrichedAt.IsZero() {
+		t.Errorf("a/gone enriched in state %q, want %q", got.state, stateNotFound)
+	}
+	if f.queries != 1 {
+		t.Errorf("%d GraphQL queries, want 1", f.queries)
+	}
+}
+
+func TestEnrichResumes(t *testing.T) {
+	f := &fakeGraphQL{stars: map[string]int{}}
+	results := make(map[string]repoResult)
+	for i := 0; i < 2*enrichBatchSize+20; i++ {
+		name := fmt.Sprintf("a/repo%03d", i)
+		f.stars[name] = i + 1
+		results[name] = repoResult{name: name, used: true}
+	}
+	base := newTestClient(t, f)
+
+	// every run can only afford one query, the next one goes on where it
+	// stopped
+	for _, wantLeft := range []int{enrichBatchSize + 20, 20, 0} {
+		budget := newRequestBudget(1)
+		ctx, cancel := context.WithCancelCause(context.Background())
+		budget.stopWith(cancel)
+		s := newSearchResult("github.com/x/lib", budgetClient(base, budget), results)
+		enriched, err := s.Enrich(ctx, results)
+		cancel(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, r := range enriched {
+			results[name] = r
+		}
+
+		left := 0
+		for _, r := range results {
+			if needsEnrichment(r) {
+				left++
+			}
+		}
+		if left != wantLeft {
+			t.Fatalf("%d rows left to enrich, want %d", left, wantLeft)
+		}
+	}
+	for name, r := range results {
+		if r.stars != f.stars[name] {
+			t.Errorf("%s enriched with %d stars, want %d", name, r.stars, f.stars[name])
+		}
+	}
+	if f.queries != 3 {
+		t.Errorf("%d GraphQL queries, want 3", f.queries)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/go-github/v63/github"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// requestIDHeader carries the ID GitHub support asks for when escalating a
+// failing request.
+const requestIDHeader = "X-GitHub-Request-Id"
+
+// requestID returns the GitHub request ID of a failed API call, if any.
+func requestID(err error) string {
+	var resp *http.Response
+
+	var errResp *github.ErrorResponse
+	var rateErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	switch {
+	case errors.As(err, &errResp):
+		resp = errResp.Response
+	case errors.As(err, &rateErr):
+		resp = rateErr.Response
+	case errors.As(err, &abuseErr):
+		resp = abuseErr.Response
+	}
+
+	if resp == nil {
+		return ""
+	}
+	return resp.Header.Get(requestIDHeader)
+}
+
+// withRequestID adds the GitHub request ID to the error message, keeping the
+// original error available to errors.Is and errors.As.
+func withRequestID(err error) error {
+	id := requestID(err)
+	if id == "" {
+		return err
+	}
+	return fmt.Errorf("%w (request id: %s)", err, id)
+}
+
+// statusError is an unexpected HTTP status from a service other than the
+// GitHub API, e.g. the pushgateway.
+type statusError struct {
+	service    string
+	statusCode int
+	status     string
+	message    string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status from %s: %s: %s", e.service, e.status, e.message)
+}
+
+// retryableStatus reports whether an HTTP status is worth retrying: rate
+// limited or a server error.
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// isRetryable reports whether a failed request may succeed when retried:
+// rate limits, abuse detection, server errors, timeouts and connections
+// closed or refused. Client errors like 401, 403, 404 and 422 are permanent,
+// and so are canceled requests and unknown errors.
+func isRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var (
+		rateErr   *github.RateLimitError
+		abuseErr  *github.AbuseRateLimitError
+		errResp   *github.ErrorResponse
+		statusErr *statusError
+		netErr    net.Error
+	)
+	switch {
+	case errors.As(err, &rateErr), errors.As(err, &abuseErr):
+		return true
+	case errors.As(err, &errResp):
+		return errResp.Response != nil && retryableStatus(errResp.Response.StatusCode)
+	case errors.As(err, &statusErr):
+		return retryableStatus(statusErr.statusCode)
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return true
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.EPIPE):
+		return true
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/go-github/v63/github"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// githubError returns the error go-github returns for a response with the
+// status code.
+func githubError(code int) error {
+	resp := &http.Response{StatusCode: code, Header: http.Header{}}
+	resp.Header.Set(requestIDHeader, "ABCD:1234")
+	return &github.ErrorResponse{Response: resp, Message: http.StatusText(code)}
+}
+
+// timeoutError is a net.Error that timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "rate limit", err: &github.RateLimitError{Message: "API rate limit exceeded"}, want: true},
+		{name: "abuse", err: &github.AbuseRateLimitError{Message: "secondary rate limit"}, want: true},
+		{name: "500", err: githubError(http.StatusInternalServerError), want: true},
+		{name: "502", err: githubError(http.StatusBadGateway), want: true},
+		{name: "429", err: githubError(http.StatusTooManyRequests), want: true},
+		{name: "401", err: githubError(http.StatusUnauthorized), want: false},
+		{name: "403", err: githubError(http.StatusForbidden), want: false},
+		{name: "404", err: githubError(http.StatusNotFound), want: false},
+		{name: "422", err: githubError(http.StatusUnprocessableEntity), want: false},
+		{name: "no response", err: &github.ErrorResponse{}, want: false},
+		{name: "wrapped 503", err: fmt.Errorf("error listing repositories: %w", githubError(http.StatusServiceUnavailable)), want: true},
+		{name: "with request id", err: withRequestID(githubError(http.StatusBadGateway)), want: true},
+		{name: "service 503", err: &statusError{service: "Slack", statusCode: http.StatusServiceUnavailable}, want: true},
+		{name: "service 400", err: &statusError{service: "Slack", statusCode: http.StatusBadRequest}, want: false},
+		{name: "deadline", err: context.DeadlineExceeded, want: true},
+		{name: "canceled", err: context.Canceled, want: false},
+		{name: "wrapped canceled", err: fmt.Errorf("error fetching go.mod: %w", context.Canceled), want: false},
+		{name: "net timeout", err: &net.OpError{Op: "read", Err: timeoutError{}}, want: true},
+		{name: "EOF", err: io.EOF, want: true},
+		{name: "unexpected EOF", err: fmt.Errorf("error reading body: %w", io.ErrUnexpectedEOF), want: true},
+		{name: "connection reset", err: &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, want: true},
+		{name: "connection refused", err: &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, want: true},
+		{name: "broken pipe", err: syscall.EPIPE, want: true},
+		{name: "unknown", err: errors.New("invalid go.mod"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err); got != tt.want {
+				t.Errorf("isRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithRequestID(t *testing.T) {
+	err := withRequestID(githubError(http.StatusNotFound))
+	if got, want := err.Error(), "(request id: ABCD:1234)"; !strings.HasSuffix(got, want) {
+		t.Errorf("error %q, want it to end with %q", got, want)
+	}
+	var errResp *github.ErrorResponse
+	if !errors.As(err, &errResp) {
+		t.Error("the GitHub error is lost")
+	}
+
+	plain := errors.New("invalid go.mod")
+	if withRequestID(plain) != plain {
+		t.Error("an error without a request id is changed")
+	}
+}
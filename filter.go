@@ -0,0 +1,433 @@
+package main
+
+import (
+	"fmt"
+	"github.com/samber/lo"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A filter expression selects results by their output fields, e.g.
+//
+//	used && stars > 5000 && version startsWith "v1."
+//
+// Comparisons are ==, !=, <, <=, >, >=, and for strings startsWith,
+// endsWith and contains. They combine with &&, || and !, and parentheses.
+// A bool field can be used on its own. Operands are field names, numbers,
+// quoted strings, true and false.
+//
+// An optional number or bool field left empty for a result, e.g. vendored
+// when it wasn't checked, is unknown: a comparison or bool operand using it
+// is unknown too, and so is its negation. Unknown selects nothing, so
+// neither test_only nor !test_only selects the unchecked adopters.
+
+// filterFunc reports whether a result is selected.
+type filterFunc func(r repoResult) bool
+
+// filterTruth is the value of an expression for a result, true, false or
+// unknown.
+type filterTruth int8
+
+const (
+	filterFalse filterTruth = iota
+	filterTrue
+	filterUnknown
+)
+
+// filterExpr evaluates an expression, or a part of it, for a result.
+type filterExpr func(r repoResult) filterTruth
+
+func truthOf(b bool) filterTruth {
+	if b {
+		return filterTrue
+	}
+	return filterFalse
+}
+
+// filterError is a syntax or type error in a filter expression, at a byte
+// position.
+type filterError struct {
+	expr string
+	pos  int
+	msg  string
+}
+
+func (e *filterError) Error() string {
+	return fmt.Sprintf("filter position %d: %s\n  %s\n  %s^", e.pos+1, e.msg, e.expr, strings.Repeat(" ", e.pos))
+}
+
+type filterToken struct {
+	kind string // "ident", "number", "string", "op" or "eof"
+	text string
+	pos  int
+}
+
+// filterOps are the operators, longest first so "<=" isn't read as "<".
+var filterOps = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")"}
+
+func lexFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	for i := 0; i < len(expr); {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexRune(expr[i+1:], c)
+			if end < 0 {
+				return nil, &filterError{expr: expr, pos: i, msg: "unterminated string"}
+			}
+			tokens = append(tokens, filterToken{kind: "string", text: expr[i+1 : i+1+end], pos: i})
+			i += end + 2
+		case unicode.IsDigit(c) || c == '-' || c == '.':
+			start := i
+			for i++; i < len(expr) && (unicode.IsDigit(rune(expr[i])) || expr[i] == '.'); i++ {
+			}
+			tokens = append(tokens, filterToken{kind: "number", text: expr[start:i], pos: start})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i++; i < len(expr) && (unicode.IsLetter(rune(expr[i])) || unicode.IsDigit(rune(expr[i])) || expr[i] == '_'); i++ {
+			}
+			tokens = append(tokens, filterToken{kind: "ident", text: expr[start:i], pos: start})
+		default:
+			op := ""
+			for _, o := range filterOps {
+				if strings.HasPrefix(expr[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, &filterError{expr: expr, pos: i, msg: fmt.Sprintf("unexpected character %q", c)}
+			}
+			tokens = append(tokens, filterToken{kind: "op", text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, filterToken{kind: "eof", pos: len(expr)}), nil
+}
+
+// filterOperand is a field or a literal, typed as "number", "string" or
+// "bool". The value is nil when the field is unknown for the result.
+type filterOperand struct {
+	typ   string
+	value func(r repoResult) any
+}
+
+type filterParser struct {
+	expr   string
+	tokens []filterToken
+	pos    int
+}
+
+// parseFilter compiles a filter expression. Errors point at the offending
+// position.
+func parseFilter(expr string) (filterFunc, error) {
+	tokens, err := lexFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{expr: expr, tokens: tokens}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != "eof" {
+		return nil, p.errorf(tok, "unexpected %q", tok.text)
+	}
+	return func(r repoResult) bool { return f(r) == filterTrue }, nil
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != "eof" {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *filterParser) errorf(tok filterToken, format string, a ...any) error {
+	return &filterError{expr: p.expr, pos: tok.pos, msg: fmt.Sprintf(format, a...)}
+}
+
+func (p *filterParser) parseOr() (filterExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().text == "||" && p.peek().kind == "op" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(r repoResult) filterTruth {
+			a, b := l(r), right(r)
+			switch {
+			case a == filterTrue || b == filterTrue:
+				return filterTrue
+			case a == filterFalse && b == filterFalse:
+				return filterFalse
+			}
+			return filterUnknown
+		}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().text == "&&" && p.peek().kind == "op" {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(r repoResult) filterTruth {
+			a, b := l(r), right(r)
+			switch {
+			case a == filterFalse || b == filterFalse:
+				return filterFalse
+			case a == filterTrue && b == filterTrue:
+				return filterTrue
+			}
+			return filterUnknown
+		}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterExpr, error) {
+	tok := p.peek()
+	if tok.kind == "op" && tok.text == "!" {
+		p.next()
+		f, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(r repoResult) filterTruth {
+			switch f(r) {
+			case filterTrue:
+				return filterFalse
+			case filterFalse:
+				return filterTrue
+			}
+			return filterUnknown
+		}, nil
+	}
+	if tok.kind == "op" && tok.text == "(" {
+		p.next()
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.text != ")" {
+			return nil, p.errorf(closing, "expected )")
+		}
+		return f, nil
+	}
+	return p.parseComparison()
+}
+
+// filterComparisons are the comparison operators and the operand types they
+// accept.
+var filterComparisons = map[string][]string{
+	"==":         {"number", "string", "bool"},
+	"!=":         {"number", "string", "bool"},
+	"<":          {"number", "string"},
+	"<=":         {"number", "string"},
+	">":          {"number", "string"},
+	">=":         {"number", "string"},
+	"startsWith": {"string"},
+	"endsWith":   {"string"},
+	"contains":   {"string"},
+}
+
+func (p *filterParser) parseComparison() (filterExpr, error) {
+	leftTok := p.peek()
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	opTok := p.peek()
+	types, ok := filterComparisons[opTok.text]
+	if !ok || (opTok.kind != "op" && opTok.kind != "ident") {
+		// a bool operand on its own
+		if left.typ != "bool" {
+			return nil, p.errorf(opTok, "expected a comparison operator after %s", leftTok.text)
+		}
+		return func(r repoResult) filterTruth {
+			v := left.value(r)
+			if v == nil {
+				return filterUnknown
+			}
+			return truthOf(v == true)
+		}, nil
+	}
+	p.next()
+
+	rightTok := p.peek()
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if left.typ != right.typ {
+		return nil, p.errorf(rightTok, "can't compare %s with %s", left.typ, right.typ)
+	}
+	if !lo.Contains(types, left.typ) {
+		return nil, p.errorf(opTok, "%s does not apply to %s values", opTok.text, left.typ)
+	}
+
+	op := opTok.text
+	return func(r repoResult) filterTruth {
+		a, b := left.value(r), right.value(r)
+		if a == nil || b == nil {
+			return filterUnknown
+		}
+		return truthOf(compareFilterValues(op, a, b))
+	}, nil
+}
+
+func (p *filterParser) parseOperand() (filterOperand, error) {
+	tok := p.next()
+	switch tok.kind {
+	case "number":
+		n, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return filterOperand{}, p.errorf(tok, "invalid number %q", tok.text)
+		}
+		return filterOperand{typ: "number", value: func(repoResult) any { return n }}, nil
+	case "string":
+		return filterOperand{typ: "string", value: func(repoResult) any { return tok.text }}, nil
+	case "ident":
+		if tok.text == "true" || tok.text == "false" {
+			b := tok.text == "true"
+			return filterOperand{typ: "bool", value: func(repoResult) any { return b }}, nil
+		}
+		for _, f := range knownFields {
+			if f.name == tok.text {
+				return fieldOperand(f), nil
+			}
+		}
+		return filterOperand{}, p.errorf(tok, "unknown field %q, known: %s", tok.text, strings.Join(knownFieldNames(), ", "))
+	case "eof":
+		return filterOperand{}, p.errorf(tok, "unexpected end of the expression")
+	}
+	return filterOperand{}, p.errorf(tok, "unexpected %q", tok.text)
+}
+
+// fieldOperand turns an output field into an operand, ints and floats are
+// compared as numbers and times as RFC 3339 strings. Optional number and
+// bool fields are unknown when empty.
+func fieldOperand(f field) filterOperand {
+	switch f.kind {
+	case "int", "float":
+		return filterOperand{typ: "number", value: func(r repoResult) any {
+			v := f.value(r)
+			if v == "" {
+				return nil
+			}
+			return toFloat(v)
+		}}
+	case "bool":
+		return filterOperand{typ: "bool", value: func(r repoResult) any {
+			v := f.value(r)
+			if v == "" {
+				return nil
+			}
+			return v
+		}}
+	}
+	return filterOperand{typ: "string", value: func(r repoResult) any { return fmt.Sprint(f.value(r)) }}
+}
+
+// toFloat converts the value of a number field, whatever its integer or
+// float type.
+func toFloat(v any) float64 {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int8:
+		return float64(n)
+	case int16:
+		return float64(n)
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case uint:
+		return float64(n)
+	case uint8:
+		return float64(n)
+	case uint16:
+		return float64(n)
+	case uint32:
+		return float64(n)
+	case uint64:
+		return float64(n)
+	case float32:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
+
+func compareFilterValues(op string, a, b any) bool {
+	switch op {
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	case "startsWith":
+		return strings.HasPrefix(a.(string), b.(string))
+	case "endsWith":
+		return strings.HasSuffix(a.(string), b.(string))
+	case "contains":
+		return strings.Contains(a.(string), b.(string))
+	}
+
+	var cmp int
+	if an, ok := a.(float64); ok {
+		bn := b.(float64)
+		switch {
+		case an < bn:
+			cmp = -1
+		case an > bn:
+			cmp = 1
+		}
+	} else {
+		cmp = strings.Compare(a.(string), b.(string))
+	}
+	switch op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// knownFieldNames lists the names of the known output fields.
+func knownFieldNames() []string {
+	names := make([]string, 0, len(knownFields))
+	for _, f := range knownFields {
+		names = append(names, f.name)
+	}
+	return names
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseFilter(t *testing.T) {
+	var (
+		unchecked = repoResult{name: "a/unchecked", used: true, stars: 100}
+		testOnly  = repoResult{name: "a/test-only", used: true, stars: 2000, testUsageChecked: true, testOnly: true}
+		prod      = repoResult{name: "a/prod", used: true, stars: 9000, version: "v1.2.0", testUsageChecked: true, scanDuration: 1500 * time.Millisecond}
+	)
+	tests := []struct {
+		expr string
+		want map[string]bool
+	}{
+		{expr: "used && stars > 5000", want: map[string]bool{prod.name: true}},
+		{expr: `version startsWith "v1."`, want: map[string]bool{prod.name: true}},
+		{expr: "stars >= 2000 || stars < 200", want: map[string]bool{unchecked.name: true, testOnly.name: true, prod.name: true}},
+		{expr: "test_only", want: map[string]bool{testOnly.name: true}},
+		{expr: "!test_only", want: map[string]bool{prod.name: true}},
+		{expr: "test_only == false", want: map[string]bool{prod.name: true}},
+		{expr: "!(test_only && used)", want: map[string]bool{prod.name: true}},
+		{expr: "test_only || stars < 200", want: map[string]bool{unchecked.name: true, testOnly.name: true}},
+		{expr: "scan_ms > 1000", want: map[string]bool{prod.name: true}},
+		{expr: "!(scan_ms > 1000)", want: map[string]bool{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := parseFilter(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range []repoResult{unchecked, testOnly, prod} {
+				if got := f(r); got != tt.want[r.name] {
+					t.Errorf("%s: got %v, want %v", r.name, got, tt.want[r.name])
+				}
+			}
+		})
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	for _, expr := range []string{
+		"stars >",
+		"stars > \"x\"",
+		"version",
+		"unknown_field",
+		"(used",
+		"used &&& stars",
+	} {
+		if _, err := parseFilter(expr); err == nil {
+			t.Errorf("%s: no error", expr)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// versionFunnel is the -since-version adoption funnel: the adopters split
+// into the ones on the target version or later, the ones on an older tagged
+// release and the ones on no tagged release at all, a pseudo-version or an
+// unknown version.
+type versionFunnel struct {
+	target   string
+	adopters int
+	onTarget int
+	behind   int
+	untagged int
+}
+
+// computeFunnel returns the adoption funnel of the results for the target
+// version.
+func computeFunnel(results []repoResult, target string) versionFunnel {
+	f := versionFunnel{target: target}
+	for _, r := range results {
+		if !r.isAdopter() {
+			continue
+		}
+		f.adopters++
+		switch {
+		case !semver.IsValid(r.version) || module.IsPseudoVersion(r.version):
+			f.untagged++
+		case semver.Compare(r.version, target) >= 0:
+			f.onTarget++
+		default:
+			f.behind++
+		}
+	}
+	return f
+}
+
+func (f versionFunnel) print() {
+	tagged := f.onTarget + f.behind
+	logf("adoption funnel since %s:\n", f.target)
+	logf("  adopters: %d\n", f.adopters)
+	logf("  on a tagged release: %d (%s)\n", tagged, formatPercent(tagged, f.adopters))
+	logf("  on %s or later: %d (%s)\n", f.target, f.onTarget, formatPercent(f.onTarget, f.adopters))
+	logf("  behind %s: %d (%s)\n", f.target, f.behind, formatPercent(f.behind, f.adopters))
+	logf("  not on a tagged release: %d (%s)\n", f.untagged, formatPercent(f.untagged, f.adopters))
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestComputeFunnel(t *testing.T) {
+	adopter := func(version string) repoResult {
+		return repoResult{name: "a/" + version, used: true, version: version, confidence: confidenceHigh}
+	}
+	tests := []struct {
+		name    string
+		results []repoResult
+		target  string
+		want    versionFunnel
+	}{
+		{name: "no adopters", target: "v1.2.0", want: versionFunnel{target: "v1.2.0"}},
+		{
+			name:    "tagged releases",
+			results: []repoResult{adopter("v1.2.0"), adopter("v1.10.0"), adopter("v2.0.0+incompatible"), adopter("v1.1.9"), adopter("v0.9.0")},
+			target:  "v1.2.0",
+			want:    versionFunnel{target: "v1.2.0", adopters: 5, onTarget: 3, behind: 2},
+		},
+		{
+			name:    "prereleases",
+			results: []repoResult{adopter("v1.2.0-rc.1"), adopter("v1.2.1-beta"), adopter("v1.2.0")},
+			target:  "v1.2.0",
+			want:    versionFunnel{target: "v1.2.0", adopters: 3, onTarget: 2, behind: 1},
+		},
+		{
+			name:    "pseudo-versions and missing versions",
+			results: []repoResult{adopter("v0.0.0-20240101120000-abcdefabcdef"), adopter("v1.3.1-0.20240101120000-abcdefabcdef"), adopter(""), adopter("master"), adopter("v1.3.0")},
+			target:  "v1.2.0",
+			want:    versionFunnel{target: "v1.2.0", adopters: 5, onTarget: 1, untagged: 4},
+		},
+		{
+			name: "only adopters count",
+			results: []repoResult{
+				adopter("v1.3.0"),
+				{name: "a/unused", version: "v1.3.0", confidence: confidenceHigh},
+				{name: "a/low", used: true, version: "v1.3.0", confidence: confidenceLow},
+				{name: "a/tests", used: true, version: "v1.3.0", confidence: confidenceHigh, testUsageChecked: true, testOnly: true},
+			},
+			target: "v1.2.0",
+			want:   versionFunnel{target: "v1.2.0", adopters: 1, onTarget: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := computeFunnel(tt.results, tt.target); got != tt.want {
+				t.Errorf("funnel %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFunnelPrint(t *testing.T) {
+	var buf bytes.Buffer
+	logOutput = &buf
+	defer func() { logOutput = io.Discard }()
+
+	versionFunnel{target: "v1.2.0", adopters: 4, onTarget: 1, behind: 2, untagged: 1}.print()
+	for _, want := range []string{
+		"adopters: 4\n",
+		"on a tagged release: 3 (75.0%)\n",
+		"on v1.2.0 or later: 1 (25.0%)\n",
+		"behind v1.2.0: 2 (50.0%)\n",
+		"not on a tagged release: 1 (25.0%)\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("funnel\n%s\nwant %q", buf.String(), want)
+		}
+	}
+}
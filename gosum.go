@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/samber/lo"
+	"io"
+	"path"
+	"strings"
+)
+
+// lockedVersions returns the versions of the module the go.sum next to the
+// go.mod at goModPath locks, and false when there is no go.sum.
+func (s *searchResult) lockedVersions(ctx context.Context, repo candidate, goModPath, module string) ([]string, bool, error) {
+	goSumPath := path.Join(path.Dir(goModPath), "go.sum")
+
+	defer s.timings.track(phaseDownload, repo.name+"/"+goSumPath)()
+
+	reader, _, err := s.client.Repositories.DownloadContents(ctx, repo.owner, repo.repo, goSumPath, nil)
+	if err != nil {
+		// see checkVendored
+		if isNotFound(err) || strings.HasPrefix(err.Error(), "no file named") {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("error downloading %s: %v", goSumPath, withRequestID(err))
+	}
+	defer reader.Close()
+
+	bb, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading %s: %v", goSumPath, err)
+	}
+
+	return goSumVersions(bb, module), true, nil
+}
+
+// goSumVersions returns the versions of the module a go.sum has the hash of
+// the module content for, in file order. Lines only hashing the go.mod of a
+// version, "module version/go.mod h1:...", are the versions considered by
+// the module graph but not built, they are left out.
+func goSumVersions(goSum []byte, modulePath string) []string {
+	var versions []string
+	scanner := bufio.NewScanner(bytes.NewReader(goSum))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || fields[0] != modulePath || strings.HasSuffix(fields[1], "/go.mod") {
+			continue
+		}
+		versions = append(versions, fields[1])
+	}
+	return versions
+}
+
+// recordGoSum records the locked versions of the result and whether they
+// contradict the version its go.mod requires. A tool directive without a
+// requirement has no version to contradict.
+func (r *repoResult) recordGoSum(versions []string) {
+	r.goSumChecked = true
+	r.goSumVersions = versions
+	r.goSumMismatch = r.rawVersion != "" && !lo.Contains(versions, r.rawVersion)
+}
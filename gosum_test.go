@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestGoSumVersions(t *testing.T) {
+	goSum := `github.com/x/lib v1.0.0 h1:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa=
+github.com/x/lib v1.0.0/go.mod h1:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb=
+github.com/x/lib v0.9.0/go.mod h1:ccccccccccccccccccccccccccccccccccccccccccc=
+github.com/x/lib v1.2.0 h1:ddddddddddddddddddddddddddddddddddddddddddd=
+github.com/x/lib v1.2.0/go.mod h1:eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee=
+github.com/x/libx v1.5.0 h1:fffffffffffffffffffffffffffffffffffffffffff=
+github.com/x/lib/v2 v2.0.0 h1:ggggggggggggggggggggggggggggggggggggggggggg=
+
+malformed line
+`
+	tests := []struct {
+		module string
+		want   []string
+	}{
+		{module: "github.com/x/lib", want: []string{"v1.0.0", "v1.2.0"}},
+		{module: "github.com/x/lib/v2", want: []string{"v2.0.0"}},
+		{module: "github.com/x/other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.module, func(t *testing.T) {
+			if got := goSumVersions([]byte(goSum), tt.module); !slices.Equal(got, tt.want) {
+				t.Errorf("goSumVersions(%s) = %v, want %v", tt.module, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckGoSum(t *testing.T) {
+	goSum := "github.com/x/lib v1.0.0 h1:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa=\ngithub.com/x/lib v1.0.0/go.mod h1:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb=\n"
+	tests := []struct {
+		name         string
+		files        map[string]string
+		wantChecked  bool
+		wantVersions []string
+		wantMismatch bool
+	}{
+		{name: "locked", files: map[string]string{"go.mod": goModRequiring("v1.0.0"), "go.sum": goSum}, wantChecked: true, wantVersions: []string{"v1.0.0"}},
+		{name: "mismatch", files: map[string]string{"go.mod": goModRequiring("v1.1.0"), "go.sum": goSum}, wantChecked: true, wantVersions: []string{"v1.0.0"}, wantMismatch: true},
+		{name: "nested module", files: map[string]string{"go.mod": "module example.com/app\n", "tools/go.mod": goModRequiring("v1.0.0"), "tools/go.sum": goSum}, wantChecked: true, wantVersions: []string{"v1.0.0"}},
+		{name: "no go.sum", files: map[string]string{"go.mod": goModRequiring("v1.0.0")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeGitHub{repos: map[string]map[string]string{"a/app": tt.files}}
+			s := newFakeSearch(t, f, "github.com/x/lib")
+			s.checkGoSum = true
+			results, err := s.searchInRepositories(context.Background(), []candidate{fakeCandidate("a/app", 10)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := results["a/app"]
+			if got.goSumChecked != tt.wantChecked || !slices.Equal(got.goSumVersions, tt.wantVersions) || got.goSumMismatch != tt.wantMismatch {
+				t.Errorf("go.sum checked %v, versions %v, mismatch %v, want %v, %v, %v", got.goSumChecked, got.goSumVersions, got.goSumMismatch, tt.wantChecked, tt.wantVersions, tt.wantMismatch)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+)
+
+// Granularities of the output rows, set with -granularity.
+const (
+	granularityRepo   = "repo"
+	granularityModule = "module"
+)
+
+var granularities = []string{granularityRepo, granularityModule}
+
+// goModMatch is a go.mod file of a repository requiring the package.
+type goModMatch struct {
+	path       string
+	rawVersion string
+}
+
+// formatMatches serializes the matches for the cache as
+// path@version;path@version.
+func formatMatches(matches []goModMatch) string {
+	parts := make([]string, 0, len(matches))
+	for _, m := range matches {
+		parts = append(parts, m.path+"@"+m.rawVersion)
+	}
+	return strings.Join(parts, ";")
+}
+
+// parseMatches parses the matches written by formatMatches. The version is
+// after the last @, go.mod paths may contain one.
+func parseMatches(value string) []goModMatch {
+	if value == "" {
+		return nil
+	}
+	var matches []goModMatch
+	for _, part := range strings.Split(value, ";") {
+		i := strings.LastIndex(part, "@")
+		if i < 0 {
+			matches = append(matches, goModMatch{path: part})
+			continue
+		}
+		matches = append(matches, goModMatch{path: part[:i], rawVersion: part[i+1:]})
+	}
+	return matches
+}
+
+// perModule returns one row per go.mod file requiring the package, with the
+// version and module kind of that go.mod. Results without recorded matches,
+// like the ones cached before they were recorded, keep their single row.
+func perModule(results []repoResult) []repoResult {
+	rows := make([]repoResult, 0, len(results))
+	for _, r := range results {
+		if !r.used || len(r.matches) < 2 {
+			rows = append(rows, r)
+			continue
+		}
+		for _, m := range r.matches {
+			row := r
+			row.goModPath = m.path
+			if m.path != r.goModPath {
+				// only the SHA and go.sum of the last matching go.mod are
+				// known
+				row.goModSHA = ""
+				row.goSumChecked = false
+				row.goSumVersions = nil
+				row.directRequires = 0
+				row.ownModule = ""
+			}
+			row.rawVersion = m.rawVersion
+			row.version = normalizeVersion(m.rawVersion)
+			if r.moduleKind != "" {
+				row.moduleKind = classifyModulePath(m.path)
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
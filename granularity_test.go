@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestGranularity(t *testing.T) {
+	f := &fakeGitHub{repos: map[string]map[string]string{
+		"a/mono": {
+			"go.mod":          goModRequiring("v1.0.0"),
+			"tools/go.mod":    goModRequiring("v1.2.0"),
+			"examples/go.mod": "module example.com/examples\n",
+		},
+		"a/single": {"go.mod": goModRequiring("v1.1.0")},
+		"a/unused": {"go.mod": "module example.com/unused\n"},
+	}}
+	s := newFakeSearch(t, f, "github.com/x/lib")
+	found, err := s.searchInRepositories(context.Background(), []candidate{fakeCandidate("a/mono", 10), fakeCandidate("a/single", 5), fakeCandidate("a/unused", 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := []repoResult{found["a/mono"], found["a/single"], found["a/unused"]}
+
+	tests := []struct {
+		granularity string
+		rows        []repoResult
+		// want are the name, go.mod path and version of the rows
+		want [][3]string
+	}{
+		{granularity: granularityRepo, rows: results, want: [][3]string{{"a/mono", "tools/go.mod", "v1.2.0"}, {"a/single", "go.mod", "v1.1.0"}, {"a/unused", "", ""}}},
+		{granularity: granularityModule, rows: perModule(results), want: [][3]string{{"a/mono", "go.mod", "v1.0.0"}, {"a/mono", "tools/go.mod", "v1.2.0"}, {"a/single", "go.mod", "v1.1.0"}, {"a/unused", "", ""}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.granularity, func(t *testing.T) {
+			var got [][3]string
+			for _, r := range tt.rows {
+				got = append(got, [3]string{r.name, r.goModPath, r.version})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rows %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMatches(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []goModMatch
+	}{
+		{value: ""},
+		{value: "go.mod@v1.0.0", want: []goModMatch{{path: "go.mod", rawVersion: "v1.0.0"}}},
+		{value: "go.mod@v1.0.0;tools/go.mod@v1.2.0", want: []goModMatch{{path: "go.mod", rawVersion: "v1.0.0"}, {path: "tools/go.mod", rawVersion: "v1.2.0"}}},
+		{value: "@scope/go.mod@v1.0.0", want: []goModMatch{{path: "@scope/go.mod", rawVersion: "v1.0.0"}}},
+		{value: "go.mod", want: []goModMatch{{path: "go.mod"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got := parseMatches(tt.value)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMatches(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+			if tt.value != "go.mod" && formatMatches(got) != tt.value {
+				t.Errorf("formatted back as %q", formatMatches(got))
+			}
+		})
+	}
+}
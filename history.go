@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// historyColumns is the header of the history file.
+var historyColumns = []string{"time", "repo", "from_used", "to_used", "from_version", "to_version", "from_state", "to_state", "gomod_path", "gomod_sha", "source"}
+
+// transition is a change of the result of a repository between two runs,
+// the previous observation it replaced and the evidence of the new one.
+type transition struct {
+	at          time.Time
+	repo        string
+	fromUsed    bool
+	toUsed      bool
+	fromVersion string
+	toVersion   string
+	fromState   string
+	toState     string
+	goModPath   string
+	goModSHA    string
+	source      string
+}
+
+// historyFile returns the file the transitions of the results of a cache
+// file are appended to.
+func historyFile(cacheFile string) string {
+	if isCompressed(cacheFile) {
+		return trimCacheExt(cacheFile) + ".history.csv.gz"
+	}
+	return trimCacheExt(cacheFile) + ".history.csv"
+}
+
+// isHistoryFile reports whether a file is the history of a cache rather
+// than a cache, the two share the .csv and .csv.gz extensions.
+func isHistoryFile(fileName string) bool {
+	return strings.HasSuffix(trimCacheExt(fileName), ".history")
+}
+
+// newTransition returns the transition from the previous to the current
+// result of a repository, and false if neither the usage, the version nor
+// the state changed.
+func newTransition(at time.Time, previous, current repoResult) (transition, bool) {
+	if previous.used == current.used && previous.version == current.version && previous.state == current.state {
+		return transition{}, false
+	}
+	return transition{
+		at:          at,
+		repo:        current.name,
+		fromUsed:    previous.used,
+		toUsed:      current.used,
+		fromVersion: previous.version,
+		toVersion:   current.version,
+		fromState:   previous.state,
+		toState:     current.state,
+		goModPath:   current.goModPath,
+		goModSHA:    current.goModSHA,
+		source:      current.source,
+	}, true
+}
+
+func (t transition) record() []string {
+	return []string{
+		formatTime(t.at),
+		t.repo,
+		strconv.FormatBool(t.fromUsed),
+		strconv.FormatBool(t.toUsed),
+		t.fromVersion,
+		t.toVersion,
+		t.fromState,
+		t.toState,
+		t.goModPath,
+		t.goModSHA,
+		t.source,
+	}
+}
+
+func parseTransition(record []string) (transition, error) {
+	if len(record) < len(historyColumns) {
+		return transition{}, fmt.Errorf("invalid history record: %v", record)
+	}
+	at, err := time.Parse(time.RFC3339, record[0])
+	if err != nil {
+		return transition{}, fmt.Errorf("invalid value for time: %v", record[0])
+	}
+	return transition{
+		at:          at,
+		repo:        record[1],
+		fromUsed:    record[2] == "true",
+		toUsed:      record[3] == "true",
+		fromVersion: record[4],
+		toVersion:   record[5],
+		fromState:   record[6],
+		toState:     record[7],
+		goModPath:   record[8],
+		goModSHA:    record[9],
+		source:      record[10],
+	}, nil
+}
+
+// readHistory reads the transitions of a history file, oldest first. A
+// missing file has none.
+func readHistory(fileName string) ([]transition, error) {
+	file, err := os.Open(fileName)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r, err := decompress(file)
+	if err != nil {
+		return nil, err
+	}
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var transitions []transition
+	for i, record := range records {
+		if i == 0 && len(record) > 0 && record[0] == historyColumns[0] {
+			continue
+		}
+		t, err := parseTransition(record)
+		if err != nil {
+			return nil, err
+		}
+		transitions = append(transitions, t)
+	}
+	return transitions, nil
+}
+
+// appendHistory appends the transitions to the history file, writing the
+// header when the file is new. When a repository then has more than keep
+// transitions, the file is compacted to the keep latest of each; keep 0
+// keeps them all.
+func appendHistory(fileName string, transitions []transition, keep int) error {
+	if len(transitions) == 0 {
+		return nil
+	}
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	var records [][]string
+	if info.Size() == 0 {
+		records = append(records, historyColumns)
+	}
+	for _, t := range transitions {
+		records = append(records, t.record())
+	}
+	// a gzip file can be appended to, the streams are read one after the
+	// other
+	err = writeCompressed(file, isCompressed(fileName), func(w io.Writer) error {
+		return writeRecords(w, records)
+	})
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if keep <= 0 {
+		return nil
+	}
+	all, err := readHistory(fileName)
+	if err != nil {
+		return fmt.Errorf("error reading the history: %v", err)
+	}
+	if compacted := compactHistory(all, keep); len(compacted) < len(all) {
+		logf("compacting the history %s from %d to %d transitions\n", fileName, len(all), len(compacted))
+		return replaceHistory(fileName, compacted)
+	}
+	return nil
+}
+
+// compactHistory returns the keep latest transitions of every repository,
+// in their original order.
+func compactHistory(transitions []transition, keep int) []transition {
+	left := make(map[string]int)
+	for _, t := range transitions {
+		left[t.repo]++
+	}
+	compacted := make([]transition, 0, len(transitions))
+	for _, t := range transitions {
+		if left[t.repo] > keep {
+			left[t.repo]--
+			continue
+		}
+		compacted = append(compacted, t)
+	}
+	return compacted
+}
+
+// replaceHistory rewrites the history file through a temporary file, so a
+// crash leaves either the old or the new history.
+func replaceHistory(fileName string, transitions []transition) error {
+	tmp, err := os.CreateTemp(filepath.Dir(fileName), ".pkgstats-history-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	records := [][]string{historyColumns}
+	for _, t := range transitions {
+		records = append(records, t.record())
+	}
+	err = writeCompressed(tmp, isCompressed(fileName), func(w io.Writer) error {
+		return writeRecords(w, records)
+	})
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fileName)
+}
+
+// writeRecords writes CSV records and syncs them when w is a file.
+func writeRecords(w io.Writer, records [][]string) error {
+	writer := csv.NewWriter(w)
+	if err := writer.WriteAll(records); err != nil {
+		return err
+	}
+	if file, ok := w.(*os.File); ok {
+		return file.Sync()
+	}
+	return nil
+}
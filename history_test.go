@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewTransition(t *testing.T) {
+	previous := repoResult{name: "a/one", used: true, version: "v1.0.0"}
+	tests := []struct {
+		name    string
+		current repoResult
+		want    bool
+	}{
+		{name: "unchanged", current: repoResult{name: "a/one", used: true, version: "v1.0.0", stars: 20}},
+		{name: "dropped", current: repoResult{name: "a/one", goModPath: "go.mod"}, want: true},
+		{name: "upgraded", current: repoResult{name: "a/one", used: true, version: "v1.1.0"}, want: true},
+		{name: "not found", current: repoResult{name: "a/one", used: true, version: "v1.0.0", state: stateNotFound}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := newTransition(time.Now(), previous, tt.current)
+			if ok != tt.want {
+				t.Fatalf("transition %v, want one: %v", ok, tt.want)
+			}
+			if ok && (got.fromUsed != previous.used || got.toUsed != tt.current.used || got.fromVersion != previous.version || got.toVersion != tt.current.version) {
+				t.Errorf("transition %+v from %+v to %+v", got, previous, tt.current)
+			}
+		})
+	}
+}
+
+func TestAppendHistory(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	flip := func(run int, repo string) transition {
+		return transition{at: start.Add(time.Duration(run) * time.Hour), repo: repo, fromUsed: run%2 == 1, toUsed: run%2 == 0, toVersion: "v1.0.0", source: sourceCodeSearch}
+	}
+	tests := []struct {
+		name     string
+		fileName string
+		keep     int
+		// want are the runs of the transitions of a/one and a/two left
+		wantOne []int
+		wantTwo []int
+	}{
+		{name: "all kept", fileName: "pkg.history.csv", wantOne: []int{0, 1, 2, 3, 4}, wantTwo: []int{0, 4}},
+		{name: "compacted", fileName: "pkg.history.csv", keep: 2, wantOne: []int{3, 4}, wantTwo: []int{0, 4}},
+		{name: "compressed", fileName: "pkg.history.csv.gz", keep: 3, wantOne: []int{2, 3, 4}, wantTwo: []int{0, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), tt.fileName)
+			// a/one flips on every run, a/two on the first and the last
+			for run := 0; run < 5; run++ {
+				transitions := []transition{flip(run, "a/one")}
+				if run == 0 || run == 4 {
+					transitions = append(transitions, flip(run, "a/two"))
+				}
+				if err := appendHistory(fileName, transitions, tt.keep); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := readHistory(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			runs := map[string][]int{}
+			for _, tr := range got {
+				runs[tr.repo] = append(runs[tr.repo], int(tr.at.Sub(start)/time.Hour))
+				if tr.toVersion != "v1.0.0" || tr.source != sourceCodeSearch {
+					t.Errorf("transition read back as %+v", tr)
+				}
+			}
+			if !slices.Equal(runs["a/one"], tt.wantOne) || !slices.Equal(runs["a/two"], tt.wantTwo) {
+				t.Errorf("transitions of runs %v, want a/one %v and a/two %v", runs, tt.wantOne, tt.wantTwo)
+			}
+
+			if !isCompressed(fileName) {
+				bb, err := os.ReadFile(fileName)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n := strings.Count(string(bb), strings.Join(historyColumns, ",")); n != 1 {
+					t.Errorf("%d headers in the history", n)
+				}
+			}
+		})
+	}
+}
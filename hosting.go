@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+)
+
+// Hosting of an adopter, from its own module path and mirror URL.
+const (
+	// hostingGitHub adopters are developed on GitHub, their module path is
+	// on github.com
+	hostingGitHub = "github"
+	// hostingMirror adopters are GitHub mirrors of a project developed on
+	// another forge
+	hostingMirror = "mirror"
+	// hostingVanity adopters have a module path on their own domain, e.g.
+	// go.uber.org/zap, they are developed on GitHub
+	hostingVanity = "vanity"
+)
+
+var hostings = []string{hostingGitHub, hostingMirror, hostingVanity}
+
+// knownForges are the hosts of module paths of projects developed outside
+// GitHub, whose GitHub repositories are mirrors.
+var knownForges = map[string]bool{
+	"gitlab.com":       true,
+	"bitbucket.org":    true,
+	"codeberg.org":     true,
+	"git.sr.ht":        true,
+	"gitea.com":        true,
+	"salsa.debian.org": true,
+	"invent.kde.org":   true,
+	"gitlab.gnome.org": true,
+}
+
+// classifyHosting returns the hosting of an adopter from the module path of
+// its own go.mod and the mirror URL GitHub reports for it. Without a module
+// path the repository is taken as developed on GitHub.
+func classifyHosting(ownModule, mirrorURL string) string {
+	if mirrorURL != "" {
+		return hostingMirror
+	}
+	host, _, _ := strings.Cut(ownModule, "/")
+	switch {
+	case ownModule == "" || host == "github.com":
+		return hostingGitHub
+	case knownForges[host]:
+		return hostingMirror
+	default:
+		return hostingVanity
+	}
+}
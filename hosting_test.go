@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestClassifyHosting(t *testing.T) {
+	tests := []struct {
+		name      string
+		ownModule string
+		mirrorURL string
+		want      string
+	}{
+		{name: "github", ownModule: "github.com/a/app", want: hostingGitHub},
+		{name: "vanity domain", ownModule: "go.uber.org/zap", want: hostingVanity},
+		{name: "vanity subpath", ownModule: "k8s.io/client-go/v2", want: hostingVanity},
+		{name: "other forge", ownModule: "gitlab.com/group/app", want: hostingMirror},
+		{name: "mirror url", ownModule: "github.com/a/app", mirrorURL: "https://git.example.org/app.git", want: hostingMirror},
+		{name: "no module path", want: hostingGitHub},
+		{name: "unqualified module", ownModule: "app", want: hostingVanity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyHosting(tt.ownModule, tt.mirrorURL); got != tt.want {
+				t.Errorf("classifyHosting(%q, %q) = %s, want %s", tt.ownModule, tt.mirrorURL, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostingBreakdown(t *testing.T) {
+	requiring := func(module string) string {
+		return "module " + module + "\n\nrequire github.com/x/lib v1.0.0\n"
+	}
+	f := &fakeGitHub{repos: map[string]map[string]string{
+		"a/github":    {"go.mod": requiring("github.com/a/github")},
+		"uber-go/zap": {"go.mod": requiring("go.uber.org/zap")},
+		"a/forge":     {"go.mod": requiring("gitlab.com/a/forge")},
+		"a/mirrored":  {"go.mod": requiring("github.com/a/mirrored")},
+		"a/unused":    {"go.mod": "module go.example.com/unused\n"},
+	}}
+	mirrored := fakeCandidate("a/mirrored", 10)
+	mirrored.mirrorURL = "https://git.example.org/mirrored.git"
+	s := newFakeSearch(t, f, "github.com/x/lib")
+	// mirrors are skipped otherwise
+	s.includeMirrors = true
+	found, err := s.searchInRepositories(context.Background(), []candidate{fakeCandidate("a/github", 10), fakeCandidate("uber-go/zap", 10), fakeCandidate("a/forge", 10), mirrored, fakeCandidate("a/unused", 10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"a/github": hostingGitHub, "uber-go/zap": hostingVanity, "a/forge": hostingMirror, "a/mirrored": hostingMirror, "a/unused": ""}
+	var results []repoResult
+	for name, hosting := range want {
+		if got := found[name].hosting; got != hosting {
+			t.Errorf("%s hosting %q, want %q", name, got, hosting)
+		}
+		results = append(results, found[name])
+	}
+	summary := summarize(results)
+	if summary.byHosting[hostingGitHub] != 1 || summary.byHosting[hostingVanity] != 1 || summary.byHosting[hostingMirror] != 2 {
+		t.Errorf("adopters by hosting %v", summary.byHosting)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// defaultHost is the forge of results named owner/repo, every source but
+// GitHub names its repositories host/owner/repo.
+const defaultHost = "github.com"
+
+// repoHost returns the forge hosting the repository of a result.
+func repoHost(r repoResult) string {
+	if parts := strings.Split(r.name, "/"); len(parts) > 2 && strings.Contains(parts[0], ".") {
+		return parts[0]
+	}
+	return defaultHost
+}
+
+// hostShare is the number of adopters and their reach on one forge.
+type hostShare struct {
+	host     string
+	adopters int
+	reach    int
+}
+
+// hostSplit returns the number and reach of the adopters per forge, the most adopters first.
+func hostSplit(results []repoResult) []hostShare {
+	byHost := make(map[string]*hostShare)
+	for _, r := range results {
+		if !r.isAdopter() {
+			continue
+		}
+		host := repoHost(r)
+		if byHost[host] == nil {
+			byHost[host] = &hostShare{host: host}
+		}
+		byHost[host].adopters++
+		byHost[host].reach += r.stars
+	}
+
+	shares := make([]hostShare, 0, len(byHost))
+	for _, share := range byHost {
+		shares = append(shares, *share)
+	}
+	sort.Slice(shares, func(i, j int) bool {
+		if shares[i].adopters != shares[j].adopters {
+			return shares[i].adopters > shares[j].adopters
+		}
+		return shares[i].host < shares[j].host
+	})
+	return shares
+}
+
+// printHostSplit logs the -compare-hosts report.
+func printHostSplit(results []repoResult) {
+	shares := hostSplit(results)
+	total := 0
+	for _, share := range shares {
+		total += share.adopters
+	}
+	logln("adopters by host:")
+	for _, share := range shares {
+		logf("  %s: %d adopters (%s), reach %d\n", share.host, share.adopters, formatPercent(share.adopters, total), share.reach)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHostSplit(t *testing.T) {
+	adopter := func(name string, stars int) repoResult {
+		return repoResult{name: name, used: true, confidence: confidenceHigh, stars: stars}
+	}
+	results := []repoResult{
+		adopter("a/one", 100),
+		adopter("b/two", 20),
+		adopter("gitlab.com/c/three", 50),
+		adopter("gitlab.com/group/sub/four", 5),
+		adopter("codeberg.org/d/five", 7),
+		// not adopters
+		{name: "e/unused", stars: 1000},
+		{name: "gitlab.com/f/low", used: true, confidence: confidenceLow, stars: 1000},
+	}
+	want := []hostShare{
+		{host: "github.com", adopters: 2, reach: 120},
+		{host: "gitlab.com", adopters: 2, reach: 55},
+		{host: "codeberg.org", adopters: 1, reach: 7},
+	}
+	if got := hostSplit(results); !reflect.DeepEqual(got, want) {
+		t.Errorf("hostSplit = %+v, want %+v", got, want)
+	}
+	if got := hostSplit(nil); len(got) != 0 {
+		t.Errorf("hostSplit(nil) = %+v", got)
+	}
+}
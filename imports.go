@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"golang.org/x/mod/modfile"
+	"strings"
+)
+
+// goModFile is a parsed go.mod file and its path in the repository. module
+// is the module it requires as an indirect dependency.
+type goModFile struct {
+	path   string
+	f      *modfile.File
+	module string
+}
+
+// importsPackage reports whether Go source files of the repository mention
+// the module path, which is almost always an import.
+func (s *searchResult) importsPackage(ctx context.Context, repo candidate, module string) (bool, error) {
+	n, _, err := s.countImports(ctx, repo, module)
+	return n > 0, err
+}
+
+// countImports returns the number of Go source files of the repository that
+// mention the module path, and whether the code search says the count is
+// incomplete.
+func (s *searchResult) countImports(ctx context.Context, repo candidate, module string) (int, bool, error) {
+	stop := s.timings.track(phaseCodeSearch, repo.name)
+	files, _, err := searchCode(ctx, s.client, fmt.Sprintf("%q repo:%s language:go", module, repo.name))
+	stop()
+	if err != nil {
+		return 0, false, fmt.Errorf("error searching the imports of %s: %v", repo.name, withRequestID(err))
+	}
+	return files.GetTotal(), files.GetIncompleteResults(), nil
+}
+
+// countUsageFiles records the number of files of an adopter importing the
+// package, the breadth of its usage. It costs a code search, at most
+// usageSearches of them are made in a run.
+func (s *searchResult) countUsageFiles(ctx context.Context, repo candidate, result *repoResult) {
+	if s.usageSearches <= 0 {
+		if !s.usageCapped {
+			logf("usage file searches capped, the remaining adopters get no usage_files\n")
+			s.usageCapped = true
+		}
+		return
+	}
+	s.usageSearches--
+
+	n, incomplete, err := s.countImports(ctx, repo, result.module)
+	if err != nil {
+		logf("%v\n", err)
+		return
+	}
+	if incomplete {
+		logf("import search of repository %s is incomplete, %d files is a lower bound\n", repo.name, n)
+	}
+	logf("repository %s imports package %s in %d files\n", repo.name, result.module, n)
+	result.usageChecked = true
+	result.usageFiles = n
+}
+
+// testOnlyPaths reports whether every one of the paths of Go files
+// importing the package is a test file. No paths is not test-only usage.
+func testOnlyPaths(paths []string) bool {
+	for _, path := range paths {
+		if !strings.HasSuffix(path, "_test.go") {
+			return false
+		}
+	}
+	return len(paths) > 0
+}
+
+// classifyTestOnly records whether an adopter imports the package in tests
+// only. The code search can't exclude test files, so it lists the importing
+// files and classifies their paths. It costs a code search.
+func (s *searchResult) classifyTestOnly(ctx context.Context, repo candidate, result *repoResult) {
+	stop := s.timings.track(phaseCodeSearch, repo.name)
+	files, _, err := searchCode(ctx, s.client, fmt.Sprintf("%q repo:%s language:go", result.module, repo.name))
+	stop()
+	if err != nil {
+		logf("error searching the imports of %s: %v\n", repo.name, withRequestID(err))
+		return
+	}
+	paths := make([]string, 0, len(files.CodeResults))
+	for _, file := range files.CodeResults {
+		paths = append(paths, file.GetPath())
+	}
+	testOnly := testOnlyPaths(paths)
+	switch {
+	case len(paths) == 0:
+		logf("import search of repository %s found no files, not classifying its usage\n", repo.name)
+		return
+	case testOnly && (files.GetTotal() > len(paths) || files.GetIncompleteResults()):
+		// a file not listed may be a non-test one
+		logf("import search of repository %s is incomplete, not classifying its usage\n", repo.name)
+		return
+	}
+	if testOnly {
+		logf("repository %s imports package %s in tests only\n", repo.name, result.module)
+	}
+	result.testUsageChecked = true
+	result.testOnly = testOnly
+}
+
+// verifyIndirect counts a repository whose go.mod requires the package as an
+// indirect dependency as an adopter when its source imports the package: the
+// // indirect comment is stale.
+func (s *searchResult) verifyIndirect(ctx context.Context, repo candidate, result *repoResult, indirect goModFile) {
+	imported, err := s.importsPackage(ctx, repo, indirect.module)
+	if err != nil {
+		logf("%v\n", err)
+		return
+	}
+	if !imported {
+		return
+	}
+
+	logf("Repository %s imports package %s but %s requires it as indirect\n", repo.name, indirect.module, indirect.path)
+	s.markUsed(result, indirect.module, indirect.path, indirect.f, findRequire(indirect.f, indirect.module), false)
+	result.staleIndirect = true
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTestOnlyPaths(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		want  bool
+	}{
+		{name: "no files", want: false},
+		{name: "tests only", paths: []string{"a_test.go", "internal/b/b_test.go"}, want: true},
+		{name: "test helper", paths: []string{"a_test.go", "testutil/helpers.go"}, want: false},
+		{name: "production", paths: []string{"main.go"}, want: false},
+		{name: "test in the name", paths: []string{"contest.go", "test.go"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := testOnlyPaths(tt.paths); got != tt.want {
+				t.Errorf("testOnlyPaths(%v) = %v, want %v", tt.paths, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyIndirect(t *testing.T) {
+	indirect := "module example.com/app\n\nrequire github.com/x/lib v1.0.0 // indirect\n"
+	tests := []struct {
+		name         string
+		files        map[string]string
+		verify       bool
+		wantUsed     bool
+		wantStale    bool
+		wantSearches int
+	}{
+		{name: "imported", files: map[string]string{"go.mod": indirect, "main.go": "import \"github.com/x/lib\"\n"}, verify: true, wantUsed: true, wantStale: true, wantSearches: 2},
+		{name: "not imported", files: map[string]string{"go.mod": indirect, "main.go": "package main\n"}, verify: true, wantSearches: 2},
+		{name: "not verified", files: map[string]string{"go.mod": indirect, "main.go": "import \"github.com/x/lib\"\n"}, wantSearches: 1},
+		// a direct requirement needs no import search
+		{name: "direct", files: map[string]string{"go.mod": goModRequiring("v1.0.0"), "main.go": "import \"github.com/x/lib\"\n"}, verify: true, wantUsed: true, wantSearches: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeGitHub{repos: map[string]map[string]string{"a/app": tt.files}}
+			s := newFakeSearch(t, f, "github.com/x/lib")
+			s.verifyImports = tt.verify
+			results, err := s.searchInRepositories(context.Background(), []candidate{fakeCandidate("a/app", 10)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := results["a/app"]
+			if got.used != tt.wantUsed {
+				t.Errorf("used %v, want %v", got.used, tt.wantUsed)
+			}
+			if got.staleIndirect != tt.wantStale {
+				t.Errorf("stale indirect %v, want %v", got.staleIndirect, tt.wantStale)
+			}
+			if got.used && got.rawVersion != "v1.0.0" {
+				t.Errorf("version %q, want v1.0.0", got.rawVersion)
+			}
+			if n := f.requested("/search/code"); n != tt.wantSearches {
+				t.Errorf("%d code searches, want %d", n, tt.wantSearches)
+			}
+		})
+	}
+}
+
+func TestCountUsageFiles(t *testing.T) {
+	imports := "package main\n\nimport \"github.com/x/lib\"\n"
+	f := &fakeGitHub{repos: map[string]map[string]string{
+		"a/wide":   {"go.mod": goModRequiring("v1.0.0"), "main.go": imports, "cmd/run.go": imports, "internal/x/x.go": imports, "other.go": "package main\n"},
+		"a/narrow": {"go.mod": goModRequiring("v1.0.0"), "main.go": imports},
+		"a/capped": {"go.mod": goModRequiring("v1.0.0"), "main.go": imports},
+		"a/unused": {"go.mod": "module example.com/unused\n", "main.go": imports},
+	}}
+	s := newFakeSearch(t, f, "github.com/x/lib")
+	s.countUsage = true
+	// the searches run out before a/capped
+	s.usageSearches = 2
+	candidates := []candidate{fakeCandidate("a/wide", 30), fakeCandidate("a/narrow", 20), fakeCandidate("a/capped", 10), fakeCandidate("a/unused", 5)}
+	results, err := s.searchInRepositories(context.Background(), candidates)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		repo        string
+		wantChecked bool
+		wantFiles   int
+	}{
+		{repo: "a/wide", wantChecked: true, wantFiles: 3},
+		{repo: "a/narrow", wantChecked: true, wantFiles: 1},
+		{repo: "a/capped"},
+		{repo: "a/unused"},
+	}
+	for _, tt := range tests {
+		got := results[tt.repo]
+		if got.usageChecked != tt.wantChecked || got.usageFiles != tt.wantFiles {
+			t.Errorf("%s: usage checked %v, %d files, want %v, %d", tt.repo, got.usageChecked, got.usageFiles, tt.wantChecked, tt.wantFiles)
+		}
+	}
+	if !s.usageCapped {
+		t.Error("usage searches not reported as capped")
+	}
+	// a go.mod search per repository and an import search per counted one
+	if n := f.requested("/search/code"); n != len(candidates)+2 {
+		t.Errorf("%d code searches, want %d", n, len(candidates)+2)
+	}
+}
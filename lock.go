@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// errLockHeld is the error of a run finding the cache locked by another run.
+var errLockHeld = errors.New("the cache is locked by another run")
+
+// cacheLock marks a cache as being written by a run, so that two runs
+// sharing the cache directory, e.g. on hosts mounting it over NFS, don't
+// overwrite each other's results. The run refreshes the lock while it lasts,
+// a lock left unrefreshed for staleAfter belongs to a run that died and is
+// taken over. A nil lock guards nothing.
+type cacheLock struct {
+	fileName   string
+	owner      lockOwner
+	staleAfter time.Duration
+	// stop ends the refreshing, which closes done
+	stop, done chan struct{}
+}
+
+// lockOwner is the run holding a lock, the content of the lock file.
+type lockOwner struct {
+	Host  string    `json:"host"`
+	PID   int       `json:"pid"`
+	Since time.Time `json:"since"`
+}
+
+func (o lockOwner) String() string {
+	return fmt.Sprintf("%s, pid %d, since %s", o.Host, o.PID, formatTime(o.Since))
+}
+
+// cacheLockFile returns the lock of a cache file.
+func cacheLockFile(cacheFile string) string {
+	return trimCacheExt(cacheFile) + ".lock"
+}
+
+// acquireLock locks the cache file for the run. A lock of another run
+// refreshed within staleAfter is an error naming the run, unless steal is
+// set. The lock is refreshed every third of staleAfter until it is released.
+func acquireLock(cacheFile string, staleAfter time.Duration, steal bool) (*cacheLock, error) {
+	host, _ := os.Hostname()
+	l := &cacheLock{
+		fileName:   cacheLockFile(cacheFile),
+		owner:      lockOwner{Host: host, PID: os.Getpid(), Since: time.Now().UTC()},
+		staleAfter: staleAfter,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+
+	holder, age, err := readLock(l.fileName)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	case age < staleAfter && !steal:
+		return nil, fmt.Errorf("%w: %s, refreshed %s ago, pass -steal-lock to take it over", errLockHeld, holder, age.Round(time.Second))
+	case age < staleAfter:
+		logf("taking over the cache lock of %s\n", holder)
+	default:
+		logf("taking over the cache lock of %s, not refreshed for %s\n", holder, age.Round(time.Second))
+	}
+
+	if err := l.write(); err != nil {
+		return nil, err
+	}
+	// of two runs taking the lock at once, the last to write it holds it
+	if err := l.check(); err != nil {
+		return nil, err
+	}
+	go l.refresh()
+	return l, nil
+}
+
+// readLock returns the owner of a lock file and the time since it was last
+// refreshed.
+func readLock(fileName string) (lockOwner, time.Duration, error) {
+	var owner lockOwner
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return owner, 0, err
+	}
+	bb, err := os.ReadFile(fileName)
+	if err != nil {
+		return owner, 0, fmt.Errorf("error reading the cache lock: %v", err)
+	}
+	if err := json.Unmarshal(bb, &owner); err != nil {
+		return owner, 0, fmt.Errorf("error parsing the cache lock %s: %v", fileName, err)
+	}
+	return owner, time.Since(info.ModTime()), nil
+}
+
+// write replaces the lock file with one naming the run, through a renamed
+// temporary file so the lock is never read half written.
+func (l *cacheLock) write() error {
+	bb, err := json.Marshal(l.owner)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(l.fileName), ".pkgstats-lock-*")
+	if err != nil {
+		return fmt.Errorf("error creating the cache lock: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bb); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing the cache lock: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error closing the cache lock: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), l.fileName); err != nil {
+		return fmt.Errorf("error replacing the cache lock: %v", err)
+	}
+	return nil
+}
+
+// check returns an error when the run doesn't hold the lock anymore, as
+// another run took it over. The cache must not be written then.
+func (l *cacheLock) check() error {
+	if l == nil {
+		return nil
+	}
+	holder, _, err := readLock(l.fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("the cache lock %s was removed by another run", l.fileName)
+	}
+	if err != nil {
+		return err
+	}
+	if holder != l.owner {
+		return fmt.Errorf("the cache lock was taken over by %s", holder)
+	}
+	return nil
+}
+
+// refresh touches the lock file every third of staleAfter until the lock is
+// released or taken over.
+func (l *cacheLock) refresh() {
+	defer close(l.done)
+	ticker := time.NewTicker(max(l.staleAfter/3, time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			if err := l.check(); err != nil {
+				logf("warning: %v, the results of this run won't be saved\n", err)
+				return
+			}
+			now := time.Now()
+			if err := os.Chtimes(l.fileName, now, now); err != nil {
+				logf("error refreshing the cache lock: %v\n", err)
+			}
+		}
+	}
+}
+
+// release stops refreshing the lock and removes it, unless another run took
+// it over.
+func (l *cacheLock) release() {
+	if l == nil {
+		return
+	}
+	close(l.stop)
+	<-l.done
+	if l.check() != nil {
+		return
+	}
+	if err := os.Remove(l.fileName); err != nil {
+		logf("error removing the cache lock: %v\n", err)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeOtherLock writes the lock of a run on another host, last refreshed
+// age ago.
+func writeOtherLock(t *testing.T, cacheFile string, age time.Duration) {
+	t.Helper()
+	bb, err := json.Marshal(lockOwner{Host: "other-host", PID: 42, Since: time.Now().Add(-time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileName := cacheLockFile(cacheFile)
+	if err := os.WriteFile(fileName, bb, 0644); err != nil {
+		t.Fatal(err)
+	}
+	refreshed := time.Now().Add(-age)
+	if err := os.Chtimes(fileName, refreshed, refreshed); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAcquireLock(t *testing.T) {
+	tests := []struct {
+		name    string
+		age     time.Duration
+		steal   bool
+		wantErr bool
+	}{
+		{name: "fresh", age: time.Minute, wantErr: true},
+		{name: "stolen", age: time.Minute, steal: true},
+		{name: "stale", age: time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheFile := filepath.Join(t.TempDir(), "zap.csv")
+			writeOtherLock(t, cacheFile, tt.age)
+
+			lock, err := acquireLock(cacheFile, 10*time.Minute, tt.steal)
+			if tt.wantErr {
+				if !errors.Is(err, errLockHeld) || !strings.Contains(err.Error(), "other-host, pid 42") {
+					t.Errorf("error %v, want the lock held by other-host", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := lock.check(); err != nil {
+				t.Errorf("lock not held after taking it over: %v", err)
+			}
+			lock.release()
+			if _, err := os.Stat(cacheLockFile(cacheFile)); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("lock left after its release: %v", err)
+			}
+		})
+	}
+}
+
+// TestLockTakenOver checks that a run whose lock was taken over stops
+// writing the cache and leaves the lock of the other run alone.
+func TestLockTakenOver(t *testing.T) {
+	cacheFile := filepath.Join(t.TempDir(), "zap.csv")
+	lock, err := acquireLock(cacheFile, 10*time.Minute, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &logStore{fileName: cacheFile, lock: lock}
+	if err := store.appendResult(repoResult{name: "a/one", used: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	writeOtherLock(t, cacheFile, 0)
+	if err := store.appendResult(repoResult{name: "a/two", used: true}); err == nil || !strings.Contains(err.Error(), "taken over by other-host") {
+		t.Errorf("append error %v, want the lock taken over", err)
+	}
+	if err := (&fileStore{fileName: cacheFile, lock: lock}).save(context.Background(), nil); err == nil {
+		t.Error("cache saved without the lock")
+	}
+	lock.release()
+	if _, err := os.Stat(cacheLockFile(cacheFile)); err != nil {
+		t.Errorf("lock of the other run removed: %v", err)
+	}
+
+	results := make(map[string]repoResult)
+	if _, _, err := replayLog(cacheLogFile(cacheFile), results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Errorf("log holds %d results, want the one appended with the lock", len(results))
+	}
+}
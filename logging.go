@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logOutput receives the progress messages. It is stderr so that stdout only
+// ever carries data and can be piped.
+var logOutput io.Writer = os.Stderr
+
+// logFile additionally receives every progress message as a JSON line when
+// -log-file is set.
+var logFile *rotatingFile
+
+// closeLogFile closes the log file of -log-file, the messages logged after
+// only go to logOutput. It must be called once nothing else logs anymore.
+func closeLogFile() {
+	if logFile == nil {
+		return
+	}
+	if err := logFile.Close(); err != nil {
+		fmt.Fprintf(logOutput, "error closing the log file: %v\n", err)
+	}
+	logFile = nil
+}
+
+func logf(format string, a ...any) {
+	logMessage(fmt.Sprintf(format, a...))
+}
+
+func logln(a ...any) {
+	logMessage(fmt.Sprintln(a...))
+}
+
+func logMessage(msg string) {
+	fmt.Fprint(logOutput, msg)
+
+	if logFile != nil {
+		line, _ := json.Marshal(struct {
+			Time    time.Time `json:"time"`
+			Message string    `json:"msg"`
+		}{
+			Time:    time.Now().UTC(),
+			Message: strings.TrimRight(msg, "\n"),
+		})
+		// a failing log file must not stop the run
+		_, _ = logFile.Write(append(line, '\n'))
+	}
+}
+
+// rotatingFile is a log file that is rotated once it grows past maxSize.
+// The rotated files are named path.1 (newest) to path.<keep> (oldest).
+// It is safe for concurrent use.
+type rotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	keep    int
+	file    *os.File
+	size    int64
+}
+
+func openRotatingFile(path string, maxSize int64, keep int) (*rotatingFile, error) {
+	r := &rotatingFile{
+		path:    path,
+		maxSize: maxSize,
+		keep:    keep,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	r.file = file
+	r.size = info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the existing files by one, dropping the oldest, and starts a
+// new file. It must be called with the lock held.
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+
+	for i := r.keep - 1; i >= 1; i-- {
+		from := fmt.Sprintf("%s.%d", r.path, i)
+		if _, err := os.Stat(from); err == nil {
+			if err := os.Rename(from, fmt.Sprintf("%s.%d", r.path, i+1)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if r.keep > 0 {
+		if err := os.Rename(r.path, r.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(r.path); err != nil {
+		return err
+	}
+
+	return r.open()
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.file.Close()
+}
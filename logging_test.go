@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	line := strings.Repeat("x", 29) + "\n"
+	tests := []struct {
+		name      string
+		keep      int
+		lines     int
+		wantFiles []string
+	}{
+		{name: "under the limit", keep: 2, lines: 3, wantFiles: []string{"run.log"}},
+		{name: "one rotation", keep: 2, lines: 5, wantFiles: []string{"run.log", "run.log.1"}},
+		{name: "oldest dropped", keep: 2, lines: 12, wantFiles: []string{"run.log", "run.log.1", "run.log.2"}},
+		{name: "nothing kept", keep: 0, lines: 12, wantFiles: []string{"run.log"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			r, err := openRotatingFile(filepath.Join(dir, "run.log"), 100, tt.keep)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for range tt.lines {
+				if _, err := r.Write([]byte(line)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := r.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var files []string
+			for _, entry := range entries {
+				files = append(files, entry.Name())
+				info, err := entry.Info()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Size() > 100 {
+					t.Errorf("%s is %d bytes, over the limit", entry.Name(), info.Size())
+				}
+			}
+			if strings.Join(files, ",") != strings.Join(tt.wantFiles, ",") {
+				t.Errorf("files %v, want %v", files, tt.wantFiles)
+			}
+		})
+	}
+}
+
+func TestRotatingFileConcurrent(t *testing.T) {
+	const writers, lines = 8, 50
+	dir := t.TempDir()
+	// enough files are kept to find every line again
+	r, err := openRotatingFile(filepath.Join(dir, "run.log"), 1024, writers*lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range lines {
+				fmt.Fprintf(r, "writer %d line %03d\n", w, i)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "run.log*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) < 2 {
+		t.Fatalf("%d files, want the log rotated", len(files))
+	}
+	seen := make(map[string]bool)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) > 1024 {
+			t.Errorf("%s is %d bytes, over the limit", file, len(data))
+		}
+		for _, l := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+			var w, i int
+			if _, err := fmt.Sscanf(l, "writer %d line %d", &w, &i); err != nil {
+				t.Fatalf("torn line %q in %s", l, file)
+			}
+			seen[l] = true
+		}
+	}
+	if len(seen) != writers*lines {
+		t.Errorf("%d lines found, want %d", len(seen), writers*lines)
+	}
+}
+
+func TestCloseLogFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pkgstats.log")
+	var err error
+	logFile, err = openRotatingFile(path, 1<<20, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logln("Graceful shutdown complete.")
+	closeLogFile()
+	logln("after the close")
+
+	bb, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(bb), "Graceful shutdown complete.") || strings.Contains(string(bb), "after the close") {
+		t.Errorf("log file holds:\n%s", bb)
+	}
+}
@@ -2,20 +2,19 @@ package main
 
 import (
 	"context"
-	"encoding/csv"
 	"errors"
 	"flag"
 	"fmt"
 	"github.com/google/go-github/v63/github"
 	"github.com/samber/lo"
-	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
 	"golang.org/x/oauth2"
-	"io"
 	"log"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -25,351 +24,1061 @@ import (
 func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
+	// the log file is closed after the last message, the shutdown one
+	defer closeLogFile()
 
 	var wg sync.WaitGroup
+	done := make(chan struct{})
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
+		defer close(done)
 		if err := run(ctx); err != nil {
 			log.Fatalf("error: %v", err)
 		}
 	}()
 
 	// Wait for the application to finish
-	<-ctx.Done()
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+	}
 
 	// Signal received, perform cleanup
-	fmt.Println("Received shutdown signal, stopping search...")
+	logln("Received shutdown signal, stopping search...")
 
 	// Wait for the goroutine to finish
 	wg.Wait()
 
 	// Perform any final cleanup or resource release here
-	fmt.Println("Graceful shutdown complete.")
+	logln("Graceful shutdown complete.")
 }
 
 func run(ctx context.Context) error {
+	paths = resolvePaths()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "paths":
+			return printPaths(os.Stdout, paths)
+		case "init":
+			return runInit(ctx, os.Args[2:])
+		case "doctor":
+			return runDoctor(ctx, os.Args[2:])
+		case "cache":
+			return runCache(os.Args[2:])
+		case "enrich":
+			return runEnrich(ctx, os.Args[2:])
+		case "enumerate":
+			return runEnumerate(ctx, os.Args[2:])
+		case "inspect":
+			return runInspect(ctx, os.Args[2:])
+		case "schema":
+			return runSchema(os.Args[2:])
+		}
+	}
+
 	var (
-		packageName string
-		githubToken string
+		packageName  string
+		pkgOwner     string
+		githubToken  string
+		baselineFile string
+		maxDropPct   float64
+		outputFormat string
+		outputFile   string
+		outputDir    string
+		fieldNames   string
+		granularity  string
+		perPage      int
+		notesFile    string
+		dependents   bool
+		depMaxPages  int
+		reportTmpl   string
+		reportJSON   string
+		classifyMods bool
+		pushgateway  string
+		strict       bool
+		notifyPolicy string
+		awesomeList  string
+		orgs         stringList
+		mustConfirm  bool
+		minConf      string
+		minVersion   string
+		anonymize    bool
+		anonMinStars int
+		anonSalt     string
+		branch       string
+		logPath      string
+		logMaxSize   int64
+		logKeep      int
+		checkVendor  bool
+		checkGoSum   bool
+		maxPages     int
+		readOnly     bool
+		cacheLog     bool
+		cacheLogMax  int64
+		cacheLogAge  time.Duration
+		lockStale    time.Duration
+		stealLock    bool
+		cacheURL     string
+		fileName     string
+		starSweep    string
+		schemaDump   bool
+		maxRPS       float64
+		searchRPS    float64
+		downloadRPS  float64
+		withMirrors  bool
+		maxGoMods    int
+		maxIdle      time.Duration
+		youngWindow  time.Duration
+		youngTTL     time.Duration
+		createdAfter string
+		verifyImport bool
+		filterExpr   string
+		backfill     bool
+		enrich       bool
+		sortKey      string
+		tiebreak     string
+		timingOut    string
+		validate     bool
+		fix          bool
+		outreachTmpl string
+		outreachDir  string
+		outreachTgt  string
+		historyKeep  int
+		reqBudget    int
+		normalizeMod bool
+		otelEndpoint string
+		usageFiles   bool
+		usageMax     int
+		testUsage    bool
+		withTestOnly bool
+		maxGoModSize int64
+		nearMissDist int
+		skipSlower   time.Duration
+		sinceVersion string
+		starsMin     int
+		starsMax     int
+		compareHosts bool
+		bandDelay    time.Duration
+		assumeYes    bool
+		dryRun       bool
 	)
 
 	// get package name as flag
-	flag.StringVar(&packageName, "pkg", "", "package name to search for")
+	flag.StringVar(&packageName, "pkg", "", "package name to search for, ending in /... for a module and the modules nested in it, - to read the packages from stdin, one per line")
+	flag.BoolVar(&normalizeMod, "normalize-module-path", false, "replace a -pkg that is a package inside a module with the module, looked up on the module proxy")
+	flag.StringVar(&pkgOwner, "pkg-owner", "", "organization whose Go modules to search adopters of, instead of -pkg")
+	flag.BoolVar(&dryRun, "dry-run", false, "print the scan plan, with the number of candidate repositories, and exit")
+	flag.BoolVar(&assumeYes, "yes", false, "don't ask for confirmation of the scan plan on a terminal")
 	flag.StringVar(&githubToken, "token", "", "GitHub access token for authentication")
+	flag.StringVar(&baselineFile, "baseline", "", "cache file to compare adoption against")
+	flag.Float64Var(&maxDropPct, "max-drop-pct", 10, "maximum allowed drop in adopters compared to the baseline, in percent")
+	flag.StringVar(&outputFormat, "output", "", "output format for the results: csv, json, table, shell, parquet or yaml")
+	flag.StringVar(&outputFile, "output-file", "-", "file to write the output to, - for stdout")
+	flag.StringVar(&outputDir, "output-dir", "", "directory to write the output of every package to, in a file named after the package, e.g. with pkg -")
+	flag.StringVar(&fileName, "cache-file", "", "cache file to use instead of <pkg>.csv in the state directory (see pkgstats paths), - to read it from stdin and write it to stdout")
+	flag.IntVar(&historyKeep, "history-keep", 20, "number of result changes kept per repository in the <pkg>.history.csv next to the cache, 0 for no limit")
+	flag.BoolVar(&readOnly, "read-only-cache", false, "read the existing cache without updating it, results are only written to the output")
+	flag.BoolVar(&cacheLog, "cache-log", false, "append results to <pkg>.log next to the cache as they are found, compacted into the cache by size or age")
+	flag.Int64Var(&cacheLogMax, "cache-log-max-bytes", 10<<20, "size over which the cache log is compacted into the cache, 0 for no limit")
+	flag.DurationVar(&cacheLogAge, "cache-log-max-age", 24*time.Hour, "age of the cache over which the cache log is compacted into it, 0 for no limit")
+	flag.DurationVar(&lockStale, "lock-stale-after", 10*time.Minute, "age of the lock of another run on the cache over which it is taken over")
+	flag.BoolVar(&stealLock, "steal-lock", false, "take over the lock of another run on the cache even when it is fresh, that run stops saving")
+	flag.StringVar(&cacheURL, "cache-url", "", "bucket to keep the cache in instead of the state directory, s3://bucket/prefix or gs://bucket/prefix")
+	flag.StringVar(&notesFile, "notes", "", "CSV file with repository,note rows to merge into the output")
+	flag.StringVar(&branch, "branch", "", "branch to read go.mod files from instead of the default branch")
+	flag.BoolVar(&withMirrors, "include-mirrors", false, "check repositories that look like mirrors instead of skipping them")
+	flag.StringVar(&createdAfter, "created-after", "", "only count repositories created on or after this date, YYYY-MM-DD or RFC 3339")
+	flag.DurationVar(&youngWindow, "young-repo-window", 30*24*time.Hour, "repositories created or pushed more recently have their root go.mod checked when the code search finds nothing, 0 to disable")
+	flag.DurationVar(&youngTTL, "young-repo-ttl", 3*24*time.Hour, "time after which a negative result of a young repository is checked again")
+	flag.DurationVar(&maxIdle, "max-idle-time", 0, "stop the run, saving the results so far, when no repository was processed for this long, 0 for no limit")
+	flag.IntVar(&maxGoMods, "max-gomod-per-repo", 50, "maximum number of go.mod files checked per repository, the shallowest first, 0 for no limit")
+	flag.Int64Var(&maxGoModSize, "max-gomod-bytes", 1<<20, "size in bytes over which a go.mod file is skipped instead of downloaded and parsed, 0 for no limit")
+	flag.DurationVar(&skipSlower, "skip-slower-than", 0, "skip the repositories due for a check whose previous scan took longer, marking them skipped (slow), 0 to check them all")
+	flag.IntVar(&nearMissDist, "near-miss-distance", 0, "report the requirements of the checked go.mod files within this edit distance of the package, e.g. typos or old paths, 0 to disable")
+	flag.BoolVar(&verifyImport, "verify-imports", false, "search the source of repositories requiring the package as indirect for imports of it, costs a code search per such repository")
+	flag.BoolVar(&usageFiles, "usage-files", false, "count the Go files of every adopter importing the package, costs a code search per adopter")
+	flag.BoolVar(&testUsage, "classify-test-usage", false, "check whether adopters import the package in _test.go files only, costs a code search per adopter")
+	flag.BoolVar(&withTestOnly, "include-test-only", false, "count the adopters importing the package in tests only, see -classify-test-usage, as adopters in the summaries")
+	flag.IntVar(&usageMax, "usage-files-max", 200, "maximum number of code searches of -usage-files in a run")
+	flag.BoolVar(&checkVendor, "check-vendor", false, "check whether adopters vendor the package, costs an extra request per adopter")
+	flag.BoolVar(&checkGoSum, "check-gosum", false, "read the go.sum of adopters for the versions it locks and flag the ones contradicting the go.mod, costs an extra request per adopter")
+	flag.BoolVar(&classifyMods, "classify-modules", true, "classify matches as main, nested or test module by the go.mod path")
+	flag.StringVar(&awesomeList, "candidates-awesome", "", "URL or file of an awesome-list whose GitHub repositories are checked instead of searching")
+	flag.Var(&orgs, "org", "organization whose Go repositories are checked instead of searching, can be repeated")
+	flag.BoolVar(&mustConfirm, "require-confirmed", false, "only count and output results verified by parsing a go.mod file, the same as min-confidence high")
+	flag.StringVar(&minVersion, "require-min-version", "", "version, e.g. v1.2.0, that adopters are classified against in the meets_min_version field and the summary")
+	flag.StringVar(&minConf, "min-confidence", "", "only count and output results of at least this confidence: high, medium or low")
+	flag.BoolVar(&anonymize, "anonymize", false, "replace the names of small repositories with pseudonyms and strip URLs in the output")
+	flag.IntVar(&anonMinStars, "anonymize-min-stars", 10000, "star count from which repositories keep their name when anonymizing")
+	flag.StringVar(&anonSalt, "anonymize-salt", "", "salt for the pseudonyms, keep it to get the same pseudonyms across reports")
+	flag.BoolVar(&dependents, "dependents", false, "also collect adopters from the GitHub dependents graph of the package")
+	flag.IntVar(&depMaxPages, "dependents-max-pages", 10, "maximum number of dependents pages to fetch, 0 for no limit")
+	flag.StringVar(&logPath, "log-file", "", "file to also write the log to as JSON lines")
+	flag.StringVar(&otelEndpoint, "otel-endpoint", "", "OTLP/HTTP endpoint, e.g. http://localhost:4318, to export a trace of the run to, needs a binary built with -tags otel")
+	flag.StringVar(&timingOut, "timing-out", "", "CSV file to write the duration of every search, download, parse and sleep to")
+	flag.Int64Var(&logMaxSize, "log-max-size", 10<<20, "size in bytes after which the log file is rotated")
+	flag.IntVar(&logKeep, "log-keep", 5, "number of rotated log files to keep")
+	flag.StringVar(&pushgateway, "pushgateway-url", "", "Prometheus pushgateway URL to push the run metrics to")
+	flag.BoolVar(&strict, "strict", false, "fail the run when pushing metrics fails, same as -notify-policy retry-then-fail")
+	flag.StringVar(&notifyPolicy, "notify-policy", notifyWarn, "what to do when pushing metrics fails: warn, retry-then-fail or queue to send them again on the next run")
+	flag.IntVar(&starsMin, "min-stars", 1001, "search the repositories with at least this many stars")
+	flag.IntVar(&starsMax, "max-stars", 0, "search the repositories with at most this many stars, 0 for no limit")
+	flag.StringVar(&starSweep, "star-sweep", "", "comma separated increasing star bounds, e.g. 1000,5000,20000, to search band by band from the most starred")
+	flag.DurationVar(&bandDelay, "star-sweep-delay", 0, "pause between two star bands of -star-sweep, to stay clear of the secondary rate limits")
+	flag.IntVar(&maxPages, "max-pages", 0, "maximum number of repository search pages to fetch, 0 for no limit")
+	flag.IntVar(&perPage, "per-page", maxPerPage, "number of repositories per search page, at most 100")
+	flag.BoolVar(&compareHosts, "compare-hosts", false, "print the adopters and their reach per hosting forge")
+	flag.StringVar(&reportTmpl, "report-template", "", "Go text/template file to render a report with, written to -output-file")
+	flag.StringVar(&reportJSON, "report-data-json", "", "file to dump the report data model to as JSON")
+	flag.StringVar(&outreachTmpl, "outreach-template", "", "Go text/template file to render a message with for every adopter of an outdated version")
+	flag.StringVar(&outreachDir, "outreach-dir", "outreach", "directory to write the outreach messages to, one owner-repo.md file per adopter")
+	flag.StringVar(&sinceVersion, "since-version", "", "version, e.g. v1.2.0, to print the adoption funnel of: adopters on it or later, behind it and on no tagged release")
+	flag.StringVar(&outreachTgt, "outreach-target", "", "version to suggest upgrading to in outreach messages, the latest version in use by default")
+	flag.StringVar(&sortKey, "sort", "stars", "field to sort the output by, descending: stars, size or dependency-share")
+	flag.StringVar(&tiebreak, "tiebreak", "name", "order of results with equal stars: name, pushed (most recent first) or forks")
+	flag.StringVar(&filterExpr, "filter", "", `only output results matching the expression, e.g. 'used && stars > 5000 && version startsWith "v1."'`)
+	flag.StringVar(&granularity, "granularity", granularityRepo, "output one row per repository (repo) or per go.mod requiring the package (module)")
+	flag.StringVar(&fieldNames, "fields", strings.Join(defaultFields, ","), "comma separated list of fields to output")
+
+	flag.IntVar(&reqBudget, "request-budget", 0, "maximum number of GitHub API requests of the run, it stops and saves the results so far once they are spent, 0 for no limit")
+	flag.Float64Var(&maxRPS, "max-rps", 0, "maximum GitHub API requests per second across the whole run, 0 for no limit")
+	flag.Float64Var(&searchRPS, "max-search-rps", 0, "maximum search requests per second, 0 for no limit")
+	flag.Float64Var(&downloadRPS, "max-download-rps", 0, "maximum content download and other non-search requests per second, 0 for no limit")
+	flag.BoolVar(&schemaDump, "schema-dump", false, "print the cache and output schema and exit")
+	flag.BoolVar(&backfill, "backfill-stars", false, "fill in the stars of cached repositories without any instead of searching")
+	flag.BoolVar(&enrich, "enrich", false, "after searching, fetch the stars and metadata of results without stars, e.g. from -dependents")
+	flag.BoolVar(&validate, "validate-cache", false, "same as pkgstats cache verify: check the cache of -pkg or -cache-file for malformed rows, duplicates and out of range values and exit")
+	flag.BoolVar(&fix, "fix", false, "with -validate-cache, same as -repair of pkgstats cache verify")
 
 	flag.Parse()
 
+	if schemaDump {
+		return dumpSchema(os.Stdout)
+	}
+
+	if validate {
+		return verifyCache(packageName, fileName, fix)
+	}
+
+	if pkgOwner != "" {
+		if packageName != "" {
+			return fmt.Errorf("pkg and pkg-owner can't be used together")
+		}
+		if dependents {
+			return fmt.Errorf("dependents and pkg-owner can't be used together")
+		}
+		packageName = ownerPackage(pkgOwner)
+	}
+
 	if packageName == "" || githubToken == "" {
 		return fmt.Errorf("missing package name or GitHub access token")
 	}
 
-	// create a cache directory if it doesn't exist
-	_, err := os.Stat("cache")
-	if os.IsNotExist(err) {
-		err := os.Mkdir("cache", 0755)
+	if maxDropPct < 0 {
+		return fmt.Errorf("invalid value for max-drop-pct: %v", maxDropPct)
+	}
+
+	perPage = clampPerPage(perPage)
+	if maxRPS < 0 {
+		return fmt.Errorf("invalid value for max-rps: %v", maxRPS)
+	}
+	if searchRPS < 0 {
+		return fmt.Errorf("invalid value for max-search-rps: %v", searchRPS)
+	}
+	if downloadRPS < 0 {
+		return fmt.Errorf("invalid value for max-download-rps: %v", downloadRPS)
+	}
+	if maxPages < 0 {
+		return fmt.Errorf("invalid value for max-pages: %d", maxPages)
+	}
+	var createdCutoff time.Time
+	if createdAfter != "" {
+		var err error
+		createdCutoff, err = parseDate(createdAfter)
 		if err != nil {
-			return fmt.Errorf("error creating cache directory: %v", err)
+			return fmt.Errorf("invalid value for created-after: %v", err)
 		}
 	}
+	if bandDelay < 0 {
+		return fmt.Errorf("invalid value for star-sweep-delay: %v", bandDelay)
+	}
+	if maxIdle < 0 {
+		return fmt.Errorf("invalid value for max-idle-time: %v", maxIdle)
+	}
+	if maxGoMods < 0 {
+		return fmt.Errorf("invalid value for max-gomod-per-repo: %d", maxGoMods)
+	}
+	if skipSlower < 0 {
+		return fmt.Errorf("invalid value for skip-slower-than: %v", skipSlower)
+	}
+	if nearMissDist < 0 {
+		return fmt.Errorf("invalid value for near-miss-distance: %d", nearMissDist)
+	}
+	if maxGoModSize < 0 {
+		return fmt.Errorf("invalid value for max-gomod-bytes: %d", maxGoModSize)
+	}
+	if reqBudget < 0 {
+		return fmt.Errorf("invalid value for request-budget: %d", reqBudget)
+	}
+	if usageMax < 0 {
+		return fmt.Errorf("invalid value for usage-files-max: %d", usageMax)
+	}
+	if historyKeep < 0 {
+		return fmt.Errorf("invalid value for history-keep: %d", historyKeep)
+	}
 
-	filename := strings.ReplaceAll(packageName, "/", "-")
-	fileName := fmt.Sprintf("cache/%s.csv", filename)
+	if starsMin < 0 {
+		return fmt.Errorf("invalid value for min-stars: %d", starsMin)
+	}
+	if starsMax < 0 || (starsMax > 0 && starsMax < starsMin) {
+		return fmt.Errorf("invalid value for max-stars: %d, must be 0 or at least min-stars", starsMax)
+	}
+	// minStars is the lowest star count the repository search covers
+	minStars := starsMin
+	var sweepBands []string
+	if starSweep != "" {
+		starsSet := false
+		flag.Visit(func(f *flag.Flag) { starsSet = starsSet || f.Name == "min-stars" || f.Name == "max-stars" })
+		if starsSet {
+			return fmt.Errorf("star-sweep sets the star bands, min-stars and max-stars can't be used with it")
+		}
+		bounds, err := parseStarSweep(starSweep)
+		if err != nil {
+			return err
+		}
+		sweepBands = starBands(bounds)
+		minStars = bounds[0]
+	}
+	query := "language:go"
+	if !createdCutoff.IsZero() {
+		query += " created:>=" + createdCutoff.Format(time.RFC3339)
+	}
+	// queries are the repository searches of the run, one per star band
+	queries := []string{query + " " + starsQualifier(starsMin, starsMax)}
+	if sweepBands != nil {
+		queries = lo.Map(sweepBands, func(band string, _ int) string { return query + " " + band })
+	}
+	source := "repository-search"
+	switch {
+	case backfill:
+		source = "backfill-stars"
+	case awesomeList != "":
+		source = "awesome-list"
+	case len(orgs) > 0:
+		source = "org"
+	}
+	if source != "repository-search" {
+		queries = nil
+	}
 
-	file, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE, 0755)
+	fields, err := parseFields(fieldNames)
 	if err != nil {
-		return fmt.Errorf("error opening file: %v", err)
+		return err
+	}
+	var filter filterFunc
+	if filterExpr != "" {
+		if filter, err = parseFilter(filterExpr); err != nil {
+			return fmt.Errorf("invalid value for filter: %v", err)
+		}
 	}
-	defer file.Close()
 
-	// read csv file to check if the package has already been searched for
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
-	if err != nil {
-		return fmt.Errorf("error reading file: %v", err)
+	if _, ok := sortKeys[sortKey]; !ok {
+		return fmt.Errorf("invalid value for sort: %s", sortKey)
+	}
+	if _, ok := tiebreaks[tiebreak]; !ok {
+		return fmt.Errorf("invalid value for tiebreak: %s", tiebreak)
+	}
+	if mustConfirm {
+		if minConf != "" && minConf != confidenceHigh {
+			return fmt.Errorf("require-confirmed is min-confidence high, it can't be used with min-confidence %s", minConf)
+		}
+		minConf = confidenceHigh
+	}
+	if minConf != "" {
+		if _, err := parseConfidence(minConf); err != nil {
+			return fmt.Errorf("invalid value for min-confidence: %v", err)
+		}
 	}
 
-	// create a map to store the cache
-	results := make(map[string]repoResult)
-	for _, record := range records {
-		stars, err := strconv.Atoi(record[2])
-		if err != nil {
-			return fmt.Errorf("invalid value for star count: %v", stars)
+	if minVersion != "" {
+		minVersion = normalizeVersion(minVersion)
+		if !semver.IsValid(minVersion) {
+			return fmt.Errorf("invalid value for require-min-version: %s is not a semver version", minVersion)
 		}
-		results[record[0]] = repoResult{
-			name:  record[0],
-			used:  record[1] == "true",
-			stars: stars,
+	}
+	if sinceVersion != "" {
+		sinceVersion = normalizeVersion(sinceVersion)
+		if !semver.IsValid(sinceVersion) {
+			return fmt.Errorf("invalid value for since-version: %s is not a semver version", sinceVersion)
 		}
 	}
 
-	// Set up GitHub client with authentication
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: githubToken},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-	client := github.NewClient(tc)
+	if !lo.Contains(granularities, granularity) {
+		return fmt.Errorf("invalid value for granularity: %s", granularity)
+	}
 
-	// For debugging
-	//tc := &oauth2.Transport{Source: ts, Base: dbg.New()}
-	//client := github.NewClient(&http.Client{Transport: tc})
+	if outputFormat != "" && !lo.Contains(outputFormats, outputFormat) {
+		return fmt.Errorf("invalid value for output: %s", outputFormat)
+	}
 
-	// Create a search result object
-	s := newSearchResult(packageName, client, results)
-	newResults, err := s.Search(
-		ctx,
-		"language:go stars:>1000",
-		&github.SearchOptions{
-			Sort:  "stars",
-			Order: "desc",
-			ListOptions: github.ListOptions{
-				PerPage: 50,
-			},
-		},
-	)
-	if err != nil {
-		return fmt.Errorf("error searching: %v", err)
+	if outputFormat != "" && reportTmpl != "" {
+		return fmt.Errorf("output and report-template can't be used together")
+	}
+	if awesomeList != "" && len(orgs) > 0 {
+		return fmt.Errorf("candidates-awesome and org can't be used together")
+	}
+	if backfill && (awesomeList != "" || len(orgs) > 0) {
+		return fmt.Errorf("backfill-stars doesn't search, it can't be used with candidates-awesome or org")
 	}
 
-	// merge the results
-	for repo, repoResult := range newResults {
-		if _, ok := results[repo]; !ok {
-			results[repo] = repoResult
+	if logPath != "" {
+		if logMaxSize <= 0 || logKeep < 0 {
+			return fmt.Errorf("invalid log rotation settings: log-max-size %d, log-keep %d", logMaxSize, logKeep)
 		}
+		logFile, err = openRotatingFile(logPath, logMaxSize, logKeep)
+		if err != nil {
+			return fmt.Errorf("error opening log file: %v", err)
+		}
+		logf("writing the log to %s\n", logPath)
 	}
 
-	// turn map into slice and sort it by star counts descending order
-	sortedResults := lo.MapToSlice(results, func(k string, v repoResult) repoResult {
-		return v
-	})
+	if !lo.Contains(notifyPolicies, notifyPolicy) {
+		return fmt.Errorf("invalid value for notify-policy: %s", notifyPolicy)
+	}
+	if strict {
+		notifyPolicy = notifyRetryThenFail
+	}
+	// notifications left over by previous runs go first, before newer ones,
+	// a dry run leaves them queued
+	queue := &notificationQueue{path: paths.notifyQueue()}
+	if dryRun {
+		if pending, _ := queue.pending(); len(pending) > 0 {
+			logf("dry run, not sending the %d queued notifications\n", len(pending))
+		}
+	} else if err := queue.replay(ctx); err != nil {
+		logf("%v\n", err)
+	}
 
-	// Sort the slice by the Value field
-	sort.Slice(sortedResults, func(i, j int) bool {
-		return sortedResults[i].stars > sortedResults[j].stars
-	})
+	if anonymize && anonSalt == "" {
+		return fmt.Errorf("anonymize requires an anonymize-salt")
+	}
 
-	// replace the file with the new cache
-	err = file.Truncate(0)
-	if err != nil {
-		return fmt.Errorf("error truncating file: %v", err)
+	// load the baseline up front so a bad path fails before searching
+	var baseline map[string]repoResult
+	if baselineFile != "" {
+		var err error
+		baseline, err = loadBaseline(baselineFile)
+		if err != nil {
+			return fmt.Errorf("error reading baseline: %v", err)
+		}
 	}
-	fmt.Printf("truncated the file: %s\n", fileName)
 
-	_, err = file.Seek(0, 0)
-	if err != nil {
-		return fmt.Errorf("error seeking file: %v", err)
+	var notes map[string]string
+	if notesFile != "" {
+		notes, err = loadNotes(notesFile)
+		if err != nil {
+			return fmt.Errorf("error reading notes: %v", err)
+		}
 	}
-	fmt.Printf("seeked to the beginning of the file: %s\n", fileName)
 
-	writer := csv.NewWriter(file)
+	if outputFile != "-" && (outputFormat != "" || reportTmpl != "") {
+		if err := checkWritable(filepath.Dir(outputFile)); err != nil {
+			return fmt.Errorf("error checking the output directory: %v", err)
+		}
+	}
 
-	for _, repoResult := range sortedResults {
-		foundStr := "false"
-		if repoResult.used {
-			foundStr = "true"
+	if readOnly && outputFormat == "" && reportTmpl == "" {
+		return fmt.Errorf("read-only-cache requires output or report-template to write the results to")
+	}
+	if cacheLog && fileName == "-" {
+		return fmt.Errorf("cache-log can't be used with a cache read from stdin")
+	}
+	var cacheBucket *url.URL
+	if cacheURL != "" {
+		if fileName == "-" {
+			return fmt.Errorf("cache-url can't be used with a cache read from stdin")
 		}
-		err := writer.Write([]string{repoResult.name, foundStr, strconv.Itoa(repoResult.stars)})
-		if err != nil {
-			return fmt.Errorf("error writing to file: %v", err)
+		if cacheLog {
+			return fmt.Errorf("cache-url and cache-log can't be used together")
+		}
+		if cacheBucket, err = parseCacheURL(cacheURL); err != nil {
+			return err
 		}
 	}
-	fmt.Printf("wrote to the file: %s\n", fileName)
-	writer.Flush()
-	fmt.Printf("flushed the writer\n")
-	return nil
-}
+	if cacheLogMax < 0 {
+		return fmt.Errorf("invalid value for cache-log-max-bytes: %d", cacheLogMax)
+	}
+	if cacheLogAge < 0 {
+		return fmt.Errorf("invalid value for cache-log-max-age: %s", cacheLogAge)
+	}
+	if lockStale <= 0 {
+		return fmt.Errorf("invalid value for lock-stale-after: %s", lockStale)
+	}
 
-type repoResult struct {
-	name  string
-	used  bool
-	stars int
-}
+	var budget *requestBudget
+	if reqBudget > 0 {
+		budget = newRequestBudget(reqBudget)
+	}
+	client := newClient(ctx, githubToken, rateLimits{all: maxRPS, search: searchRPS, download: downloadRPS, budget: budget})
 
-type searchResult struct {
-	client          *github.Client
-	cache           map[string]repoResult
-	packageName     string
-	paginationDelay time.Duration
-	searchDelay     time.Duration
-}
+	batch := packageName == "-"
+	if outputDir != "" {
+		if outputFile != "-" {
+			return fmt.Errorf("output-dir and output-file can't be used together")
+		}
+		if outputFormat == "" && reportTmpl == "" {
+			return fmt.Errorf("output-dir requires output or report-template")
+		}
+		if !dryRun {
+			if err := os.MkdirAll(outputDir, 0755); err != nil {
+				return fmt.Errorf("error creating the output directory: %v", err)
+			}
+			if err := checkWritable(outputDir); err != nil {
+				return fmt.Errorf("error checking the output directory: %v", err)
+			}
+		}
+	}
+	if batch {
+		if fileName != "" {
+			return fmt.Errorf("pkg - reads the packages from stdin, each has its own cache, cache-file can't be used")
+		}
+		if outputFile != "-" {
+			return fmt.Errorf("pkg - writes one output per package, use output-dir instead of output-file")
+		}
+		if outputDir == "" && !streamable(outputFormat, reportTmpl) {
+			return fmt.Errorf("pkg - writes one output per package, which can't follow each other on stdout as %s, use output-dir", outputFormat)
+		}
+		if reportJSON != "" {
+			return fmt.Errorf("pkg - writes one report per package, report-data-json can't be used")
+		}
+	}
+	// the packages of a batch share the listing of the candidate repositories
+	listings := newRepoListings()
+	// and the watchdog, as they take turns a package waits while the others
+	// check repositories
+	var progress *watchdog
+	if maxIdle > 0 {
+		progress = newWatchdog(maxIdle)
+	}
 
-func newSearchResult(packageName string, client *github.Client, results map[string]repoResult) *searchResult {
-	const (
-		defaultPaginationDelay = 7 * time.Second
-		defaultSearchDelay     = 7 * time.Second
-	)
+	scan := func(packageName string, yield func()) error {
+		start := time.Now()
+		fileName := fileName
+		// pkgInput is the -pkg as given, packageName may be normalized
+		pkgInput := packageName
+		if isWildcard(packageName) {
+			if outreachTmpl != "" || minVersion != "" || sinceVersion != "" {
+				return fmt.Errorf("%s matches several modules whose versions can't be compared, outreach-template, require-min-version and since-version need a single module", packageName)
+			}
+		} else if pkgOwner == "" && normalizeMod {
+			if root := normalizeModulePath(ctx, moduleProxy(), packageName); root != packageName {
+				logf("%s is a package of the module %s, searching for the module\n", packageName, root)
+				packageName = root
+			}
+		} else if pkgOwner == "" {
+			warnSubPath(packageName)
+		}
 
-	return &searchResult{
-		cache:           results,
-		client:          client,
-		packageName:     packageName,
-		paginationDelay: defaultPaginationDelay,
-		searchDelay:     defaultSearchDelay,
-	}
-}
+		outputFile := outputFile
+		if outputDir != "" {
+			outputFile = outputDirFile(outputDir, packageName, outputFormat, reportTmpl)
+		}
+
+		stdinCache := fileName == "-"
+		if stdinCache && outputFile == "-" && (outputFormat != "" || reportTmpl != "") {
+			return fmt.Errorf("cache-file and output-file can't both be stdin/stdout")
+		}
 
-func (s *searchResult) Search(ctx context.Context, query string, opts *github.SearchOptions) (map[string]repoResult, error) {
-	results := make(map[string]repoResult)
+		if fileName == "" {
+			fileName = defaultCacheFile(packageName)
 
-	for {
-		select {
-		case <-ctx.Done():
-			// Stop the search if the context is canceled
-			if errors.Is(ctx.Err(), context.Canceled) {
-				fmt.Println("context canceled, stopping Search...")
-				return results, nil
+			if !readOnly && !dryRun {
+				// create the state directory if it doesn't exist
+				if err := os.MkdirAll(paths.state, 0755); err != nil {
+					return fmt.Errorf("error creating cache directory: %v", err)
+				}
 			}
-			return results, ctx.Err()
+		}
 
+		if !readOnly && !stdinCache && !dryRun {
+			if hasLegacyCache(paths.state) {
+				logf("warning: %s holds results of an older version, run `pkgstats cache migrate` to move them to %s\n", legacyCacheDir, paths.state)
+			}
+			if err := checkWritable(filepath.Dir(fileName)); err != nil {
+				return fmt.Errorf("error checking the cache directory: %v (use -read-only-cache to only read it)", err)
+			}
+		}
+
+		// the plan goes before the cache is read, which creates a cache file
+		plan := scanPlan{
+			pkg:       pkgInput,
+			module:    packageName,
+			source:    source,
+			queries:   queries,
+			cacheFile: fileName,
+			store:     "file",
+			outputs:   planOutputs(outputFormat, outputFile, reportTmpl, reportJSON, outreachTmpl, outreachDir, pushgateway),
+		}
+		switch {
+		case stdinCache:
+			plan.cacheFile, plan.store = "stdin", "written to stdout"
+		case cacheBucket != nil:
+			plan.cacheFile, plan.store = strings.TrimSuffix(cacheURL, "/")+"/"+filepath.Base(fileName), "remote"
+		case cacheLog:
+			plan.store = "file, with a log"
+		}
+		if readOnly && !stdinCache {
+			plan.store += ", read-only"
+		}
+		interactive := askConfirmation(assumeYes, stdinCache, isTerminal(os.Stdin))
+		if dryRun || interactive {
+			plan.estimate = estimateCandidates(ctx, client, queries)
+		}
+		switch {
+		case dryRun:
+			return plan.write(os.Stdout)
+		case interactive:
+			if err := plan.write(os.Stderr); err != nil {
+				return err
+			}
+			if !confirmPlan(os.Stdin, os.Stderr) {
+				return fmt.Errorf("scan canceled")
+			}
 		default:
-			// Find matching repositories
-			repos, resp, err := s.client.Search.Repositories(ctx, query, opts)
+			logln("scan plan:")
+			plan.write(logOutput)
+		}
+
+		// read the cache to check if the package has already been searched for
+		var (
+			store   cacheStore
+			results = make(map[string]repoResult)
+		)
+		if stdinCache {
+			results, err = readCacheStream(os.Stdin)
 			if err != nil {
-				return results, fmt.Errorf("error searching repositories: %v", err)
+				return fmt.Errorf("error reading the cache from stdin: %v", err)
 			}
-
-			// Search in the repositories for the package usage
-			repoSearchResults, err := s.searchInRepositories(ctx, repos)
+		} else {
+			// a run writing a cache file locks it for its duration
+			var lock *cacheLock
+			if cacheBucket == nil && !readOnly {
+				if lock, err = acquireLock(fileName, lockStale, stealLock); err != nil {
+					return err
+				}
+				defer lock.release()
+			}
+			switch {
+			case cacheBucket != nil:
+				store = newRemoteStore(cacheBucket, fileName)
+			case cacheLog:
+				warnCacheIssues(fileName)
+				store = &logStore{fileName: fileName, maxBytes: cacheLogMax, maxAge: cacheLogAge, lock: lock}
+			default:
+				warnCacheIssues(fileName)
+				store = &fileStore{fileName: fileName, lock: lock}
+			}
+			results, err = store.load(ctx)
 			if err != nil {
-				fmt.Printf("error searching the repositories: %v\n", err)
-				continue
+				return err
 			}
+		}
 
-			// update results
-			for repo, found := range repoSearchResults {
-				results[repo] = found
+		// Collect the dependents before searching, they are merged after the
+		// search so the go.mod verified results take precedence
+		var dependentsResult map[string]repoResult
+		if dependents {
+			dependentsResult, err = dependentsResults(ctx, newGithubDependents(depMaxPages), packageName)
+			if err != nil {
+				logf("error fetching dependents: %v\n", err)
 			}
+			logf("found %d dependents of %s\n", len(dependentsResult), packageName)
+		}
 
-			if resp.NextPage == 0 {
-				break
+		// Create a search result object
+		s := newSearchResult(packageName, client, results)
+		s.listings = listings
+		s.yield = yield
+		s.classifyModules = classifyMods
+		s.branch = branch
+		s.checkVendor = checkVendor
+		s.checkGoSum = checkGoSum
+		s.countUsage = usageFiles
+		s.usageSearches = usageMax
+		s.classifyTestUsage = testUsage
+		s.includeMirrors = withMirrors
+		s.maxGoModsPerRepo = maxGoMods
+		s.maxGoModBytes = maxGoModSize
+		s.nearMissDistance = nearMissDist
+		s.skipSlowerThan = skipSlower
+		s.youngWindow = youngWindow
+		s.youngTTL = youngTTL
+		s.createdAfter = createdCutoff
+		s.verifyImports = verifyImport
+		s.maxPages = maxPages
+		s.bandDelay = bandDelay
+		if appender, ok := store.(resultAppender); ok && !readOnly {
+			s.onResult = func(result repoResult) {
+				if err := appender.appendResult(result); err != nil {
+					logf("error appending %s to the cache log: %v\n", result.name, err)
+				}
 			}
-
-			fmt.Printf("Sleeping for %d seconds in Search\n", int(s.paginationDelay.Seconds()))
-			if err := sleepWithContext(ctx, s.paginationDelay); err != nil {
-				fmt.Printf("Sleep was interrupted: %v\n", err)
+		}
+		if otelEndpoint != "" {
+			spans, err := startTracing(ctx, otelEndpoint, packageName)
+			if err != nil {
+				return fmt.Errorf("error starting the trace: %v", err)
 			}
-
-			opts.Page = resp.NextPage
-			fmt.Println("Searching next page: ", opts.Page)
+			defer shutdownTracing(ctx, spans)
+			s.timings.spans = spans
 		}
-	}
-}
-
-func sleepWithContext(ctx context.Context, duration time.Duration) error {
-	select {
-	case <-time.After(duration):
-		// Sleep completed
-		return nil
-	case <-ctx.Done():
-		// Context was canceled
-		return ctx.Err()
-	}
-}
-
-func (s *searchResult) searchInRepositories(ctx context.Context, repos *github.RepositoriesSearchResult) (map[string]repoResult, error) {
-	results := make(map[string]repoResult)
 
-	for _, repo := range repos.Repositories {
-		select {
-		case <-ctx.Done():
-			if errors.Is(ctx.Err(), context.Canceled) {
-				fmt.Println("context canceled, stopping Search...")
-				return results, nil
+		// the watchdog only stops the search, the results found so far are
+		// still saved
+		searchCtx, cancelSearch := context.WithCancelCause(ctx)
+		defer cancelSearch(nil)
+		if maxIdle > 0 {
+			s.progress = progress
+			s.progress.touch()
+			go s.progress.watch(searchCtx, cancelSearch)
+		}
+		budget.stopWith(cancelSearch)
+		if pkgOwner != "" {
+			if s.modules, err = s.ownerModules(searchCtx, pkgOwner); err != nil {
+				return fmt.Errorf("error listing the modules of %s: %v", pkgOwner, err)
 			}
-			return results, ctx.Err()
-
-		default:
-			if repo.GetArchived() || repo.GetDisabled() || repo.GetFork() {
-				fmt.Printf("Skipping arhived, disabled, forked repository: %s\n", repo.GetFullName())
-				continue
+		}
+		var (
+			newResults map[string]repoResult
+			m          = manifest{
+				Package:          packageName,
+				ToolVersion:      toolVersion(),
+				GitHubAPIVersion: githubAPIVersion,
+				CacheSchema:      cacheSchemaVersion,
+				OutputSchema:     outputSchemaVersion,
+				Source:           source,
+				Queries:          queries,
+				Flags:            effectiveFlags(),
+			}
+		)
+		if backfill {
+			newResults, err = s.Enrich(searchCtx, s.cache)
+		} else if awesomeList != "" {
+			newResults, err = s.SearchAwesome(searchCtx, awesomeList)
+		} else if len(orgs) > 0 {
+			newResults, err = s.SearchOrgs(searchCtx, orgs)
+		} else {
+			m.MinStars = minStars
+			if sweepBands == nil {
+				m.MaxStars = starsMax
 			}
+			opts := &github.SearchOptions{
+				Sort:  "stars",
+				Order: "desc",
+				ListOptions: github.ListOptions{
+					PerPage: perPage,
+				},
+			}
+			if sweepBands != nil {
+				newResults, err = s.SearchSweep(searchCtx, query, sweepBands, opts)
+			} else {
+				newResults, err = s.Search(searchCtx, queries[0], opts)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("error searching: %v", err)
+		}
 
-			if repoResult, ok := s.cache[repo.GetFullName()]; ok {
-				previousStateStr := "not found"
-				if repoResult.used {
-					previousStateStr = "found"
+		// merge the results, the changed ones are kept in the history
+		var (
+			transitions []transition
+			mergedAt    = time.Now().UTC()
+		)
+		for repo, repoResult := range newResults {
+			// cached repositories are only checked again when their cached
+			// result needs it, so a new result always replaces the cached one
+			if cached, ok := results[repo]; ok {
+				if t, changed := newTransition(mergedAt, cached, repoResult); changed {
+					transitions = append(transitions, t)
 				}
-				fmt.Printf("Skipping repository: %s previously %s\n", repo.GetFullName(), previousStateStr)
-				continue
 			}
+			results[repo] = repoResult
+		}
+		// a dependents result never replaces one the search verified, only
+		// the dependents result of an earlier run
+		for repo, repoResult := range dependentsResult {
+			if previous, ok := results[repo]; !ok || previous.source == sourceDependents {
+				results[repo] = repoResult
+			}
+		}
+		if enrich && !backfill {
+			enriched, err := s.Enrich(searchCtx, results)
+			if err != nil {
+				logf("error enriching the results: %v\n", err)
+			}
+			for repo, repoResult := range enriched {
+				if t, changed := newTransition(mergedAt, results[repo], repoResult); changed {
+					transitions = append(transitions, t)
+				}
+				results[repo] = repoResult
+			}
+		}
+		if len(orgs) > 0 {
+			for repo, repoResult := range results {
+				repoResult.org = repoOrg(repo, orgs)
+				results[repo] = repoResult
+			}
+		}
 
-			fmt.Printf("Checking repository: %s\n", repo.GetFullName())
+		// turn map into slice and sort it by star counts descending order
+		sortedResults := lo.MapToSlice(results, func(k string, v repoResult) repoResult {
+			return v
+		})
 
-			// perform another search to find the package in the repository
-			files, resp, err := s.client.Search.Code(
-				ctx,
-				fmt.Sprintf("%s repo:%s filename:go.mod", s.packageName, repo.GetFullName()),
-				&github.SearchOptions{
-					TextMatch: true,
-				},
-			)
-			if err != nil {
-				fmt.Printf("error searching repository: %s, error: %v\n", repo.GetFullName(), err)
-				continue
+		sortResults(sortedResults, tiebreak)
+
+		// replace the file with the new cache
+		if stdinCache {
+			if !readOnly {
+				if err := writeResults(os.Stdout, sortedResults); err != nil {
+					return fmt.Errorf("error writing the cache to stdout: %v", err)
+				}
 			}
+		} else if readOnly {
+			logf("read-only cache, not updating the file: %s\n", fileName)
+		} else if err := saveOrDump(ctx, store, sortedResults, os.Stderr); err != nil {
+			// stderr as stdout may already carry the output
+			return err
+		}
+		if !readOnly && !stdinCache {
+			if err := appendHistory(historyFile(fileName), transitions, historyKeep); err != nil {
+				logf("error writing the history: %v\n", err)
+			}
+		}
+		if errors.Is(context.Cause(searchCtx), errBudgetSpent) {
+			logf("the request budget of %d was spent, the results are partial\n", reqBudget)
+		}
+		if errors.Is(context.Cause(searchCtx), errIdle) {
+			return fmt.Errorf("%v (%s), stopped with %d results", errIdle, maxIdle, len(sortedResults))
+		}
 
-			fmt.Printf("searched repository: %s\n", repo.GetFullName())
-			fmt.Printf("HTTP status code: %d, total files: %d\n", resp.StatusCode, files.GetTotal())
+		// the cache keeps every result, the reports only the selected ones
+		reported := sortedResults
+		if minVersion != "" {
+			for i := range reported {
+				reported[i].minVersion = minVersion
+			}
+			for repo, r := range baseline {
+				r.minVersion = minVersion
+				baseline[repo] = r
+			}
+		}
+		if withTestOnly {
+			for i := range reported {
+				reported[i].countTestOnly = true
+			}
+		}
+		if !createdCutoff.IsZero() {
+			// results cached before the creation time was, have none and are
+			// left out
+			reported = lo.Filter(reported, func(r repoResult, _ int) bool {
+				return !r.createdAt.IsZero() && !r.createdAt.Before(createdCutoff)
+			})
+			baseline = lo.PickBy(baseline, func(_ string, r repoResult) bool {
+				return !r.createdAt.IsZero() && !r.createdAt.Before(createdCutoff)
+			})
+		}
+		if len(orgs) > 0 {
+			reported = lo.Filter(reported, func(r repoResult, _ int) bool {
+				return r.org != ""
+			})
+			baseline = lo.PickBy(baseline, func(repo string, _ repoResult) bool {
+				return repoOrg(repo, orgs) != ""
+			})
+		}
+		if pkgOwner != "" {
+			// the organization's own repositories are not adopters
+			reported = lo.Filter(reported, func(r repoResult, _ int) bool {
+				return repoOrg(r.name, []string{pkgOwner}) == ""
+			})
+			baseline = lo.PickBy(baseline, func(repo string, _ repoResult) bool {
+				return repoOrg(repo, []string{pkgOwner}) == ""
+			})
+		}
+		if minConf != "" {
+			reported = lo.Filter(reported, func(r repoResult, _ int) bool {
+				return r.meetsConfidence(minConf)
+			})
+			baseline = lo.PickBy(baseline, func(_ string, r repoResult) bool {
+				return r.meetsConfidence(minConf)
+			})
+		}
+		if filter != nil {
+			reported = lo.Filter(reported, func(r repoResult, _ int) bool {
+				return filter(r)
+			})
+			baseline = lo.PickBy(baseline, func(_ string, r repoResult) bool {
+				return filter(r)
+			})
+		}
+		applyNotes(reported, notes)
+		if sortKey != "stars" {
+			// the cache is sorted by stars, keep that order among equal keys
+			less := sortKeys[sortKey]
+			sort.SliceStable(reported, func(i, j int) bool {
+				return less(reported[i], reported[j])
+			})
+		}
 
-			repoSearchResult := repoResult{
-				name:  repo.GetFullName(),
-				stars: repo.GetStargazersCount(),
-				used:  false,
+		runSummary := summarize(reported)
+		runSummary.print()
+		if compareHosts {
+			printHostSplit(reported)
+		}
+		if sinceVersion != "" {
+			computeFunnel(reported, sinceVersion).print()
+		}
+		if nearMissDist > 0 {
+			printNearMisses(s.nearMisses)
+		}
+		if !readOnly && !stdinCache {
+			m.GeneratedAt = time.Now().UTC()
+			m.Counts = manifestCounts{
+				Checked:  len(newResults),
+				Results:  len(sortedResults),
+				Reported: len(reported),
+				Adopters: runSummary.adopters,
 			}
+			if err := writeManifest(manifestFile(fileName), m); err != nil {
+				logf("error writing the manifest: %v\n", err)
+			}
+		}
+		s.timings.print()
+		printSlowest(sortedResults)
+		budget.print()
+		if timingOut != "" {
+			if err := writeTimingsFile(timingOut, s.timings); err != nil {
+				logf("%v\n", err)
+			} else {
+				logf("timings: %s\n", timingOut)
+			}
+		}
+		if logPath != "" {
+			logf("log file: %s\n", logPath)
+		}
 
-			for _, file := range files.CodeResults {
-				// download the go.mod file
-				reader, _, err := s.client.Repositories.DownloadContents(ctx, repo.GetOwner().GetLogin(), repo.GetName(), file.GetPath(), nil)
-				if err != nil {
-					fmt.Printf("error downloading go.mod file: %v\n", err)
-					continue
-				}
+		if anonymize {
+			reported = anonymizer{salt: anonSalt, minStars: anonMinStars}.apply(reported)
+		}
 
-				// read from reader
-				bb, err := io.ReadAll(reader)
-				if err != nil {
-					fmt.Printf("error reading go.mod file: %v\n", err)
-					continue
+		if pushgateway != "" {
+			n := metricsNotification(pushgateway, packageName, runSummary, time.Since(start))
+			if err := deliver(ctx, n, notifyPolicy, queue); err != nil {
+				if notifyPolicy == notifyRetryThenFail {
+					return fmt.Errorf("error pushing metrics: %v", err)
 				}
+				logf("error pushing metrics: %v\n", err)
+			} else {
+				logf("pushed metrics to %s\n", pushgateway)
+			}
+		}
 
-				if err := reader.Close(); err != nil {
-					fmt.Printf("error closing reader: %v\n", err)
-					continue
-				}
+		if outputFormat != "" {
+			rows := reported
+			if granularity == granularityModule {
+				rows = perModule(reported)
+			}
+			if err := writeOutputFile(outputFile, outputFormat, packageName, fields, rows); err != nil {
+				return fmt.Errorf("error writing output: %v", err)
+			}
+		}
 
-				// parse the go.mod file
-				f, err := modfile.Parse("go.mod", bb, nil)
-				if err != nil {
-					fmt.Printf("error parsing go.mod file: %v\n", err)
-					continue
+		if reportTmpl != "" || reportJSON != "" {
+			data := newReportData(packageName, reported)
+			if reportJSON != "" {
+				if err := dumpReportData(reportJSON, data); err != nil {
+					return fmt.Errorf("error writing report data: %v", err)
 				}
-				fmt.Printf("parsed go.mod file: %s\n", file.GetHTMLURL())
-
-				// check if the package is in require section
-				for _, require := range f.Require {
-					// check if the package is in require section and not an indirect dependency
-					if require.Mod.Path == s.packageName && !require.Indirect {
-						fmt.Printf("Found package %s@%s in repository %s\n", s.packageName, require.Mod.Version, repo.GetFullName())
-						repoSearchResult.used = true
-						break
-					}
+			}
+			if reportTmpl != "" {
+				if err := writeReportFile(outputFile, reportTmpl, data); err != nil {
+					return fmt.Errorf("error rendering report: %v", err)
 				}
-
 			}
+		}
 
-			if !repoSearchResult.used {
-				fmt.Printf("Package %s not found in repository %s\n", s.packageName, repo.GetFullName())
+		if outreachTmpl != "" {
+			target := outreachTgt
+			if target == "" {
+				target = latestVersion(reported)
 			}
+			if target == "" {
+				logln("no adopter uses a semver version, not writing outreach messages")
+			} else {
+				n, err := writeOutreach(outreachDir, outreachTmpl, packageName, target, reported)
+				if err != nil {
+					return fmt.Errorf("error writing outreach messages: %v", err)
+				}
+				logf("wrote %d outreach messages for %s to %s\n", n, target, outreachDir)
+			}
+		}
 
-			results[repo.GetFullName()] = repoSearchResult
-
-			fmt.Printf("Sleeping for %d seconds in searchInRepositories\n", int(s.searchDelay.Seconds()))
-			if err := sleepWithContext(ctx, s.searchDelay); err != nil {
-				fmt.Printf("Sleep was interrupted: %v\n", err)
+		if baseline != nil {
+			r := evaluateRegression(baseline, reported)
+			logf("adopters: %d (baseline: %d)\n", r.currentAdopters, r.baselineAdopters)
+			if err := r.check(maxDropPct); err != nil {
+				return err
 			}
 		}
+		return nil
 	}
+	if batch {
+		packages, err := readBatch(os.Stdin)
+		if err != nil {
+			return err
+		}
+		return scanBatch(ctx, packages, scan)
+	}
+	return scan(packageName, nil)
+}
 
-	return results, nil
+// rateLimits are the maximum requests per second of a client, 0 for no limit.
+type rateLimits struct {
+	all      float64
+	search   float64
+	download float64
+	// budget caps the number of requests, nil for no cap
+	budget *requestBudget
+}
+
+// newClient sets up a GitHub client authenticated with the token.
+func newClient(ctx context.Context, token string, limits rateLimits) *github.Client {
+	ts := oauth2.StaticTokenSource(
+		&oauth2.Token{AccessToken: token},
+	)
+	tc := oauth2.NewClient(ctx, ts)
+	// every GitHub call shares the same quota view through this transport
+	transport := newRateLimitTransport(tc.Transport, limits.all, limits.search, limits.download)
+	transport.budget = limits.budget
+	tc.Transport = transport
+
+	// For debugging
+	//tc := &oauth2.Transport{Source: ts, Base: dbg.New()}
+	//client := github.NewClient(&http.Client{Transport: tc})
+	return github.NewClient(tc)
+}
+
+// parseDate parses a date flag value, either YYYY-MM-DD or RFC 3339.
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a YYYY-MM-DD or RFC 3339 date", value)
+	}
+	return t, nil
 }
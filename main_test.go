@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// the test binary runs as pkgstats for runPkgstats
+	if os.Getenv("PKGSTATS_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	// the progress messages of the code under test are noise here
+	logOutput = io.Discard
+	os.Exit(m.Run())
+}
+
+// runPkgstats runs pkgstats with the arguments and returns what it writes to
+// stdout and stderr.
+func runPkgstats(t *testing.T, args ...string) (stdout, stderr string) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "PKGSTATS_TEST_MAIN=1", "XDG_STATE_HOME="+t.TempDir())
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("pkgstats %s: %v\n%s", strings.Join(args, " "), err, errOut.String())
+	}
+	return out.String(), errOut.String()
+}
+
+func TestOutputStreams(t *testing.T) {
+	cacheFile := filepath.Join(t.TempDir(), "pkg.csv")
+	if err := os.WriteFile(cacheFile, []byte("a/one,true,10,v1.0.0\na/two,false,5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// -backfill-stars has nothing to fetch for a cache with stars, so the
+	// run makes no request
+	common := []string{"-yes", "-pkg", "github.com/x/lib", "-token", "unused", "-cache-file", cacheFile, "-backfill-stars", "-read-only-cache"}
+
+	tests := []struct {
+		format string
+		// want is the exact output, the JSON output is only checked to be
+		// valid
+		want string
+	}{
+		{format: "json"},
+		{format: "csv", want: "name,used,stars,version\na/one,true,10,v1.0.0\na/two,false,5,\n"},
+		{format: "shell", want: "adopters=1 reach=10 repositories=2 low_confidence=0\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			stdout, stderr := runPkgstats(t, append(common, "-output", tt.format)...)
+			if tt.format == "json" && !json.Valid([]byte(stdout)) || tt.want != "" && stdout != tt.want {
+				t.Errorf("stdout is not the %s output:\n%s", tt.format, stdout)
+			}
+			if !strings.Contains(stderr, "scan plan:") || !strings.Contains(stderr, "repositories: 2, adopters: 1") {
+				t.Errorf("progress messages missing from stderr:\n%s", stderr)
+			}
+		})
+	}
+}
+
+func TestManifest(t *testing.T) {
+	cacheFile := filepath.Join(t.TempDir(), "pkg.csv")
+	if err := os.WriteFile(cacheFile, []byte("a/one,true,10,v1.0.0\na/two,false,5\na/three,true,3,v0.9.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runPkgstats(t, "-yes", "-pkg", "github.com/x/lib", "-token", "secret", "-cache-file", cacheFile, "-backfill-stars", "-min-stars", "7", "-output", "csv")
+
+	bb, err := os.ReadFile(manifestFile(cacheFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m manifest
+	if err := json.Unmarshal(bb, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Package != "github.com/x/lib" || m.Source != "backfill-stars" || m.GitHubAPIVersion != githubAPIVersion || m.ToolVersion == "" || m.GeneratedAt.IsZero() {
+		t.Errorf("manifest %+v, missing the parameters of the run", m)
+	}
+	if m.CacheSchema != cacheSchemaVersion || m.OutputSchema != outputSchemaVersion {
+		t.Errorf("schema versions %d and %d, want %d and %d", m.CacheSchema, m.OutputSchema, cacheSchemaVersion, outputSchemaVersion)
+	}
+	if m.Flags["min-stars"] != "7" || m.Flags["cache-file"] != cacheFile {
+		t.Errorf("flags %v, want the effective ones", m.Flags)
+	}
+	if _, ok := m.Flags["token"]; ok {
+		t.Error("token recorded in the manifest")
+	}
+	if want := (manifestCounts{Checked: 0, Results: 3, Reported: 3, Adopters: 2}); m.Counts != want {
+		t.Errorf("counts %+v, want %+v", m.Counts, want)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"runtime/debug"
+	"time"
+)
+
+// githubAPIVersion is the REST API version requested by go-github v63.
+const githubAPIVersion = "2022-11-28"
+
+// manifest records how the results of a run were produced, written next to
+// the cache as <pkg>.manifest.json.
+type manifest struct {
+	Package          string            `json:"package"`
+	GeneratedAt      time.Time         `json:"generated_at"`
+	ToolVersion      string            `json:"tool_version"`
+	GitHubAPIVersion string            `json:"github_api_version"`
+	CacheSchema      int               `json:"cache_schema_version"`
+	OutputSchema     int               `json:"output_schema_version"`
+	Source           string            `json:"source"`
+	Queries          []string          `json:"queries,omitempty"`
+	MinStars         int               `json:"min_stars,omitempty"`
+	MaxStars         int               `json:"max_stars,omitempty"`
+	Flags            map[string]string `json:"flags"`
+	Counts           manifestCounts    `json:"counts"`
+}
+
+type manifestCounts struct {
+	// Checked are the repositories checked in this run, Results all the
+	// results in the cache and Reported the ones left after the filters
+	Checked  int `json:"checked"`
+	Results  int `json:"results"`
+	Reported int `json:"reported"`
+	Adopters int `json:"adopters"`
+}
+
+// manifestFile returns the manifest file of a cache file.
+func manifestFile(cacheFile string) string {
+	return trimCacheExt(cacheFile) + ".manifest.json"
+}
+
+// toolVersion returns the module version of the binary, or the VCS revision
+// of a build from a checkout.
+func toolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	version := "devel"
+	for _, setting := range info.Settings {
+		switch {
+		case setting.Key == "vcs.revision":
+			version += " " + setting.Value
+		case setting.Key == "vcs.modified" && setting.Value == "true":
+			version += " (modified)"
+		}
+	}
+	return version
+}
+
+// effectiveFlags returns the value of every flag, set or default, but the
+// token.
+func effectiveFlags() map[string]string {
+	flags := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		if f.Name != "token" {
+			flags[f.Name] = f.Value.String()
+		}
+	})
+	return flags
+}
+
+// writeManifest writes the manifest as indented JSON.
+func writeManifest(fileName string, m manifest) error {
+	bb, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, append(bb, '\n'), 0644)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"golang.org/x/mod/module"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	defaultModuleProxy = "https://proxy.golang.org"
+	moduleProxyTimeout = 10 * time.Second
+)
+
+// knownHostDepths are the number of path elements of the module roots of
+// code hosts, host/owner/repo.
+var knownHostDepths = map[string]int{
+	"github.com":    3,
+	"gitlab.com":    3,
+	"bitbucket.org": 3,
+}
+
+// majorVersionRe matches the major version suffix of a module path.
+var majorVersionRe = regexp.MustCompile(`^v[0-9]+$`)
+
+// hostModuleRoot returns the module root a path on a known code host would
+// have if it is a repository root module, and false for other hosts. It
+// can't tell nested modules from packages.
+func hostModuleRoot(modulePath string) (string, bool) {
+	elems := strings.Split(modulePath, "/")
+	depth, ok := knownHostDepths[elems[0]]
+	if !ok || len(elems) < depth {
+		return "", false
+	}
+	if len(elems) > depth && majorVersionRe.MatchString(elems[depth]) {
+		depth++
+	}
+	return strings.Join(elems[:depth], "/"), true
+}
+
+// moduleProxy returns the first HTTP proxy of GOPROXY, or proxy.golang.org.
+func moduleProxy() string {
+	for _, proxy := range strings.FieldsFunc(os.Getenv("GOPROXY"), func(r rune) bool { return r == ',' || r == '|' }) {
+		if strings.HasPrefix(proxy, "https://") || strings.HasPrefix(proxy, "http://") {
+			return strings.TrimSuffix(proxy, "/")
+		}
+	}
+	return defaultModuleProxy
+}
+
+// isModule reports whether the module proxy knows a module at the path.
+func isModule(ctx context.Context, proxy, modulePath string) (bool, error) {
+	escaped, err := module.EscapePath(modulePath)
+	if err != nil {
+		return false, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, moduleProxyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, proxy+"/"+escaped+"/@latest", nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return true, nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return false, nil
+	default:
+		return false, fmt.Errorf("module proxy %s: %s", proxy, resp.Status)
+	}
+}
+
+// normalizeModulePath returns the module root of a package path: the longest
+// prefix the module proxy knows as a module, or when the proxy can't tell,
+// the repository root on a known code host. Paths it can't resolve are
+// returned as they are.
+func normalizeModulePath(ctx context.Context, proxy, pkgPath string) string {
+	elems := strings.Split(pkgPath, "/")
+	for i := len(elems); i > 1; i-- {
+		candidate := strings.Join(elems[:i], "/")
+		ok, err := isModule(ctx, proxy, candidate)
+		if err != nil {
+			logf("error looking up %s: %v\n", candidate, err)
+			break
+		}
+		if ok {
+			return candidate
+		}
+	}
+	if root, ok := hostModuleRoot(pkgPath); ok {
+		return root
+	}
+	return pkgPath
+}
+
+// warnSubPath warns when the package looks like a package inside a module
+// rather than a module, which no go.mod requires.
+func warnSubPath(pkgPath string) {
+	if root, ok := hostModuleRoot(pkgPath); ok && root != pkgPath {
+		logf("warning: %s may be a package of the module %s, go.mod files only require modules; -normalize-module-path looks the module up\n", pkgPath, root)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeModulePath(t *testing.T) {
+	// the proxy knows the modules, anything else is not found
+	modules := map[string]bool{
+		"github.com/x/lib":               true,
+		"github.com/x/lib/v2":            true,
+		"github.com/x/lib/tools":         true,
+		"example.com/vanity":             true,
+		"github.com/!upper/!case/module": true,
+	}
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		escaped, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/@latest")
+		if !ok || !modules[escaped] {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"Version": "v1.0.0"}`))
+	}))
+	defer proxy.Close()
+
+	tests := []struct {
+		pkgPath string
+		want    string
+	}{
+		{pkgPath: "github.com/x/lib", want: "github.com/x/lib"},
+		{pkgPath: "github.com/x/lib/pkg/sub", want: "github.com/x/lib"},
+		{pkgPath: "github.com/x/lib/v2/pkg", want: "github.com/x/lib/v2"},
+		// a nested module is the longest prefix the proxy knows
+		{pkgPath: "github.com/x/lib/tools/cmd", want: "github.com/x/lib/tools"},
+		{pkgPath: "example.com/vanity/internal/pkg", want: "example.com/vanity"},
+		{pkgPath: "github.com/Upper/Case/module/pkg", want: "github.com/Upper/Case/module"},
+		// unknown to the proxy, the repository root of a known host
+		{pkgPath: "github.com/y/private/pkg", want: "github.com/y/private"},
+		{pkgPath: "github.com/y/private/v3/pkg", want: "github.com/y/private/v3"},
+		{pkgPath: "example.com/unknown/pkg", want: "example.com/unknown/pkg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pkgPath, func(t *testing.T) {
+			if got := normalizeModulePath(context.Background(), proxy.URL, tt.pkgPath); got != tt.want {
+				t.Errorf("normalizeModulePath(%s) = %s, want %s", tt.pkgPath, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeModulePathProxyDown(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer proxy.Close()
+
+	if got := normalizeModulePath(context.Background(), proxy.URL, "github.com/x/lib/pkg/sub"); got != "github.com/x/lib" {
+		t.Errorf("got %s, want the repository root without the proxy", got)
+	}
+}
+
+func TestModuleProxy(t *testing.T) {
+	tests := []struct {
+		goproxy string
+		want    string
+	}{
+		{goproxy: "", want: defaultModuleProxy},
+		{goproxy: "https://goproxy.example.com/,direct", want: "https://goproxy.example.com"},
+		{goproxy: "off", want: defaultModuleProxy},
+		{goproxy: "direct|http://athens.internal", want: "http://athens.internal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.goproxy, func(t *testing.T) {
+			t.Setenv("GOPROXY", tt.goproxy)
+			if got := moduleProxy(); got != tt.want {
+				t.Errorf("moduleProxy() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
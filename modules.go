@@ -0,0 +1,48 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+// Kinds of module a matched go.mod file belongs to, from the strongest to the
+// weakest evidence of production use.
+const (
+	moduleMain   = "main"
+	moduleNested = "nested"
+	moduleTest   = "test"
+)
+
+var moduleKindStrength = map[string]int{
+	"":           0,
+	moduleTest:   1,
+	moduleNested: 2,
+	moduleMain:   3,
+}
+
+// testModuleMarkers are the directory name fragments of test-only modules.
+var testModuleMarkers = []string{"test", "e2e", "integration"}
+
+// classifyModulePath classifies a go.mod file by its path in the repository.
+func classifyModulePath(goModPath string) string {
+	dir := path.Dir(strings.TrimPrefix(goModPath, "/"))
+	if dir == "." {
+		return moduleMain
+	}
+
+	lower := strings.ToLower(dir)
+	for _, marker := range testModuleMarkers {
+		if strings.Contains(lower, marker) {
+			return moduleTest
+		}
+	}
+	return moduleNested
+}
+
+// strongerModuleKind returns the kind giving the strongest evidence of use.
+func strongerModuleKind(a, b string) string {
+	if moduleKindStrength[b] > moduleKindStrength[a] {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestClassifyModulePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "go.mod", want: moduleMain},
+		{path: "/go.mod", want: moduleMain},
+		{path: "tools/go.mod", want: moduleNested},
+		{path: "cmd/server/go.mod", want: moduleNested},
+		{path: "test/go.mod", want: moduleTest},
+		{path: "internal/testdata/go.mod", want: moduleTest},
+		{path: "E2E/go.mod", want: moduleTest},
+		{path: "integration-tests/go.mod", want: moduleTest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := classifyModulePath(tt.path); got != tt.want {
+				t.Errorf("classifyModulePath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStrongerModuleKind(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{a: "", b: moduleTest, want: moduleTest},
+		{a: moduleTest, b: moduleNested, want: moduleNested},
+		{a: moduleMain, b: moduleNested, want: moduleMain},
+		{a: moduleNested, b: moduleNested, want: moduleNested},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"-"+tt.b, func(t *testing.T) {
+			if got := strongerModuleKind(tt.a, tt.b); got != tt.want {
+				t.Errorf("strongerModuleKind(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
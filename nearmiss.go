@@ -0,0 +1,84 @@
+package main
+
+import (
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"sort"
+)
+
+// nearMiss is a requirement of a go.mod whose path is close to, but not, one
+// of the modules searched for: a typo or the path of a renamed module.
+type nearMiss struct {
+	repo      string
+	goModPath string
+	require   string
+	module    string
+	distance  int
+}
+
+// levenshtein returns the edit distance between a and b, in bytes.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// samePathPrefix reports whether two module paths only differ by their major
+// version suffix, e.g. example.com/mod and example.com/mod/v2.
+func samePathPrefix(a, b string) bool {
+	prefixA, _, okA := module.SplitPathVersion(a)
+	prefixB, _, okB := module.SplitPathVersion(b)
+	return okA && okB && prefixA == prefixB
+}
+
+// findNearMisses records the requirements of the go.mod file at path within
+// s.nearMissDistance edits of a module searched for. Other major versions of
+// the module are not near misses.
+func (s *searchResult) findNearMisses(repo, path string, f *modfile.File) {
+	if s.nearMissDistance <= 0 {
+		return
+	}
+	for _, r := range f.Require {
+		for _, pattern := range s.modules {
+			module := modulePrefix(pattern)
+			if matchesModule(pattern, r.Mod.Path) || samePathPrefix(r.Mod.Path, module) {
+				continue
+			}
+			if d := levenshtein(r.Mod.Path, module); d <= s.nearMissDistance {
+				s.nearMisses = append(s.nearMisses, nearMiss{repo: repo, goModPath: path, require: r.Mod.Path, module: module, distance: d})
+			}
+		}
+	}
+}
+
+// printNearMisses logs the -near-miss-distance report, the closest first.
+func printNearMisses(misses []nearMiss) {
+	if len(misses) == 0 {
+		logln("near misses: none")
+		return
+	}
+	sort.SliceStable(misses, func(i, j int) bool {
+		if misses[i].distance != misses[j].distance {
+			return misses[i].distance < misses[j].distance
+		}
+		return misses[i].repo < misses[j].repo
+	})
+	logf("near misses: %d\n", len(misses))
+	for _, m := range misses {
+		logf("  %s %s requires %s, %d edits from %s\n", m.repo, m.goModPath, m.require, m.distance, m.module)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "", b: "", want: 0},
+		{a: "lib", b: "", want: 3},
+		{a: "github.com/x/lib", b: "github.com/x/lib", want: 0},
+		{a: "github.com/x/lb", b: "github.com/x/lib", want: 1},
+		{a: "github.com/x/lid", b: "github.com/x/lib", want: 1},
+		{a: "github.com/x/ilb", b: "github.com/x/lib", want: 2},
+		{a: "github.com/y/libs", b: "github.com/x/lib", want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			if got := levenshtein(tt.a, tt.b); got != tt.want {
+				t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+			if got := levenshtein(tt.b, tt.a); got != tt.want {
+				t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindNearMisses(t *testing.T) {
+	requiring := func(path string) string {
+		return "module example.com/app\n\ngo 1.22\n\nrequire " + path + " v1.0.0\n"
+	}
+	// the code search only finds go.mod files containing the package path,
+	// or the root go.mod of a repository missing from the index
+	f := &fakeGitHub{
+		repos: map[string]map[string]string{
+			"a/used":    {"go.mod": goModRequiring("v1.0.0")},
+			"a/typo":    {"go.mod": requiring("github.com/x/libs")},
+			"a/nested":  {"go.mod": "module example.com/nested\n", "tools/go.mod": requiring("github.com/x/lib-go")},
+			"a/major":   {"go.mod": requiring("github.com/x/lib/v2")},
+			"a/far":     {"go.mod": requiring("github.com/x/library")},
+			"a/missing": {"go.mod": requiring("github.com/x/lb")},
+		},
+		incomplete: map[string]bool{"a/missing": true},
+	}
+
+	tests := []struct {
+		name     string
+		distance int
+		want     []nearMiss
+	}{
+		{name: "off"},
+		{name: "one edit", distance: 1, want: []nearMiss{
+			{repo: "a/missing", goModPath: "go.mod", require: "github.com/x/lb", module: "github.com/x/lib", distance: 1},
+			{repo: "a/typo", goModPath: "go.mod", require: "github.com/x/libs", module: "github.com/x/lib", distance: 1},
+		}},
+		{name: "three edits", distance: 3, want: []nearMiss{
+			{repo: "a/missing", goModPath: "go.mod", require: "github.com/x/lb", module: "github.com/x/lib", distance: 1},
+			{repo: "a/typo", goModPath: "go.mod", require: "github.com/x/libs", module: "github.com/x/lib", distance: 1},
+			{repo: "a/nested", goModPath: "tools/go.mod", require: "github.com/x/lib-go", module: "github.com/x/lib", distance: 3},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeSearch(t, f, "github.com/x/lib")
+			s.nearMissDistance = tt.distance
+			var candidates []candidate
+			for _, name := range []string{"a/used", "a/typo", "a/nested", "a/major", "a/far", "a/missing"} {
+				candidates = append(candidates, fakeCandidate(name, 1))
+			}
+			if _, err := s.searchInRepositories(context.Background(), candidates); err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			logOutput = &buf
+			defer func() { logOutput = io.Discard }()
+			printNearMisses(s.nearMisses)
+
+			if len(s.nearMisses) != len(tt.want) {
+				t.Fatalf("near misses %+v, want %+v", s.nearMisses, tt.want)
+			}
+			// the report lists the closest first
+			for i, want := range tt.want {
+				if got := s.nearMisses[i]; got != want {
+					t.Errorf("near miss %d: %+v, want %+v", i, got, want)
+				}
+			}
+			if len(tt.want) == 0 && !strings.Contains(buf.String(), "near misses: none") {
+				t.Errorf("report %q, want no near misses", buf.String())
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want.repo+" "+want.goModPath+" requires "+want.require) {
+					t.Errorf("report %q doesn't list %s", buf.String(), want.repo)
+				}
+			}
+		})
+	}
+}
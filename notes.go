@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+)
+
+// loadNotes reads a sidecar notes file with one "repository,note" row per
+// repository. The file is maintained by hand and never written by pkgstats.
+func loadNotes(fileName string) (map[string]string, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = 2
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	notes := make(map[string]string)
+	for _, record := range records {
+		if record[0] == "" {
+			return nil, fmt.Errorf("missing repository name in notes record: %v", record)
+		}
+		notes[record[0]] = record[1]
+	}
+
+	return notes, nil
+}
+
+// applyNotes attaches the notes to the matching results.
+func applyNotes(results []repoResult, notes map[string]string) {
+	for i := range results {
+		results[i].notes = notes[results[i].name]
+	}
+}
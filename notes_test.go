@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadNotes(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "notes", content: "a/one,internal fork\n\"a/two\",\"uses it, in tests\"\n", want: map[string]string{"a/one": "internal fork", "a/two": "uses it, in tests"}},
+		{name: "empty", content: "", want: map[string]string{}},
+		{name: "missing repository", content: ",a note\n", wantErr: true},
+		{name: "missing note", content: "a/one\n", wantErr: true},
+		{name: "extra field", content: "a/one,a note,more\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), "notes.csv")
+			if err := os.WriteFile(fileName, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			notes, err := loadNotes(fileName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want one: %v", err, tt.wantErr)
+			}
+			if len(notes) != len(tt.want) {
+				t.Errorf("notes %v, want %v", notes, tt.want)
+			}
+			for name, note := range tt.want {
+				if notes[name] != note {
+					t.Errorf("note of %s %q, want %q", name, notes[name], note)
+				}
+			}
+		})
+	}
+}
+
+func TestNotesSurviveRescan(t *testing.T) {
+	notes := map[string]string{"a/one": "internal fork"}
+
+	results := []repoResult{{name: "a/one", used: true, stars: 10, version: "v1.0.0"}, {name: "a/two", stars: 5}}
+	applyNotes(results, notes)
+	var cache bytes.Buffer
+	if err := writeResults(&cache, results); err != nil {
+		t.Fatal(err)
+	}
+
+	// the re-scan reads the cache, which holds no notes, and joins them again
+	cached, err := readResults(&cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached["a/one"].notes != "" {
+		t.Errorf("note %q read from the cache", cached["a/one"].notes)
+	}
+	rescanned := []repoResult{cached["a/one"], cached["a/two"]}
+	applyNotes(rescanned, notes)
+
+	fields, err := parseFields("name,notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeOutput(&buf, "csv", "example.com/pkg", fields, rescanned); err != nil {
+		t.Fatal(err)
+	}
+	if want := "name,notes\na/one,internal fork\na/two,\n"; buf.String() != want {
+		t.Errorf("output\n%s\nwant\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policies for a notification that can't be delivered, set with
+// -notify-policy.
+const (
+	// notifyWarn logs the failure and goes on
+	notifyWarn = "warn"
+	// notifyRetryThenFail retries and fails the run if every attempt fails
+	notifyRetryThenFail = "retry-then-fail"
+	// notifyQueue persists the notification before sending it, unsent
+	// notifications are sent again at the start of the next run
+	notifyQueue = "queue"
+)
+
+var notifyPolicies = []string{notifyWarn, notifyRetryThenFail, notifyQueue}
+
+const (
+	notifyTimeout  = 10 * time.Second
+	notifyAttempts = 3
+)
+
+// notification is an HTTP request to a notification target, e.g. the
+// metrics of a run for the pushgateway. It holds everything needed to send
+// it again from the queue.
+type notification struct {
+	ID          string    `json:"id"`
+	Target      string    `json:"target"`
+	Method      string    `json:"method"`
+	URL         string    `json:"url"`
+	ContentType string    `json:"content_type"`
+	Body        string    `json:"body"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func newNotification(target, method, url, contentType, body string) notification {
+	now := time.Now().UTC()
+	return notification{
+		ID:          strconv.FormatInt(now.UnixNano(), 36),
+		Target:      target,
+		Method:      method,
+		URL:         url,
+		ContentType: contentType,
+		Body:        body,
+		CreatedAt:   now,
+	}
+}
+
+// send delivers the notification once. It is still attempted when ctx is
+// canceled, so an interrupted run reports what it gathered.
+func (n notification) send(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), notifyTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, n.Method, n.URL, strings.NewReader(n.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", n.ContentType)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &statusError{service: n.Target, statusCode: resp.StatusCode, status: resp.Status, message: strings.TrimSpace(string(msg))}
+	}
+	return nil
+}
+
+// sendWithRetry sends the notification up to notifyAttempts times, waiting
+// 1s, 2s, ... between the attempts. Errors isRetryable rejects are returned
+// at once.
+func (n notification) sendWithRetry(ctx context.Context) error {
+	var err error
+	for attempt := 1; attempt <= notifyAttempts; attempt++ {
+		if err = n.send(ctx); err == nil || !isRetryable(err) {
+			return err
+		}
+		if attempt < notifyAttempts {
+			logf("error sending to %s (attempt %d of %d): %v\n", n.Target, attempt, notifyAttempts, err)
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+	}
+	return err
+}
+
+// deliver sends the notification according to the policy. With the queue
+// policy a failed send is not an error: the notification stays queued,
+// unless isRetryable says retrying is pointless.
+func deliver(ctx context.Context, n notification, policy string, queue *notificationQueue) error {
+	switch policy {
+	case notifyRetryThenFail:
+		return n.sendWithRetry(ctx)
+	case notifyQueue:
+		// the notification is durable before it is sent, a crash in between
+		// sends it again on the next run
+		if err := queue.enqueue(n); err != nil {
+			return fmt.Errorf("error queueing the notification: %v", err)
+		}
+		if err := n.send(ctx); err != nil && isRetryable(err) {
+			logf("error sending to %s, queued for the next run: %v\n", n.Target, err)
+			return nil
+		} else if err != nil {
+			// a permanent error won't go away on the next run
+			logf("error sending to %s, not retrying: %v\n", n.Target, err)
+		}
+		if err := queue.ack(n.ID); err != nil {
+			logf("error acknowledging the notification, it will be sent again: %v\n", err)
+		}
+		return nil
+	default:
+		return n.send(ctx)
+	}
+}
+
+// queueRecord is a line of the queue file: a queued notification, or the
+// acknowledgement that it was sent.
+type queueRecord struct {
+	Op           string        `json:"op"`
+	ID           string        `json:"id"`
+	Notification *notification `json:"notification,omitempty"`
+}
+
+// notificationQueue is an append-only JSON lines queue of notifications.
+// Records are appended and synced one by one; compact rewrites the file with
+// the pending notifications only.
+type notificationQueue struct {
+	path string
+}
+
+func (q *notificationQueue) enqueue(n notification) error {
+	return q.append(queueRecord{Op: "enqueue", ID: n.ID, Notification: &n})
+}
+
+func (q *notificationQueue) ack(id string) error {
+	return q.append(queueRecord{Op: "ack", ID: id})
+}
+
+func (q *notificationQueue) append(record queueRecord) error {
+	bb, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(q.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(q.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// a crash in the middle of an append leaves a line without newline,
+	// terminate it so this record stays readable
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			bb = append([]byte{'\n'}, bb...)
+		}
+	}
+	if _, err := file.Write(append(bb, '\n')); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// pending returns the queued notifications that were not acknowledged, in
+// queue order. Lines that don't parse, like a torn last write, are skipped.
+func (q *notificationQueue) pending() ([]notification, error) {
+	bb, err := os.ReadFile(q.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		queued []notification
+		acked  = make(map[string]bool)
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(bb))
+	scanner.Buffer(nil, 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var record queueRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			logf("%s:%d: skipping an unreadable record: %v\n", q.path, line, err)
+			continue
+		}
+		switch {
+		case record.Op == "enqueue" && record.Notification != nil:
+			queued = append(queued, *record.Notification)
+		case record.Op == "ack":
+			acked[record.ID] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var pending []notification
+	for _, n := range queued {
+		if !acked[n.ID] {
+			pending = append(pending, n)
+		}
+	}
+	return pending, nil
+}
+
+// compact rewrites the queue with the pending notifications only, through
+// a temporary file so a crash leaves either the old or the new queue. An
+// empty queue is removed.
+func (q *notificationQueue) compact(pending []notification) error {
+	if len(pending) == 0 {
+		if err := os.Remove(q.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(q.path), ".notify-queue-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	encoder := json.NewEncoder(tmp)
+	for _, n := range pending {
+		n := n
+		if err := encoder.Encode(queueRecord{Op: "enqueue", ID: n.ID, Notification: &n}); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), q.path)
+}
+
+// replay sends the pending notifications of previous runs, oldest first so
+// a newer one wins at targets that keep the last value, and compacts the
+// queue. Notifications that fail again stay queued.
+func (q *notificationQueue) replay(ctx context.Context) error {
+	pending, err := q.pending()
+	if err != nil {
+		return fmt.Errorf("error reading the notification queue: %v", err)
+	}
+	if len(pending) == 0 {
+		return q.compact(nil)
+	}
+
+	logf("sending %d queued notifications\n", len(pending))
+	var failed []notification
+	for _, n := range pending {
+		if err := n.send(ctx); err != nil && isRetryable(err) {
+			logf("error sending the queued notification %s to %s: %v\n", n.ID, n.Target, err)
+			failed = append(failed, n)
+			continue
+		} else if err != nil {
+			logf("error sending the queued notification %s to %s, dropping it: %v\n", n.ID, n.Target, err)
+		}
+		if err := q.ack(n.ID); err != nil {
+			return fmt.Errorf("error acknowledging notification %s: %v", n.ID, err)
+		}
+	}
+	if len(failed) > 0 {
+		logf("%d notifications stay queued in %s\n", len(failed), q.path)
+	}
+	return q.compact(failed)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// notifyTarget is a notification target answering with status, recording
+// the bodies it got.
+type notifyTarget struct {
+	status int
+
+	mu     sync.Mutex
+	bodies []string
+}
+
+func (n *notifyTarget) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	n.mu.Lock()
+	n.bodies = append(n.bodies, string(body))
+	status := n.status
+	n.mu.Unlock()
+	w.WriteHeader(status)
+}
+
+func (n *notifyTarget) received() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string(nil), n.bodies...)
+}
+
+func TestDeliverQueue(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		wantPending int
+	}{
+		{name: "sent", status: http.StatusOK},
+		{name: "target down", status: http.StatusServiceUnavailable, wantPending: 1},
+		// a permanent error won't go away on the next run
+		{name: "rejected", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := &notifyTarget{status: tt.status}
+			server := httptest.NewServer(target)
+			defer server.Close()
+			queue := &notificationQueue{path: filepath.Join(t.TempDir(), "notify.jsonl")}
+
+			n := newNotification("test", http.MethodPost, server.URL, "text/plain", "adopters 7")
+			if err := deliver(context.Background(), n, notifyQueue, queue); err != nil {
+				t.Fatalf("error %v, the queue policy never fails a run", err)
+			}
+			if got := target.received(); len(got) != 1 || got[0] != "adopters 7" {
+				t.Errorf("target received %q", got)
+			}
+			pending, err := queue.pending()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pending) != tt.wantPending {
+				t.Errorf("%d notifications pending, want %d", len(pending), tt.wantPending)
+			}
+		})
+	}
+}
+
+func TestNotificationQueueCrash(t *testing.T) {
+	target := &notifyTarget{status: http.StatusServiceUnavailable}
+	server := httptest.NewServer(target)
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "notify.jsonl")
+	queue := &notificationQueue{path: path}
+
+	// a run killed between writing the notification and sending it
+	first := newNotification("test", http.MethodPost, server.URL, "text/plain", "first")
+	if err := queue.enqueue(first); err != nil {
+		t.Fatal(err)
+	}
+	// and one killed in the middle of the acknowledgement of another
+	second := newNotification("test", http.MethodPost, server.URL, "text/plain", "second")
+	second.ID += "-2"
+	if err := queue.enqueue(second); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"op": "ack", "id": "` + second.ID[:3])
+	file.Close()
+	// the next record is still readable after the torn one
+	third := newNotification("test", http.MethodPost, server.URL, "text/plain", "third")
+	third.ID += "-3"
+	if err := queue.enqueue(third); err != nil {
+		t.Fatal(err)
+	}
+
+	// the target is still down at the start of the next run
+	if err := queue.replay(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(target.received(), ","); got != "first,second,third" {
+		t.Errorf("target received %s, want the queued notifications in order", got)
+	}
+	pending, err := queue.pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 3 {
+		t.Fatalf("%d notifications pending, want the 3 unsent ones", len(pending))
+	}
+	bb, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(bb), "\n"); lines != 3 {
+		t.Errorf("%d lines in the compacted queue, want 3:\n%s", lines, bb)
+	}
+
+	// it is back on the run after
+	target.mu.Lock()
+	target.status = http.StatusOK
+	target.mu.Unlock()
+	if err := queue.replay(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(target.received()); got != 6 {
+		t.Errorf("target received %d notifications, want every one sent again once", got)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("queue left after every notification was sent: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/go-github/v63/github"
+	"strings"
+)
+
+// stringList is a flag that can be repeated, collecting every value.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// orgCandidates lists the Go repositories of an organization. Like the
+// language:go qualifier of the repository search, only repositories whose
+// main language is Go are kept.
+func (s *searchResult) orgCandidates(ctx context.Context, org string) ([]candidate, error) {
+	opts := &github.RepositoryListByOrgOptions{
+		Type:        "all",
+		ListOptions: github.ListOptions{PerPage: maxPerPage},
+	}
+
+	var candidates []candidate
+	for {
+		repos, resp, err := s.client.Repositories.ListByOrg(ctx, org, opts)
+		if err != nil {
+			return candidates, fmt.Errorf("error listing the repositories of %s: %v", org, withRequestID(err))
+		}
+		for _, repo := range repos {
+			if repo.GetLanguage() == "Go" {
+				candidates = append(candidates, candidateFromRepository(repo))
+			}
+		}
+		if resp.NextPage == 0 {
+			return candidates, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// SearchOrgs inspects the Go repositories of the organizations instead of
+// the repositories found by the repository search. A repository listed by
+// more than one organization is checked once.
+func (s *searchResult) SearchOrgs(ctx context.Context, orgs []string) (map[string]repoResult, error) {
+	results := make(map[string]repoResult)
+	for _, org := range orgs {
+		if ctx.Err() != nil {
+			break
+		}
+
+		candidates, err := s.orgCandidates(ctx, org)
+		if err != nil {
+			return results, err
+		}
+		logf("found %d Go repositories in organization %s\n", len(candidates), org)
+
+		orgResults, err := s.searchInRepositories(ctx, filterCandidates(candidates))
+		mergeResults(results, orgResults)
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// repoOrg returns the organization of orgs that owns the repository, or ""
+// if none does.
+func repoOrg(name string, orgs []string) string {
+	owner, _, _ := strings.Cut(name, "/")
+	for _, org := range orgs {
+		if strings.EqualFold(owner, org) {
+			return org
+		}
+	}
+	return ""
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"github.com/google/go-github/v63/github"
+	"testing"
+)
+
+// goRepository returns the listing of a repository in the language.
+func goRepository(name, language string) *github.Repository {
+	repo := fakeRepository(name, 10)
+	repo.Language = github.String(language)
+	return repo
+}
+
+func TestSearchOrgs(t *testing.T) {
+	f := &fakeGitHub{
+		repos: map[string]map[string]string{
+			"acme/api":    {"go.mod": goModRequiring("v1.0.0")},
+			"acme/web":    {"go.mod": "module example.com/web\n"},
+			"labs/shared": {"go.mod": goModRequiring("v1.1.0")},
+			"labs/tool":   {"go.mod": goModRequiring("v1.2.0")},
+		},
+		orgs: map[string][]*github.Repository{
+			"acme": {goRepository("acme/api", "Go"), goRepository("acme/web", "Go"), goRepository("acme/site", "TypeScript"), goRepository("labs/shared", "Go")},
+			"labs": {goRepository("labs/shared", "Go"), goRepository("labs/tool", "Go")},
+		},
+	}
+	s := newFakeSearch(t, f, "github.com/x/lib")
+	results, err := s.SearchOrgs(context.Background(), []string{"acme", "labs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]bool{"acme/api": true, "acme/web": false, "labs/shared": true, "labs/tool": true}
+	if len(results) != len(want) {
+		t.Errorf("results %v, want %v", results, want)
+	}
+	for name, used := range want {
+		if r, ok := results[name]; !ok || r.used != used {
+			t.Errorf("%s used: %v, found: %v, want used: %v", name, r.used, ok, used)
+		}
+	}
+	// labs/shared is listed by both organizations
+	if n := f.requested("/search/code"); n != len(want) {
+		t.Errorf("%d repositories checked, want %d", n, len(want))
+	}
+}
+
+func TestRepoOrg(t *testing.T) {
+	orgs := []string{"acme", "Labs"}
+	tests := []struct {
+		repo string
+		want string
+	}{
+		{repo: "acme/api", want: "acme"},
+		{repo: "ACME/api", want: "acme"},
+		{repo: "labs/tool", want: "Labs"},
+		{repo: "acme-corp/api"},
+		{repo: "jdoe/acme"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.repo, func(t *testing.T) {
+			if got := repoOrg(tt.repo, orgs); got != tt.want {
+				t.Errorf("repoOrg(%q) = %q, want %q", tt.repo, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// outputFormats lists the supported values of the -output flag.
+var outputFormats = []string{"csv", "json", "table", "shell", "parquet", "yaml"}
+
+// field is a column of the results output.
+type field struct {
+	name string
+	// kind is the type of the value, as shown by -schema-dump
+	kind string
+	desc string
+	// optional values are an empty string when unknown
+	optional bool
+	// since is the outputSchemaVersion that added the field, 0 for 1
+	since int
+	value func(r repoResult) any
+}
+
+// knownFields are all the fields that can be selected with -fields.
+var knownFields = []field{
+	{name: "name", kind: "string", desc: "owner/repo full name of the repository", value: func(r repoResult) any { return r.name }},
+	{name: "used", kind: "bool", desc: "whether a go.mod of the repository requires the package", value: func(r repoResult) any { return r.used }},
+	{name: "stars", kind: "int", desc: "stargazer count of the repository", value: func(r repoResult) any { return r.stars }},
+	{name: "version", kind: "string", desc: "required version of the package, normalized", value: func(r repoResult) any { return r.version }},
+	{name: "raw_version", kind: "string", desc: "required version as written in the go.mod", value: func(r repoResult) any { return r.rawVersion }},
+	{name: "low_confidence", kind: "bool", desc: "set for results of incomplete code search results whose root go.mod could not be read", value: func(r repoResult) any { return r.lowConfidence }},
+	{name: "source", kind: "string", desc: "where the result comes from: code-search, dependents, root-go-mod or repo-search", value: func(r repoResult) any { return r.source }},
+	{name: "confidence", kind: "string", desc: "confidence of the result: high, medium or low", value: func(r repoResult) any { return r.confidence }},
+	{name: "module_kind", kind: "string", desc: "kind of the requiring module by its go.mod path: main, nested or test", value: func(r repoResult) any { return r.moduleKind }},
+	{name: "branch", kind: "string", desc: "branch of -branch the go.mod files were read at, empty when they were read at the default branch", value: func(r repoResult) any { return r.branch }},
+	{name: "state", kind: "string", desc: "state needing attention: anomaly, skipped (mirror), partial-scan, not-found, skipped (oversized go.mod) or skipped (slow)", value: func(r repoResult) any { return r.state }},
+	{name: "vendored", kind: "bool", desc: "whether the repository vendors the package, empty when not checked", optional: true, value: func(r repoResult) any {
+		if !r.vendorChecked {
+			return ""
+		}
+		return r.vendored
+	}},
+	{name: "gosum_versions", kind: "string", desc: "versions of the package the go.sum locks, space separated, see -check-gosum", since: 5, value: func(r repoResult) any { return strings.Join(r.goSumVersions, " ") }},
+	{name: "gosum_mismatch", kind: "bool", desc: "whether the go.sum locks none of the required version, empty when not checked", optional: true, since: 5, value: func(r repoResult) any {
+		if !r.goSumChecked {
+			return ""
+		}
+		return r.goSumMismatch
+	}},
+	{name: "meets_min_version", kind: "bool", desc: "whether the adopter requires -require-min-version or later, empty without it", optional: true, since: 2, value: func(r repoResult) any {
+		if r.minVersion == "" || !r.used {
+			return ""
+		}
+		return r.meetsMinVersion()
+	}},
+	{name: "gomod_path", kind: "string", desc: "go.mod file requiring the package, one row per go.mod with -granularity module", since: 3, value: func(r repoResult) any { return r.goModPath }},
+	{name: "gomod_sha", kind: "string", desc: "blob SHA of the go.mod the result is based on, empty when unknown", since: 4, value: func(r repoResult) any { return r.goModSHA }},
+	{name: "default_branch", kind: "string", desc: "default branch of the repository, empty when unknown", since: 4, value: func(r repoResult) any { return r.defaultBranch }},
+	{name: "module", kind: "string", desc: "module the repository requires, one of the -pkg-owner modules or the package", value: func(r repoResult) any { return r.module }},
+	{name: "own_module", kind: "string", desc: "module path declared by the go.mod requiring the package", since: 8, value: func(r repoResult) any { return r.ownModule }},
+	{name: "hosting", kind: "string", desc: "where the adopter is developed by its module path: github, mirror of another forge, or vanity domain", since: 8, value: func(r repoResult) any { return r.hosting }},
+	{name: "fork", kind: "string", desc: "module@version the package is replaced with, if any", value: func(r repoResult) any { return r.fork }},
+	{name: "tool", kind: "bool", desc: "set when the package is used through a go.mod tool directive", value: func(r repoResult) any { return r.tool }},
+	{name: "stale_indirect", kind: "bool", desc: "set when the package is required as indirect but imported", value: func(r repoResult) any { return r.staleIndirect }},
+	{name: "direct_requires", kind: "int", desc: "number of direct requirements of the go.mod requiring the package, 0 when unknown", since: 6, value: func(r repoResult) any { return r.directRequires }},
+	{name: "dependency_share", kind: "float", desc: "1 / direct_requires, how central the package is among the dependencies of the adopter, 0 when unknown", since: 6, value: func(r repoResult) any { return r.dependencyShare() }},
+	{name: "usage_files", kind: "int", desc: "number of Go files of the repository importing the package, empty when not counted, see -usage-files", optional: true, since: 7, value: func(r repoResult) any {
+		if !r.usageChecked {
+			return ""
+		}
+		return r.usageFiles
+	}},
+	{name: "test_only", kind: "bool", desc: "whether every Go file of the repository importing the package is a _test.go file, empty when not classified, see -classify-test-usage", optional: true, since: 9, value: func(r repoResult) any {
+		if !r.testUsageChecked {
+			return ""
+		}
+		return r.testOnly
+	}},
+	{name: "scan_ms", kind: "int", desc: "wall time of the last inspection of the repository in milliseconds, empty when unknown", optional: true, since: 10, value: func(r repoResult) any {
+		if r.scanDuration <= 0 {
+			return ""
+		}
+		return int(r.scanDuration.Milliseconds())
+	}},
+	{name: "size_kb", kind: "int", desc: "repository size in KB reported by GitHub, 0 when unknown", value: func(r repoResult) any { return r.sizeKB }},
+	{name: "score", kind: "float", desc: "code search relevance score of the matching go.mod", value: func(r repoResult) any { return r.score }},
+	{name: "forks", kind: "int", desc: "fork count of the repository", value: func(r repoResult) any { return r.forks }},
+	{name: "created_at", kind: "time", desc: "creation time of the repository, RFC 3339, empty when unknown", value: func(r repoResult) any { return formatTime(r.createdAt) }},
+	{name: "pushed_at", kind: "time", desc: "last push time of the repository, RFC 3339, empty when unknown", value: func(r repoResult) any { return formatTime(r.pushedAt) }},
+	{name: "archived", kind: "bool", desc: "whether the repository is archived", value: func(r repoResult) any { return r.archived }},
+	{name: "enriched_at", kind: "time", desc: "time the metadata was last fetched by the enrichment, RFC 3339", value: func(r repoResult) any { return formatTime(r.enrichedAt) }},
+	{name: "url", kind: "string", desc: "repository URL, empty for anonymized results", value: func(r repoResult) any { return r.url() }},
+	{name: "org", kind: "string", desc: "-org organization owning the repository", value: func(r repoResult) any { return r.org }},
+	{name: "notes", kind: "string", desc: "note from the -notes file", value: func(r repoResult) any { return r.notes }},
+}
+
+// url returns the repository URL, or an empty string for redacted results.
+func (r repoResult) url() string {
+	if r.redacted {
+		return ""
+	}
+	return "https://github.com/" + r.name
+}
+
+// sortKeys are the supported values of the -sort flag, all sort descending.
+var sortKeys = map[string]func(a, b repoResult) bool{
+	"stars":            func(a, b repoResult) bool { return a.stars > b.stars },
+	"size":             func(a, b repoResult) bool { return a.sizeKB > b.sizeKB },
+	"dependency-share": func(a, b repoResult) bool { return a.dependencyShare() > b.dependencyShare() },
+}
+
+// tiebreaks are the supported values of the -tiebreak flag, they order
+// results with the same star count.
+var tiebreaks = map[string]func(a, b repoResult) bool{
+	"name":   func(a, b repoResult) bool { return a.name < b.name },
+	"pushed": func(a, b repoResult) bool { return a.pushedAt.After(b.pushedAt) },
+	"forks":  func(a, b repoResult) bool { return a.forks > b.forks },
+}
+
+// sortResults sorts the results by stars, descending. Ties are broken by the
+// tiebreak and then by name, so the order is stable across runs.
+func sortResults(results []repoResult, tiebreak string) {
+	less := tiebreaks[tiebreak]
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		switch {
+		case a.stars != b.stars:
+			return a.stars > b.stars
+		case less(a, b):
+			return true
+		case less(b, a):
+			return false
+		}
+		return a.name < b.name
+	})
+}
+
+// formatTime formats t as RFC 3339 in UTC, the zero time as "".
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+var defaultFields = []string{"name", "used", "stars", "version"}
+
+// parseFields turns a comma separated list of field names into fields,
+// keeping the given order.
+func parseFields(spec string) ([]field, error) {
+	var fields []field
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		found := false
+		for _, f := range knownFields {
+			if f.name == name {
+				fields = append(fields, f)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown field: %s", name)
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no fields selected")
+	}
+
+	return fields, nil
+}
+
+// writeOutputFile writes the results to fileName, or to stdout when it is "-".
+func writeOutputFile(fileName, format, packageName string, fields []field, results []repoResult) error {
+	if fileName == "-" {
+		return writeOutput(os.Stdout, format, packageName, fields, results)
+	}
+
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := writeOutput(file, format, packageName, fields, results); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// writeOutput writes the selected fields of the results in the given format.
+func writeOutput(w io.Writer, format, packageName string, fields []field, results []repoResult) error {
+	switch format {
+	case "csv":
+		return writeCSV(w, fields, results)
+	case "json":
+		return writeJSON(w, fields, results)
+	case "table":
+		return writeTable(w, fields, results)
+	case "shell":
+		return writeShell(w, results)
+	case "parquet":
+		return writeParquet(w, packageName, results)
+	case "yaml":
+		return writeYAML(w, packageName, fields, results)
+	default:
+		return fmt.Errorf("unknown output format: %s", format)
+	}
+}
+
+func writeCSV(w io.Writer, fields []field, results []repoResult) error {
+	writer := csv.NewWriter(w)
+
+	header := make([]string, 0, len(fields))
+	for _, f := range fields {
+		header = append(header, f.name)
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		row := make([]string, 0, len(fields))
+		for _, f := range fields {
+			row = append(row, fmt.Sprint(f.value(r)))
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeJSON writes an array of objects. The objects are assembled by hand so
+// the keys keep the order of the selected fields. The array has no envelope
+// for the schema version, the manifest of the run records it.
+func writeJSON(w io.Writer, fields []field, results []repoResult) error {
+	var sb strings.Builder
+	sb.WriteString("[")
+	for i, r := range results {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString("\n  {")
+		for j, f := range fields {
+			if j > 0 {
+				sb.WriteString(", ")
+			}
+			key, _ := json.Marshal(f.name)
+			value, err := json.Marshal(f.value(r))
+			if err != nil {
+				return err
+			}
+			sb.Write(key)
+			sb.WriteString(": ")
+			sb.Write(value)
+		}
+		sb.WriteString("}")
+	}
+	if len(results) > 0 {
+		sb.WriteString("\n")
+	}
+	sb.WriteString("]\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// writeYAML writes the summary and the results as YAML meant to be kept in
+// git: the rows are sorted by name rather than by stars, so that star changes
+// don't move them, and the keys keep the order of the selected fields.
+// Scalars are written as JSON, which is valid YAML and quotes every string.
+// The output schema version goes next to the package.
+func writeYAML(w io.Writer, packageName string, fields []field, results []repoResult) error {
+	sorted := append([]repoResult(nil), results...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+
+	s := summarize(results)
+	var sb strings.Builder
+	pkg, _ := json.Marshal(packageName)
+	fmt.Fprintf(&sb, "package: %s\n", pkg)
+	fmt.Fprintf(&sb, "schema_version: %d\n", outputSchemaVersion)
+	fmt.Fprintf(&sb, "summary:\n  adopters: %d\n  reach: %d\n  repositories: %d\n  low_confidence: %d\n",
+		s.adopters, s.reach, s.repositories, s.lowConfidence)
+	if len(sorted) == 0 {
+		sb.WriteString("results: []\n")
+	} else {
+		sb.WriteString("results:\n")
+	}
+	for _, r := range sorted {
+		for j, f := range fields {
+			value, err := json.Marshal(f.value(r))
+			if err != nil {
+				return err
+			}
+			indent := "    "
+			if j == 0 {
+				indent = "  - "
+			}
+			fmt.Fprintf(&sb, "%s%s: %s\n", indent, f.name, value)
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func writeTable(w io.Writer, fields []field, results []repoResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	header := make([]string, 0, len(fields))
+	for _, f := range fields {
+		header = append(header, strings.ToUpper(f.name))
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for _, r := range results {
+		row := make([]string, 0, len(fields))
+		for _, f := range fields {
+			row = append(row, fmt.Sprint(f.value(r)))
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+// writeShell writes the summary as key=value pairs on a single line, for use
+// in shell scripts.
+func writeShell(w io.Writer, results []repoResult) error {
+	s := summarize(results)
+	_, err := fmt.Fprintf(w, "adopters=%d reach=%d repositories=%d low_confidence=%d\n",
+		s.adopters, s.reach, s.repositories, s.lowConfidence)
+	return err
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFields(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []string
+		wantErr bool
+	}{
+		{spec: "name,stars,version,url", want: []string{"name", "stars", "version", "url"}},
+		{spec: "url, version ,name", want: []string{"url", "version", "name"}},
+		{spec: "stars,,name,", want: []string{"stars", "name"}},
+		{spec: "name,popularity", wantErr: true},
+		{spec: " , ", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			fields, err := parseFields(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want one: %v", err, tt.wantErr)
+			}
+			if got := fieldNames(fields); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("fields %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteOutputFieldOrder(t *testing.T) {
+	fields, err := parseFields("version,name,stars")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := []repoResult{
+		{name: "a/one", used: true, stars: 10, version: "v1.2.0"},
+		{name: "a/two", used: true, stars: 5, version: "v1.0.0"},
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{format: "csv", want: "version,name,stars\nv1.2.0,a/one,10\nv1.0.0,a/two,5\n"},
+		{format: "table", want: "VERSION  NAME   STARS\nv1.2.0   a/one  10\nv1.0.0   a/two  5\n"},
+		{format: "json", want: "[\n  {\"version\": \"v1.2.0\", \"name\": \"a/one\", \"stars\": 10},\n  {\"version\": \"v1.0.0\", \"name\": \"a/two\", \"stars\": 5}\n]\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeOutput(&buf, tt.format, "example.com/pkg", fields, results); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("output\n%s\nwant\n%s", buf.String(), tt.want)
+			}
+			if tt.format == "json" && !json.Valid(buf.Bytes()) {
+				t.Error("invalid JSON")
+			}
+		})
+	}
+}
+
+func fieldNames(fields []field) []string {
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.name
+	}
+	return names
+}
+
+func TestWriteShell(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []repoResult
+		want    string
+	}{
+		{
+			name: "adopters",
+			results: []repoResult{
+				{name: "a/one", used: true, stars: 10, confidence: confidenceHigh},
+				{name: "a/two", used: true, stars: 5, confidence: confidenceHigh},
+				{name: "a/three", stars: 50, confidence: confidenceHigh},
+				{name: "a/four", used: true, stars: 7, lowConfidence: true, confidence: confidenceLow},
+			},
+			want: "adopters=2 reach=15 repositories=4 low_confidence=1\n",
+		},
+		{name: "no results", want: "adopters=0 reach=0 repositories=0 low_confidence=0\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeOutput(&buf, "shell", "example.com/pkg", nil, tt.results); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("output %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestSortResultsTiebreak(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 1, d, 0, 0, 0, 0, time.UTC) }
+	results := []repoResult{
+		{name: "b/beta", stars: 10, forks: 1, pushedAt: day(3)},
+		{name: "a/top", stars: 50, forks: 0, pushedAt: day(1)},
+		{name: "c/gamma", stars: 10, forks: 7, pushedAt: day(1)},
+		{name: "a/alpha", stars: 10, forks: 3, pushedAt: day(2)},
+		{name: "d/delta", stars: 10, forks: 7, pushedAt: day(2)},
+		{name: "z/last", stars: 2, forks: 9, pushedAt: day(9)},
+	}
+	tests := []struct {
+		tiebreak string
+		want     []string
+	}{
+		{tiebreak: "name", want: []string{"a/top", "a/alpha", "b/beta", "c/gamma", "d/delta", "z/last"}},
+		{tiebreak: "pushed", want: []string{"a/top", "b/beta", "a/alpha", "d/delta", "c/gamma", "z/last"}},
+		// equal forks fall back to the name
+		{tiebreak: "forks", want: []string{"a/top", "c/gamma", "d/delta", "a/alpha", "b/beta", "z/last"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tiebreak, func(t *testing.T) {
+			sorted := append([]repoResult(nil), results...)
+			sortResults(sorted, tt.tiebreak)
+			var got []string
+			for _, r := range sorted {
+				got = append(got, r.name)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("order %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteYAMLDeterministic(t *testing.T) {
+	fields, err := parseFields("name,stars,version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := []repoResult{
+		{name: "b/two", used: true, stars: 50, version: "v1.0.0", confidence: confidenceHigh},
+		{name: "a/one", used: true, stars: 10, version: "v1.2.0", confidence: confidenceHigh},
+		{name: "c/three", stars: 99, confidence: confidenceLow},
+	}
+	want := `package: "example.com/pkg"
+schema_version: ` + strconv.Itoa(outputSchemaVersion) + `
+summary:
+  adopters: 2
+  reach: 60
+  repositories: 3
+  low_confidence: 0
+results:
+  - name: "a/one"
+    stars: 10
+    version: "v1.2.0"
+  - name: "b/two"
+    stars: 50
+    version: "v1.0.0"
+  - name: "c/three"
+    stars: 99
+    version: ""
+`
+
+	tests := []struct {
+		name  string
+		order []int
+	}{
+		{name: "by stars", order: []int{2, 0, 1}},
+		{name: "by name", order: []int{1, 0, 2}},
+		{name: "reversed", order: []int{2, 1, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ordered := make([]repoResult, len(tt.order))
+			for i, j := range tt.order {
+				ordered[i] = results[j]
+			}
+			var buf bytes.Buffer
+			if err := writeYAML(&buf, "example.com/pkg", fields, ordered); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != want {
+				t.Errorf("output\n%s\nwant\n%s", buf.String(), want)
+			}
+		})
+	}
+
+	// a star change only changes its line
+	changed := append([]repoResult(nil), results...)
+	changed[0].stars = 51
+	var before, after bytes.Buffer
+	if err := writeYAML(&before, "example.com/pkg", fields, results); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeYAML(&after, "example.com/pkg", fields, changed); err != nil {
+		t.Fatal(err)
+	}
+	beforeLines, afterLines := strings.Split(before.String(), "\n"), strings.Split(after.String(), "\n")
+	var diff []string
+	for i := range beforeLines {
+		if beforeLines[i] != afterLines[i] {
+			diff = append(diff, afterLines[i])
+		}
+	}
+	if len(diff) != 2 {
+		t.Errorf("changed lines %q, want the reach and the stars of b/two", diff)
+	}
+}
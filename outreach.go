@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"golang.org/x/mod/semver"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// outreachMessage is the data passed to outreach templates, one per adopter
+// of an outdated version.
+type outreachMessage struct {
+	Package string
+	Repo    string
+	URL     string
+	Stars   int
+	Version string
+	Target  string
+}
+
+// latestVersion returns the highest valid semver version used by the
+// adopters, or "" if there is none.
+func latestVersion(results []repoResult) string {
+	latest := ""
+	for _, r := range results {
+		if !r.used || !semver.IsValid(r.version) {
+			continue
+		}
+		if latest == "" || semver.Compare(r.version, latest) > 0 {
+			latest = r.version
+		}
+	}
+	return latest
+}
+
+// outdatedAdopters returns the adopters using a version older than target.
+// Anonymized results are left out, there is no one to address.
+func outdatedAdopters(results []repoResult, target string) []repoResult {
+	var outdated []repoResult
+	for _, r := range results {
+		if !r.used || r.redacted || !semver.IsValid(r.version) {
+			continue
+		}
+		if semver.Compare(r.version, target) < 0 {
+			outdated = append(outdated, r)
+		}
+	}
+	return outdated
+}
+
+// renderOutreach executes an outreach template for one adopter.
+func renderOutreach(w io.Writer, tmpl *template.Template, text string, msg outreachMessage) error {
+	if err := tmpl.Execute(w, msg); err != nil {
+		return templateError(err, text)
+	}
+	return nil
+}
+
+// writeOutreach renders the template for every adopter older than target
+// into dir, one Markdown file per repository named owner-repo.md. Nothing is
+// posted anywhere. It returns the number of messages written.
+func writeOutreach(dir, templateFile, packageName, target string, results []repoResult) (int, error) {
+	if !semver.IsValid(target) {
+		return 0, fmt.Errorf("invalid outreach target version: %q", target)
+	}
+
+	tmpl, text, err := parseTemplate(templateFile)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, fmt.Errorf("error creating the outreach directory: %v", err)
+	}
+
+	outdated := outdatedAdopters(results, target)
+	for _, r := range outdated {
+		var sb strings.Builder
+		err := renderOutreach(&sb, tmpl, text, outreachMessage{
+			Package: packageName,
+			Repo:    r.name,
+			URL:     r.url(),
+			Stars:   r.stars,
+			Version: r.version,
+			Target:  target,
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		fileName := filepath.Join(dir, strings.ReplaceAll(r.name, "/", "-")+".md")
+		if err := os.WriteFile(fileName, []byte(sb.String()), 0644); err != nil {
+			return 0, fmt.Errorf("error writing the outreach message: %v", err)
+		}
+	}
+	return len(outdated), nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteOutreach(t *testing.T) {
+	dir := t.TempDir()
+	templateFile := filepath.Join(dir, "outreach.md.tmpl")
+	tmpl := "Hi {{.Repo}} ({{.Stars}} stars),\n{{.URL}} requires {{.Package}}@{{.Version}}, {{.Target}} is out.\n"
+	if err := os.WriteFile(templateFile, []byte(tmpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+	results := []repoResult{
+		{name: "acme/api", used: true, stars: 1200, version: "v1.1.0"},
+		{name: "acme/web", used: true, stars: 800, version: "v1.4.0"},
+		{name: "repo-3f1c2a9b7e10", used: true, stars: 100, version: "v1.0.0", redacted: true},
+		{name: "acme/cli", stars: 50},
+	}
+
+	outDir := filepath.Join(dir, "outreach")
+	n, err := writeOutreach(outDir, templateFile, "github.com/x/lib", "v1.4.0", results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("%d messages, want 1", n)
+	}
+	entries, err := os.ReadDir(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "acme-api.md" {
+		t.Fatalf("files %v, want acme-api.md", entries)
+	}
+	got, err := os.ReadFile(filepath.Join(outDir, "acme-api.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Hi acme/api (1200 stars),\nhttps://github.com/acme/api requires github.com/x/lib@v1.1.0, v1.4.0 is out.\n"
+	if string(got) != want {
+		t.Errorf("message\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWriteOutreachErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		tmpl    string
+		target  string
+		wantErr string
+	}{
+		{name: "invalid target", tmpl: "{{.Repo}}", target: "latest", wantErr: "invalid outreach target version"},
+		{name: "unknown field", tmpl: "Hi\n{{.Owner}}\n", target: "v1.4.0", wantErr: "2 | {{.Owner}}"},
+		{name: "syntax error", tmpl: "Hi {{.Repo}\n", target: "v1.4.0", wantErr: "1 | Hi {{.Repo}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			templateFile := filepath.Join(dir, "outreach.md.tmpl")
+			if err := os.WriteFile(templateFile, []byte(tt.tmpl), 0644); err != nil {
+				t.Fatal(err)
+			}
+			results := []repoResult{{name: "acme/api", used: true, stars: 1200, version: "v1.1.0"}}
+			_, err := writeOutreach(filepath.Join(dir, "outreach"), templateFile, "github.com/x/lib", tt.target, results)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error %v, want one with %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ownerPackage is the package name standing for the modules of a
+// -pkg-owner organization: it names the cache and the reports, and is the
+// code search term, matching the go.mod files that mention any of them.
+func ownerPackage(owner string) string {
+	return "github.com/" + owner
+}
+
+// ownerModules returns the module paths declared by the root go.mod files of
+// the Go repositories of the organization. Forks are left out, their module
+// path is usually the one of the upstream repository.
+func (s *searchResult) ownerModules(ctx context.Context, owner string) ([]string, error) {
+	candidates, err := s.orgCandidates(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var modules []string
+	for _, repo := range candidates {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if repo.fork || repo.archived {
+			continue
+		}
+		f, _, err := s.fetchGoMod(ctx, repo, "go.mod", "")
+		if err != nil {
+			logf("Skipping repository %s of %s: %v\n", repo.name, owner, err)
+			continue
+		}
+		if f.Module == nil || seen[f.Module.Mod.Path] {
+			continue
+		}
+		module := f.Module.Mod.Path
+		seen[module] = true
+		modules = append(modules, module)
+		if !strings.HasPrefix(module, ownerPackage(owner)+"/") {
+			// the code search looks for ownerPackage, go.mod files only
+			// requiring this module are missed
+			logf("warning: module %s of %s is not under %s, only adopters also requiring another module of %s are found\n",
+				module, repo.name, ownerPackage(owner), owner)
+		}
+	}
+	if len(modules) == 0 {
+		return nil, fmt.Errorf("no Go modules found in the repositories of %s", owner)
+	}
+
+	sort.Strings(modules)
+	logf("found %d modules of %s: %s\n", len(modules), owner, strings.Join(modules, ", "))
+	return modules, nil
+}
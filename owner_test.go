@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"github.com/google/go-github/v63/github"
+	"strings"
+	"testing"
+)
+
+func TestOwnerModules(t *testing.T) {
+	forked := goRepository("x/forked", "Go")
+	forked.Fork = github.Bool(true)
+	f := &fakeGitHub{
+		repos: map[string]map[string]string{
+			"x/lib":    {"go.mod": "module github.com/x/lib\n"},
+			"x/cli":    {"go.mod": "module github.com/x/cli/v2\n"},
+			"x/forked": {"go.mod": "module github.com/upstream/forked\n"},
+			"x/docs":   {"README.md": "no go.mod"},
+			"a/one":    {"go.mod": goModRequiring("v1.0.0")},
+			"a/two":    {"go.mod": "module example.com/two\n\nrequire github.com/x/cli/v2 v2.1.0\n"},
+			"a/three":  {"go.mod": "module example.com/three\n\nrequire github.com/x/other v1.0.0\n"},
+		},
+		orgs: map[string][]*github.Repository{
+			"x": {goRepository("x/lib", "Go"), goRepository("x/cli", "Go"), forked, goRepository("x/docs", "Go")},
+		},
+	}
+	s := newFakeSearch(t, f, ownerPackage("x"))
+	modules, err := s.ownerModules(context.Background(), "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(modules, ","); got != "github.com/x/cli/v2,github.com/x/lib" {
+		t.Fatalf("modules %s, want the ones of x/cli and x/lib", got)
+	}
+
+	s.modules = modules
+	results, err := s.searchInRepositories(context.Background(), []candidate{fakeCandidate("a/one", 10), fakeCandidate("a/two", 10), fakeCandidate("a/three", 10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		repo        string
+		wantUsed    bool
+		wantModule  string
+		wantVersion string
+	}{
+		{repo: "a/one", wantUsed: true, wantModule: "github.com/x/lib", wantVersion: "v1.0.0"},
+		{repo: "a/two", wantUsed: true, wantModule: "github.com/x/cli/v2", wantVersion: "v2.1.0"},
+		{repo: "a/three"},
+	}
+	for _, tt := range tests {
+		got := results[tt.repo]
+		if got.used != tt.wantUsed || got.used && (got.module != tt.wantModule || got.rawVersion != tt.wantVersion) {
+			t.Errorf("%s: used %v, module %s@%s, want %v, %s@%s", tt.repo, got.used, got.module, got.rawVersion, tt.wantUsed, tt.wantModule, tt.wantVersion)
+		}
+	}
+}
+
+func TestOwnerModulesNone(t *testing.T) {
+	f := &fakeGitHub{
+		repos: map[string]map[string]string{"x/docs": {"README.md": "no go.mod"}},
+		orgs:  map[string][]*github.Repository{"x": {goRepository("x/docs", "Go")}},
+	}
+	s := newFakeSearch(t, f, ownerPackage("x"))
+	if modules, err := s.ownerModules(context.Background(), "x"); err == nil {
+		t.Errorf("modules %v, want an error for an organization without modules", modules)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+	"io"
+	"strconv"
+	"time"
+)
+
+// parquetRow is a row of the -output parquet file. Its schema is stable,
+// it doesn't depend on -fields, so files of different runs and packages can
+// be read together.
+type parquetRow struct {
+	Package    string `parquet:"name=package, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Repo       string `parquet:"name=repo, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Used       bool   `parquet:"name=used, type=BOOLEAN"`
+	Stars      int64  `parquet:"name=stars, type=INT64"`
+	Version    string `parquet:"name=version, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Confidence string `parquet:"name=confidence, type=BYTE_ARRAY, convertedtype=UTF8"`
+	// the timestamps are Unix milliseconds, unknown ones are null
+	CreatedAt *int64 `parquet:"name=created_at, type=INT64, convertedtype=TIMESTAMP_MILLIS, repetitiontype=OPTIONAL"`
+	PushedAt  *int64 `parquet:"name=pushed_at, type=INT64, convertedtype=TIMESTAMP_MILLIS, repetitiontype=OPTIONAL"`
+	ScannedAt int64  `parquet:"name=scanned_at, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+}
+
+func parquetTime(t time.Time) *int64 {
+	if t.IsZero() {
+		return nil
+	}
+	ms := t.UnixMilli()
+	return &ms
+}
+
+// writeParquet writes the results as a Snappy compressed Parquet file. The
+// package of a row is the module it requires with -pkg-owner, the package
+// otherwise. The output schema version is in the schema_version key of the
+// file metadata.
+func writeParquet(w io.Writer, packageName string, results []repoResult) error {
+	pw, err := writer.NewParquetWriterFromWriter(w, new(parquetRow), 1)
+	if err != nil {
+		return fmt.Errorf("error creating the parquet writer: %v", err)
+	}
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+
+	scannedAt := time.Now().UnixMilli()
+	for _, r := range results {
+		pkg := packageName
+		if r.module != "" {
+			pkg = r.module
+		}
+		row := parquetRow{
+			Package:    pkg,
+			Repo:       r.name,
+			Used:       r.used,
+			Stars:      int64(r.stars),
+			Version:    r.version,
+			Confidence: r.confidence,
+			CreatedAt:  parquetTime(r.createdAt),
+			PushedAt:   parquetTime(r.pushedAt),
+			ScannedAt:  scannedAt,
+		}
+		if err := pw.Write(row); err != nil {
+			return fmt.Errorf("error writing parquet row: %v", err)
+		}
+	}
+	version := strconv.Itoa(outputSchemaVersion)
+	pw.Footer.KeyValueMetadata = append(pw.Footer.KeyValueMetadata, &parquet.KeyValue{Key: "schema_version", Value: &version})
+	return pw.WriteStop()
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWriteParquet(t *testing.T) {
+	created := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	pushed := time.Date(2024, 6, 30, 8, 15, 0, 0, time.UTC)
+	results := []repoResult{
+		{name: "a/one", used: true, stars: 1200, version: "v1.2.0", confidence: confidenceHigh, createdAt: created, pushedAt: pushed},
+		{name: "a/two", stars: 40, confidence: confidenceLow},
+		{name: "a/three", used: true, stars: 7, version: "v0.3.0", module: "github.com/acme/sub", confidence: confidenceMedium},
+	}
+	var buf bytes.Buffer
+	if err := writeParquet(&buf, "github.com/acme/lib", results); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := buffer.NewBufferFile(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr, err := reader.NewParquetReader(file, new(parquetRow), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.ReadStop()
+
+	// the schema is stable, whatever the results
+	wantTypes := map[string]parquet.Type{
+		"package":    parquet.Type_BYTE_ARRAY,
+		"repo":       parquet.Type_BYTE_ARRAY,
+		"used":       parquet.Type_BOOLEAN,
+		"stars":      parquet.Type_INT64,
+		"version":    parquet.Type_BYTE_ARRAY,
+		"confidence": parquet.Type_BYTE_ARRAY,
+		"created_at": parquet.Type_INT64,
+		"pushed_at":  parquet.Type_INT64,
+		"scanned_at": parquet.Type_INT64,
+	}
+	columns := 0
+	// the reader renames the columns of the footer after the struct fields,
+	// the names in the file are kept in the schema handler
+	for i, element := range pr.Footer.Schema[1:] {
+		name := pr.SchemaHandler.Infos[i+1].ExName
+		want, ok := wantTypes[name]
+		if !ok {
+			t.Errorf("unexpected column %s", name)
+			continue
+		}
+		columns++
+		if element.GetType() != want {
+			t.Errorf("column %s of type %s, want %s", name, element.GetType(), want)
+		}
+		if name == "created_at" && element.GetRepetitionType() != parquet.FieldRepetitionType_OPTIONAL {
+			t.Errorf("created_at is %s, want optional", element.GetRepetitionType())
+		}
+	}
+	if columns != len(wantTypes) {
+		t.Errorf("%d columns, want %d", columns, len(wantTypes))
+	}
+	var schemaVersion string
+	for _, kv := range pr.Footer.KeyValueMetadata {
+		if kv.Key == "schema_version" {
+			schemaVersion = kv.GetValue()
+		}
+	}
+	if want := strconv.Itoa(outputSchemaVersion); schemaVersion != want {
+		t.Errorf("schema_version %q, want %q", schemaVersion, want)
+	}
+
+	if n := pr.GetNumRows(); n != int64(len(results)) {
+		t.Fatalf("%d rows, want %d", n, len(results))
+	}
+	rows := make([]parquetRow, len(results))
+	if err := pr.Read(&rows); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		want      parquetRow
+		createdAt *time.Time
+		pushedAt  *time.Time
+	}{
+		{want: parquetRow{Package: "github.com/acme/lib", Repo: "a/one", Used: true, Stars: 1200, Version: "v1.2.0", Confidence: confidenceHigh}, createdAt: &created, pushedAt: &pushed},
+		{want: parquetRow{Package: "github.com/acme/lib", Repo: "a/two", Stars: 40, Confidence: confidenceLow}},
+		{want: parquetRow{Package: "github.com/acme/sub", Repo: "a/three", Used: true, Stars: 7, Version: "v0.3.0", Confidence: confidenceMedium}},
+	}
+	for i, tt := range tests {
+		got := rows[i]
+		if got.Package != tt.want.Package || got.Repo != tt.want.Repo || got.Used != tt.want.Used || got.Stars != tt.want.Stars || got.Version != tt.want.Version || got.Confidence != tt.want.Confidence {
+			t.Errorf("row %d: %+v, want %+v", i, got, tt.want)
+		}
+		checkTime := func(name string, got *int64, want *time.Time) {
+			switch {
+			case want == nil && got != nil:
+				t.Errorf("row %d: %s %d, want null", i, name, *got)
+			case want != nil && (got == nil || *got != want.UnixMilli()):
+				t.Errorf("row %d: %s %v, want %d", i, name, got, want.UnixMilli())
+			}
+		}
+		checkTime("created_at", got.CreatedAt, tt.createdAt)
+		checkTime("pushed_at", got.PushedAt, tt.pushedAt)
+		if got.ScannedAt <= 0 {
+			t.Errorf("row %d: scanned_at %d", i, got.ScannedAt)
+		}
+	}
+}
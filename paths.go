@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/samber/lo"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+)
+
+// legacyCacheDir is the directory in the working directory that held every
+// file before the XDG directories were used.
+const legacyCacheDir = "cache"
+
+// appPaths are the directories of pkgstats, following the XDG base
+// directories: config for settings, cache for data that can be fetched again
+// and state for the results, manifests and queues that can't.
+type appPaths struct {
+	config string
+	cache  string
+	state  string
+}
+
+// paths are the directories of the run, resolved by run.
+var paths = appPaths{config: legacyCacheDir, cache: legacyCacheDir, state: legacyCacheDir}
+
+// notifyQueue returns the file of the durable notification queue.
+func (p appPaths) notifyQueue() string {
+	return filepath.Join(p.state, "notify-queue.jsonl")
+}
+
+// resolvePaths returns the pkgstats directories under XDG_CONFIG_HOME,
+// XDG_CACHE_HOME and XDG_STATE_HOME or their platform equivalents. A
+// directory that can't be resolved, e.g. without a home directory, falls
+// back to legacyCacheDir.
+func resolvePaths() appPaths {
+	p := appPaths{}
+	for _, dir := range []struct {
+		path    *string
+		resolve func() (string, error)
+	}{
+		{path: &p.config, resolve: os.UserConfigDir},
+		{path: &p.cache, resolve: os.UserCacheDir},
+		{path: &p.state, resolve: userStateDir},
+	} {
+		base, err := dir.resolve()
+		if err != nil {
+			*dir.path = legacyCacheDir
+			continue
+		}
+		*dir.path = filepath.Join(base, "pkgstats")
+	}
+	return p
+}
+
+// userStateDir returns XDG_STATE_HOME, or its default ~/.local/state on
+// Unix. Other platforms have no state directory, the config one is used.
+func userStateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return dir, nil
+	}
+	switch runtime.GOOS {
+	case "windows", "darwin", "ios", "plan9":
+		return os.UserConfigDir()
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state"), nil
+}
+
+// printPaths is the `pkgstats paths` command.
+func printPaths(w io.Writer, p appPaths) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "config\t%s\n", p.config)
+	fmt.Fprintf(tw, "cache\t%s\n", p.cache)
+	fmt.Fprintf(tw, "state\t%s\tresult caches, manifests, notification queue\n", p.state)
+	return tw.Flush()
+}
+
+// isLegacyCacheFile reports whether a file of the legacy ./cache directory
+// was written by pkgstats: a cache, a history, a manifest or the notification
+// queue. Any other file is left where it is.
+func isLegacyCacheFile(name string) bool {
+	return strings.HasSuffix(name, ".csv") || strings.HasSuffix(name, ".csv.gz") ||
+		strings.HasSuffix(name, ".manifest.json") || name == filepath.Base(paths.notifyQueue())
+}
+
+// hasLegacyCache reports whether the legacy ./cache directory holds files
+// to migrate to the state directory.
+func hasLegacyCache(stateDir string) bool {
+	if filepath.Clean(stateDir) == legacyCacheDir {
+		return false
+	}
+	entries, _ := os.ReadDir(legacyCacheDir)
+	return lo.ContainsBy(entries, func(entry os.DirEntry) bool {
+		return !entry.IsDir() && isLegacyCacheFile(entry.Name())
+	})
+}
+
+// migrateLegacyCache moves the pkgstats files of the legacy ./cache directory
+// to the state directory: files already in the state directory are left
+// alone, and the legacy directory is removed when it ends up empty.
+func migrateLegacyCache(stateDir string) error {
+	if filepath.Clean(stateDir) == legacyCacheDir {
+		return nil
+	}
+	entries, err := os.ReadDir(legacyCacheDir)
+	if os.IsNotExist(err) {
+		logf("no %s directory to migrate\n", legacyCacheDir)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	moved := 0
+	for _, entry := range entries {
+		from := filepath.Join(legacyCacheDir, entry.Name())
+		if entry.IsDir() || !isLegacyCacheFile(entry.Name()) {
+			logf("not migrating %s, not a pkgstats file\n", from)
+			continue
+		}
+		if moved == 0 {
+			if err := os.MkdirAll(stateDir, 0755); err != nil {
+				return err
+			}
+		}
+		to := filepath.Join(stateDir, entry.Name())
+		if _, err := os.Stat(to); err == nil {
+			logf("not migrating %s, %s already exists\n", from, to)
+			continue
+		}
+		if err := moveFile(from, to); err != nil {
+			return fmt.Errorf("error moving %s to %s: %v", from, to, err)
+		}
+		logf("migrated %s to %s\n", from, to)
+		moved++
+	}
+	logf("migrated %d files to %s\n", moved, stateDir)
+
+	// only succeeds when nothing is left
+	os.Remove(legacyCacheDir)
+	return nil
+}
+
+// moveFile renames a file, copying it when the rename crosses file systems.
+func moveFile(from, to string) error {
+	err := os.Rename(from, to)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(to)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(to)
+		return err
+	}
+	return os.Remove(from)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/google/go-github/v63/github"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// scanPlan is what a run is about to do, printed before any real work so a
+// mistyped flag is noticed before it pollutes a cache.
+type scanPlan struct {
+	pkg string
+	// module is the module searched for, pkg normalized
+	module  string
+	source  string
+	queries []string
+	// estimate is the number of repositories the queries match, -1 when
+	// unknown
+	estimate  int
+	cacheFile string
+	store     string
+	outputs   []string
+}
+
+// estimateCandidates returns the number of repositories the search queries
+// match, with one single-result search per query, or -1 if a search fails.
+func estimateCandidates(ctx context.Context, client *github.Client, queries []string) int {
+	total := 0
+	for _, query := range queries {
+		result, _, err := client.Search.Repositories(ctx, query, &github.SearchOptions{ListOptions: github.ListOptions{PerPage: 1}})
+		if err != nil {
+			logf("error estimating the candidates of %q: %v\n", query, withRequestID(err))
+			return -1
+		}
+		total += min(result.GetTotal(), searchResultCap)
+	}
+	return total
+}
+
+func (p scanPlan) write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "package\t%s\n", p.pkg)
+	if p.module != p.pkg {
+		fmt.Fprintf(tw, "module\t%s\n", p.module)
+	}
+	fmt.Fprintf(tw, "source\t%s\n", p.source)
+	for _, query := range p.queries {
+		fmt.Fprintf(tw, "query\t%s\n", query)
+	}
+	switch {
+	case len(p.queries) == 0:
+	case p.estimate < 0:
+		fmt.Fprintf(tw, "candidates\tunknown\n")
+	default:
+		fmt.Fprintf(tw, "candidates\tup to %d\n", p.estimate)
+	}
+	fmt.Fprintf(tw, "cache\t%s (%s)\n", p.cacheFile, p.store)
+	if len(p.outputs) == 0 {
+		fmt.Fprintf(tw, "outputs\tnone\n")
+	}
+	for _, output := range p.outputs {
+		fmt.Fprintf(tw, "output\t%s\n", output)
+	}
+	return tw.Flush()
+}
+
+// planOutputs describes where the run writes its results besides the cache.
+func planOutputs(format, file, reportTmpl, reportJSON, outreachTmpl, outreachDir, pushgateway string) []string {
+	target := file
+	if target == "-" {
+		target = "stdout"
+	}
+	var outputs []string
+	if format != "" {
+		outputs = append(outputs, format+" to "+target)
+	}
+	if reportTmpl != "" {
+		outputs = append(outputs, "report "+reportTmpl+" to "+target)
+	}
+	if reportJSON != "" {
+		outputs = append(outputs, "report data to "+reportJSON)
+	}
+	if outreachTmpl != "" {
+		outputs = append(outputs, "outreach messages to "+outreachDir)
+	}
+	if pushgateway != "" {
+		outputs = append(outputs, "metrics to "+pushgateway)
+	}
+	return outputs
+}
+
+// isTerminal reports whether the file is a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// askConfirmation reports whether the plan is confirmed before the run: when
+// stdin is a terminal, unless -yes is set or stdin is the cache.
+func askConfirmation(assumeYes, stdinCache, terminal bool) bool {
+	return !assumeYes && !stdinCache && terminal
+}
+
+// confirmPlan asks on out whether to go on with the plan, and reads the
+// answer from in. Only y and yes go on.
+func confirmPlan(in io.Reader, out io.Writer) bool {
+	fmt.Fprint(out, "Continue? [y/N] ")
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAskConfirmation(t *testing.T) {
+	tests := []struct {
+		name       string
+		assumeYes  bool
+		stdinCache bool
+		terminal   bool
+		want       bool
+	}{
+		{name: "terminal", terminal: true, want: true},
+		{name: "terminal with -yes", assumeYes: true, terminal: true},
+		{name: "cache on stdin", stdinCache: true, terminal: true},
+		{name: "not a terminal", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := askConfirmation(tt.assumeYes, tt.stdinCache, tt.terminal); got != tt.want {
+				t.Errorf("askConfirmation = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// a file or a pipe is not a terminal, scheduled runs are never asked
+	file, err := os.Create(filepath.Join(t.TempDir(), "stdin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if isTerminal(file) {
+		t.Error("a file taken for a terminal")
+	}
+}
+
+func TestConfirmPlan(t *testing.T) {
+	tests := []struct {
+		answer string
+		want   bool
+	}{
+		{answer: "y\n", want: true},
+		{answer: "yes\n", want: true},
+		{answer: " YES \n", want: true},
+		{answer: "Y", want: true},
+		{answer: "\n"},
+		{answer: "n\n"},
+		{answer: "yep\n"},
+		// stdin closed without an answer
+		{answer: ""},
+	}
+	for _, tt := range tests {
+		t.Run(strings.TrimSpace(tt.answer), func(t *testing.T) {
+			var prompt bytes.Buffer
+			if got := confirmPlan(strings.NewReader(tt.answer), &prompt); got != tt.want {
+				t.Errorf("confirmPlan(%q) = %v, want %v", tt.answer, got, tt.want)
+			}
+			if !strings.Contains(prompt.String(), "[y/N]") {
+				t.Errorf("prompt %q", prompt.String())
+			}
+		})
+	}
+}
+
+func TestScanPlanWrite(t *testing.T) {
+	plan := scanPlan{
+		pkg:       "github.com/x/lib/pkg",
+		module:    "github.com/x/lib",
+		source:    "repository search",
+		queries:   []string{"language:go stars:>=10"},
+		estimate:  -1,
+		cacheFile: "/state/github.com-x-lib.csv",
+		store:     "file",
+		outputs:   planOutputs("csv", "-", "", "", "", "", ""),
+	}
+	var out bytes.Buffer
+	if err := plan.write(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"package     github.com/x/lib/pkg", "module      github.com/x/lib", "candidates  unknown", "cache       /state/github.com-x-lib.csv (file)", "output      csv to stdout"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("plan misses %q:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// metricsNotification is the push of the summary of the run to a Prometheus
+// pushgateway, grouped by job and package. The previous metrics of the group
+// are replaced.
+func metricsNotification(gatewayURL, packageName string, s summary, duration time.Duration) notification {
+	url := fmt.Sprintf("%s/metrics/job/pkgstats/package@base64/%s",
+		strings.TrimSuffix(gatewayURL, "/"),
+		base64.RawURLEncoding.EncodeToString([]byte(packageName)),
+	)
+	return newNotification("pushgateway", http.MethodPut, url, "text/plain; version=0.0.4", formatMetrics(s, duration))
+}
+
+// formatMetrics renders the summary in the Prometheus text exposition format.
+func formatMetrics(s summary, duration time.Duration) string {
+	var sb strings.Builder
+
+	metric := func(name, help string, value float64) {
+		fmt.Fprintf(&sb, "# HELP %s %s\n", name, help)
+		fmt.Fprintf(&sb, "# TYPE %s gauge\n", name)
+		fmt.Fprintf(&sb, "%s %g\n", name, value)
+	}
+
+	metric("pkgstats_repositories", "Number of repositories checked.", float64(s.repositories))
+	metric("pkgstats_adopters", "Number of repositories using the package.", float64(s.adopters))
+	metric("pkgstats_reach", "Total stars of the repositories using the package.", float64(s.reach))
+	metric("pkgstats_low_confidence_results", "Number of low-confidence results.", float64(s.lowConfidence))
+	metric("pkgstats_run_duration_seconds", "Duration of the run in seconds.", duration.Seconds())
+	metric("pkgstats_last_run_timestamp_seconds", "Time the run finished as a Unix timestamp.", float64(time.Now().Unix()))
+
+	return sb.String()
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parseMetrics returns the values of the samples of a text exposition.
+func parseMetrics(t *testing.T, text string) map[string]float64 {
+	t.Helper()
+	values := make(map[string]float64)
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, " ")
+		if !ok {
+			t.Fatalf("malformed sample %q", line)
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			t.Fatalf("malformed value of %s: %v", name, err)
+		}
+		values[name] = v
+	}
+	return values
+}
+
+func TestMetricsNotification(t *testing.T) {
+	var method, path, contentType, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		method, path, contentType, body = r.Method, r.URL.Path, r.Header.Get("Content-Type"), string(data)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		summary summary
+		want    map[string]float64
+	}{
+		{
+			name:    "adopters",
+			summary: summary{repositories: 120, adopters: 7, reach: 4200, lowConfidence: 2},
+			want: map[string]float64{
+				"pkgstats_repositories":           120,
+				"pkgstats_adopters":               7,
+				"pkgstats_reach":                  4200,
+				"pkgstats_low_confidence_results": 2,
+				"pkgstats_run_duration_seconds":   90,
+			},
+		},
+		{
+			name: "empty run",
+			want: map[string]float64{
+				"pkgstats_repositories":           0,
+				"pkgstats_adopters":               0,
+				"pkgstats_reach":                  0,
+				"pkgstats_low_confidence_results": 0,
+				"pkgstats_run_duration_seconds":   90,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			n := metricsNotification(server.URL+"/", "github.com/samber/lo", tt.summary, 90*time.Second)
+			if err := n.send(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			wantPath := "/metrics/job/pkgstats/package@base64/" + base64.RawURLEncoding.EncodeToString([]byte("github.com/samber/lo"))
+			if method != http.MethodPut || path != wantPath {
+				t.Errorf("pushed with %s %s, want PUT %s", method, path, wantPath)
+			}
+			if !strings.HasPrefix(contentType, "text/plain") {
+				t.Errorf("content type %q", contentType)
+			}
+
+			got := parseMetrics(t, body)
+			for name, value := range tt.want {
+				if v, ok := got[name]; !ok || v != value {
+					t.Errorf("%s = %g, want %g", name, v, value)
+				}
+			}
+			if ts := got["pkgstats_last_run_timestamp_seconds"]; ts < float64(start.Unix()) {
+				t.Errorf("last run timestamp %g before the push", ts)
+			}
+			if len(got) != len(tt.want)+1 {
+				t.Errorf("%d metrics pushed, want %d", len(got), len(tt.want)+1)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimitTransport is the single place every GitHub API call goes through.
+// It tracks the remaining quota of each rate limit resource from the response
+// headers and holds requests back until the reset when a resource is
+// exhausted. It can also space requests out to a maximum rate, overall and
+// per request class. It is safe for concurrent use, so all callers share one
+// quota view.
+type rateLimitTransport struct {
+	base http.RoundTripper
+
+	mu sync.Mutex
+	// quotas are keyed by the X-RateLimit-Resource of the responses
+	quotas map[string]quota
+	// all paces every request, classes the requests of each requestClass
+	all     pacer
+	classes map[string]*pacer
+	// budget caps the number of requests, nil for no cap
+	budget *requestBudget
+}
+
+// pacer spaces requests out by a minimum interval, zero for no limit.
+type pacer struct {
+	interval time.Duration
+	next     time.Time
+}
+
+func newPacer(requestsPerSecond float64) pacer {
+	if requestsPerSecond <= 0 {
+		return pacer{}
+	}
+	return pacer{interval: time.Duration(float64(time.Second) / requestsPerSecond)}
+}
+
+// Request classes with their own rate, searches are much more limited than
+// content downloads and the other calls.
+const (
+	classSearch   = "search"
+	classDownload = "download"
+)
+
+type quota struct {
+	remaining int
+	reset     time.Time
+}
+
+// newRateLimitTransport limits the requests to rps per second overall and
+// the search and download classes to their own rates, 0 is no limit.
+func newRateLimitTransport(base http.RoundTripper, rps, searchRPS, downloadRPS float64) *rateLimitTransport {
+	searchPacer, downloadPacer := newPacer(searchRPS), newPacer(downloadRPS)
+	return &rateLimitTransport{
+		base:   base,
+		quotas: make(map[string]quota),
+		all:    newPacer(rps),
+		classes: map[string]*pacer{
+			classSearch:   &searchPacer,
+			classDownload: &downloadPacer,
+		},
+	}
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := sleepWithContext(req.Context(), t.reserve(requestResource(req), requestClass(req))); err != nil {
+		return nil, err
+	}
+	// a request canceled while it waited is never sent, and not spent
+	if err := t.budget.spend(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		t.budget.stopIfSpent()
+		return resp, err
+	}
+	if t.budget != nil {
+		// the body is read with the context of the run
+		resp.Body = &budgetBody{ReadCloser: resp.Body, budget: t.budget}
+	}
+
+	t.update(resp.Header)
+	return resp, nil
+}
+
+// budgetBody is the body of a response to a budgeted request, it stops the
+// run once the body of the last request is closed.
+type budgetBody struct {
+	io.ReadCloser
+	budget *requestBudget
+}
+
+func (b *budgetBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.budget.stopIfSpent()
+	return err
+}
+
+// reserve returns how long the request has to wait, and books its slot so
+// concurrent callers queue up behind each other.
+func (t *rateLimitTransport) reserve(resource, class string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	classPacer := t.classes[class]
+	now := time.Now()
+	start := now
+	if t.all.next.After(start) {
+		start = t.all.next
+	}
+	if classPacer.next.After(start) {
+		start = classPacer.next
+	}
+
+	// the paced slot is booked whatever the quota, so a request waiting for
+	// the reset of its resource doesn't hold back the other resources
+	t.all.next = start.Add(t.all.interval)
+	classPacer.next = start.Add(classPacer.interval)
+
+	if q, ok := t.quotas[resource]; ok && q.remaining <= 0 && q.reset.After(start) {
+		logf("%s rate limit exhausted, waiting until %s\n", resource, q.reset.Format(time.TimeOnly))
+		// the requests after it wait for the reset too, the first response
+		// after it refreshes the quota
+		start = q.reset
+	} else if ok && q.remaining > 0 {
+		q.remaining--
+		t.quotas[resource] = q
+	}
+	return start.Sub(now)
+}
+
+// update records the quota reported by the most recent response.
+func (t *rateLimitTransport) update(header http.Header) {
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+	resource := header.Get("X-RateLimit-Resource")
+	if resource == "" {
+		resource = "core"
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.quotas[resource] = quota{remaining: remaining, reset: time.Unix(reset, 0)}
+}
+
+// requestClass returns the pacing class of a request: searches, or content
+// downloads and every other call.
+func requestClass(req *http.Request) string {
+	if strings.HasPrefix(req.URL.Path, "/search/") {
+		return classSearch
+	}
+	return classDownload
+}
+
+// requestResource guesses the rate limit resource a request counts against.
+func requestResource(req *http.Request) string {
+	switch {
+	case req.URL.Path == "/search/code":
+		return "code_search"
+	case strings.HasPrefix(req.URL.Path, "/search/"):
+		return "search"
+	case req.URL.Path == "/graphql":
+		return "graphql"
+	default:
+		return "core"
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingTransport answers every request at once and records when it
+// arrived.
+type recordingTransport struct {
+	mu       sync.Mutex
+	arrivals map[string][]time.Time
+}
+
+func (rt *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.mu.Lock()
+	rt.arrivals[requestClass(req)] = append(rt.arrivals[requestClass(req)], time.Now())
+	rt.mu.Unlock()
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+}
+
+// TestRateLimitPacing runs concurrent callers through one transport, run it
+// with -race.
+func TestRateLimitPacing(t *testing.T) {
+	tests := []struct {
+		name        string
+		rps         float64
+		searchRPS   float64
+		downloadRPS float64
+		searches    int
+		downloads   int
+		// want are the minimum intervals between the requests of each class
+		want map[string]time.Duration
+	}{
+		{name: "overall", rps: 100, searches: 4, downloads: 4, want: map[string]time.Duration{"": 10 * time.Millisecond}},
+		{name: "search class", searchRPS: 50, searches: 6, downloads: 6, want: map[string]time.Duration{classSearch: 20 * time.Millisecond}},
+		{name: "both classes", searchRPS: 50, downloadRPS: 100, searches: 5, downloads: 8, want: map[string]time.Duration{classSearch: 20 * time.Millisecond, classDownload: 10 * time.Millisecond}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := &recordingTransport{arrivals: make(map[string][]time.Time)}
+			transport := newRateLimitTransport(base, tt.rps, tt.searchRPS, tt.downloadRPS)
+
+			start := time.Now()
+			var wg sync.WaitGroup
+			for i := 0; i < tt.searches+tt.downloads; i++ {
+				path := "/repos/o/r/contents/go.mod"
+				if i < tt.searches {
+					path = "/search/code"
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					req, _ := http.NewRequest(http.MethodGet, "https://api.github.com"+path, nil)
+					resp, err := transport.RoundTrip(req)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					resp.Body.Close()
+				}()
+			}
+			wg.Wait()
+
+			for class, interval := range tt.want {
+				arrivals := base.arrivals[class]
+				if class == "" {
+					arrivals = append(slices.Clone(base.arrivals[classSearch]), base.arrivals[classDownload]...)
+				}
+				slices.SortFunc(arrivals, func(a, b time.Time) int { return a.Compare(b) })
+				// the k-th request can't start before k intervals went by
+				for k, at := range arrivals {
+					if min := time.Duration(k) * interval; at.Sub(start) < min {
+						t.Errorf("%s request %d after %s, want at least %s", class, k, at.Sub(start), min)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitExhausted(t *testing.T) {
+	base := &recordingTransport{arrivals: make(map[string][]time.Time)}
+	transport := newRateLimitTransport(base, 0, 0, 0)
+	transport.update(http.Header{
+		"X-Ratelimit-Remaining": {"0"},
+		"X-Ratelimit-Reset":     {strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10)},
+		"X-Ratelimit-Resource":  {"core"},
+	})
+
+	if wait := transport.reserve("core", classDownload); wait <= 0 {
+		t.Errorf("wait %s with an exhausted quota, want until the reset", wait)
+	}
+	if wait := transport.reserve("core", classDownload); wait <= 0 {
+		t.Errorf("next request waits %s with an exhausted quota, want until the reset", wait)
+	}
+	if wait := transport.reserve("search", classSearch); wait > 0 {
+		t.Errorf("search waits %s for the core quota", wait)
+	}
+}
+
+func TestRequestClass(t *testing.T) {
+	tests := []struct {
+		path         string
+		wantClass    string
+		wantResource string
+	}{
+		{path: "/search/code", wantClass: classSearch, wantResource: "code_search"},
+		{path: "/search/repositories", wantClass: classSearch, wantResource: "search"},
+		{path: "/graphql", wantClass: classDownload, wantResource: "graphql"},
+		{path: "/repos/o/r/contents/go.mod", wantClass: classDownload, wantResource: "core"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "https://api.github.com"+tt.path, nil)
+			if got := requestClass(req); got != tt.wantClass {
+				t.Errorf("class %s, want %s", got, tt.wantClass)
+			}
+			if got := requestResource(req); got != tt.wantResource {
+				t.Errorf("resource %s, want %s", got, tt.wantResource)
+			}
+		})
+	}
+}
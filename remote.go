@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// errObjectNotFound is returned by objectStore.get for a missing object.
+var errObjectNotFound = errors.New("object not found")
+
+// objectStore is a bucket of an object storage service.
+type objectStore interface {
+	get(ctx context.Context, key string) ([]byte, error)
+	put(ctx context.Context, key string, data []byte) error
+}
+
+// remoteStore keeps the results as an object of an object store, so runners
+// without a disk of their own, e.g. CI jobs, share the cache.
+type remoteStore struct {
+	objects objectStore
+	key     string
+}
+
+func (s *remoteStore) load(ctx context.Context) (map[string]repoResult, error) {
+	data, err := s.objects.get(ctx, s.key)
+	if errors.Is(err, errObjectNotFound) {
+		return make(map[string]repoResult), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error downloading the cache %s: %v", s.key, err)
+	}
+	results, err := readResults(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error reading the cache %s: %v", s.key, err)
+	}
+	return results, nil
+}
+
+func (s *remoteStore) save(ctx context.Context, results []repoResult) error {
+	var buf bytes.Buffer
+	err := writeCompressed(&buf, isCompressed(s.key), func(w io.Writer) error {
+		return writeResults(w, results)
+	})
+	if err != nil {
+		return fmt.Errorf("error writing the cache: %v", err)
+	}
+	if err := s.objects.put(ctx, s.key, buf.Bytes()); err != nil {
+		return fmt.Errorf("error uploading the cache %s: %v", s.key, err)
+	}
+	logf("uploaded the cache: %s\n", s.key)
+	return nil
+}
+
+// parseCacheURL checks a -cache-url, s3://bucket/prefix or
+// gs://bucket/prefix, and returns it parsed.
+func parseCacheURL(cacheURL string) (*url.URL, error) {
+	u, err := url.Parse(cacheURL)
+	if err != nil || u.Host == "" || u.Scheme != "s3" && u.Scheme != "gs" {
+		return nil, fmt.Errorf("invalid value for cache-url: %s, want s3://bucket/prefix or gs://bucket/prefix", cacheURL)
+	}
+	return u, nil
+}
+
+// newRemoteStore returns the store of a cache file in the bucket of a
+// -cache-url from parseCacheURL. The object is named after the cache file,
+// under the prefix.
+func newRemoteStore(bucket *url.URL, fileName string) *remoteStore {
+	var objects objectStore
+	switch bucket.Scheme {
+	case "gs":
+		objects = &gcsStore{endpoint: "https://storage.googleapis.com", bucket: bucket.Host, token: os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")}
+	default:
+		objects = newS3Store(bucket.Host)
+	}
+	return &remoteStore{
+		objects: objects,
+		key:     path.Join(strings.Trim(bucket.Path, "/"), filepath.Base(fileName)),
+	}
+}
+
+// doObjectRequest sends a request to an object store and returns the body
+// of a successful response, errObjectNotFound for a 404.
+func doObjectRequest(req *http.Request, service string) ([]byte, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errObjectNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, &statusError{service: service, statusCode: resp.StatusCode, status: resp.Status, message: strings.TrimSpace(string(msg))}
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// gcsStore is a Google Cloud Storage bucket, used through its XML API with
+// an OAuth access token, e.g. from `gcloud auth print-access-token`.
+type gcsStore struct {
+	endpoint string
+	bucket   string
+	// token is the access token, requests are anonymous without it
+	token string
+}
+
+func (s *gcsStore) request(ctx context.Context, method, key string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.endpoint+"/"+s.bucket+"/"+key, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	return doObjectRequest(req, "GCS")
+}
+
+func (s *gcsStore) get(ctx context.Context, key string) ([]byte, error) {
+	return s.request(ctx, http.MethodGet, key, nil)
+}
+
+func (s *gcsStore) put(ctx context.Context, key string, data []byte) error {
+	_, err := s.request(ctx, http.MethodPut, key, data)
+	return err
+}
+
+// s3Store is an S3 bucket, with the credentials and region of the standard
+// AWS environment variables. AWS_ENDPOINT_URL points it to another S3
+// compatible service, addressing the bucket in the path.
+type s3Store struct {
+	// endpoint is the URL of the bucket
+	endpoint     string
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+func newS3Store(bucket string) *s3Store {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, region)
+	if custom := os.Getenv("AWS_ENDPOINT_URL"); custom != "" {
+		endpoint = strings.TrimSuffix(custom, "/") + "/" + bucket
+	}
+	return &s3Store{
+		endpoint:     endpoint,
+		region:       region,
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+func (s *s3Store) request(ctx context.Context, method, key string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.endpoint+"/"+key, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if s.accessKey != "" {
+		if s.sessionToken != "" {
+			req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+		}
+		s.sign(req, body, time.Now())
+	}
+	return doObjectRequest(req, "S3")
+}
+
+func (s *s3Store) get(ctx context.Context, key string) ([]byte, error) {
+	return s.request(ctx, http.MethodGet, key, nil)
+}
+
+func (s *s3Store) put(ctx context.Context, key string, data []byte) error {
+	_, err := s.request(ctx, http.MethodPut, key, data)
+	return err
+}
+
+// sign adds the AWS Signature Version 4 of a request to its headers, signing
+// its host and every header it has.
+func (s *s3Store) sign(req *http.Request, body []byte, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, strings.TrimSpace(headers[name]))
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + s.secretKey)
+	for _, part := range []string{date, s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// reportData is the data model passed to report templates and dumped with
+// -report-data-json.
+type reportData struct {
+	// SchemaVersion is the output schema version
+	SchemaVersion int
+	Package       string
+	GeneratedAt   time.Time
+	Summary       reportSummary
+	Repos         []reportRepo
+	Versions      []histogramBucket
+	StarBuckets   []histogramBucket
+}
+
+type reportSummary struct {
+	Repositories int
+	// Adopters only counts high-confidence results, AdoptersByConfidence
+	// counts every level
+	Adopters             int
+	AdoptersByConfidence map[string]int
+	LowConfidence        int
+	// AdoptersByHosting counts the adopters developed on GitHub, mirrored
+	// from another forge or with a vanity module path
+	AdoptersByHosting map[string]int
+}
+
+type reportRepo struct {
+	Name          string
+	URL           string
+	Used          bool
+	Stars         int
+	Version       string
+	RawVersion    string
+	LowConfidence bool
+	Source        string
+	Confidence    string
+	ModuleKind    string
+	Module        string
+	Fork          string
+	Tool          bool
+	StaleIndirect bool
+	SizeKB        int
+	Notes         string
+	Hosting       string
+	// DirectRequires and DependencyShare are 0 when unknown
+	DirectRequires  int
+	DependencyShare float64
+}
+
+type histogramBucket struct {
+	Label string
+	Count int
+}
+
+// starBuckets are the lower bounds of the star histogram buckets.
+var starBuckets = []int{100000, 50000, 20000, 10000, 5000, 1000, 0}
+
+func newReportData(packageName string, results []repoResult) reportData {
+	s := summarize(results)
+	data := reportData{
+		SchemaVersion: outputSchemaVersion,
+		Package:       packageName,
+		GeneratedAt:   time.Now().UTC(),
+		Summary: reportSummary{
+			Repositories:         s.repositories,
+			Adopters:             s.adopters,
+			AdoptersByConfidence: s.byConfidence,
+			LowConfidence:        s.lowConfidence,
+			AdoptersByHosting:    s.byHosting,
+		},
+	}
+
+	versions := make(map[string]int)
+	stars := make(map[int]int)
+	for _, r := range results {
+		data.Repos = append(data.Repos, reportRepo{
+			Name:          r.name,
+			URL:           r.url(),
+			Used:          r.used,
+			Stars:         r.stars,
+			Version:       r.version,
+			RawVersion:    r.rawVersion,
+			LowConfidence: r.lowConfidence,
+			Source:        r.source,
+			Confidence:    r.confidence,
+			ModuleKind:    r.moduleKind,
+			Module:        r.module,
+			Fork:          r.fork,
+			Tool:          r.tool,
+			StaleIndirect: r.staleIndirect,
+			SizeKB:        r.sizeKB,
+			Notes:         r.notes,
+			Hosting:       r.hosting,
+
+			DirectRequires:  r.directRequires,
+			DependencyShare: r.dependencyShare(),
+		})
+
+		if !r.used {
+			continue
+		}
+		if r.version != "" {
+			versions[r.version]++
+		}
+		for _, bound := range starBuckets {
+			if r.stars >= bound {
+				stars[bound]++
+				break
+			}
+		}
+	}
+
+	for version, count := range versions {
+		data.Versions = append(data.Versions, histogramBucket{Label: version, Count: count})
+	}
+	sort.Slice(data.Versions, func(i, j int) bool {
+		if data.Versions[i].Count != data.Versions[j].Count {
+			return data.Versions[i].Count > data.Versions[j].Count
+		}
+		return data.Versions[i].Label < data.Versions[j].Label
+	})
+
+	for _, bound := range starBuckets {
+		data.StarBuckets = append(data.StarBuckets, histogramBucket{
+			Label: fmt.Sprintf("%s+", formatNumber(bound)),
+			Count: stars[bound],
+		})
+	}
+
+	return data
+}
+
+// reportFuncs are the helper functions available in report templates.
+var reportFuncs = template.FuncMap{
+	"number":  formatNumber,
+	"percent": formatPercent,
+	"date":    func(layout string, t time.Time) string { return t.Format(layout) },
+	"upper":   strings.ToUpper,
+	"lower":   strings.ToLower,
+	"join":    func(sep string, elems []string) string { return strings.Join(elems, sep) },
+	"default": func(def string, value string) string {
+		if value == "" {
+			return def
+		}
+		return value
+	},
+}
+
+// formatNumber formats n with thousands separators.
+func formatNumber(n int) string {
+	s := strconv.Itoa(n)
+	sign := ""
+	if n < 0 {
+		sign, s = "-", s[1:]
+	}
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return sign + s
+}
+
+// formatPercent formats part as a percentage of total.
+func formatPercent(part, total int) string {
+	if total == 0 {
+		return "0.0%"
+	}
+	return fmt.Sprintf("%.1f%%", float64(part)/float64(total)*100)
+}
+
+// templateLineRe extracts the line number from text/template errors.
+var templateLineRe = regexp.MustCompile(`^template: [^:]+:(\d+)`)
+
+// renderReport executes the template file with the data model and writes the
+// result to w. Errors include the offending template line.
+func renderReport(w io.Writer, templateFile string, data reportData) error {
+	tmpl, text, err := parseTemplate(templateFile)
+	if err != nil {
+		return err
+	}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		return templateError(err, text)
+	}
+	return nil
+}
+
+// parseTemplate parses a template file with the report helpers and returns
+// it with its text, for templateError.
+func parseTemplate(templateFile string) (*template.Template, string, error) {
+	bb, err := os.ReadFile(templateFile)
+	if err != nil {
+		return nil, "", err
+	}
+
+	tmpl, err := template.New(templateFile).Funcs(reportFuncs).Parse(string(bb))
+	if err != nil {
+		return nil, "", templateError(err, string(bb))
+	}
+	return tmpl, string(bb), nil
+}
+
+func templateError(err error, text string) error {
+	m := templateLineRe.FindStringSubmatch(err.Error())
+	if m == nil {
+		return err
+	}
+
+	line, _ := strconv.Atoi(m[1])
+	lines := strings.Split(text, "\n")
+	if line < 1 || line > len(lines) {
+		return err
+	}
+	return fmt.Errorf("%v\n  %d | %s", err, line, lines[line-1])
+}
+
+// writeReportFile renders the report to fileName, or to stdout when it is "-".
+func writeReportFile(fileName, templateFile string, data reportData) error {
+	if fileName == "-" {
+		return renderReport(os.Stdout, templateFile, data)
+	}
+
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := renderReport(file, templateFile, data); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// dumpReportData writes the data model as JSON so templates can be developed
+// without running a search.
+func dumpReportData(fileName string, data reportData) error {
+	bb, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, append(bb, '\n'), 0644)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+// outputSchemaVersion is bumped whenever knownFields change, new fields get
+// it as their since version.
+const outputSchemaVersion = 10
+
+// dumpSchema writes the cache columns and the output fields with their types,
+// in the order they are written.
+func dumpSchema(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "cache schema version: %d\n\n", cacheSchemaVersion)
+	fmt.Fprintln(tw, "cache columns (CSV, no header):")
+	for i, c := range cacheColumns {
+		fmt.Fprintf(tw, "  %d\t%s\t%s\n", i+1, c.name, c.kind)
+	}
+
+	fmt.Fprintf(tw, "\noutput schema version: %d\n\n", outputSchemaVersion)
+	fmt.Fprintln(tw, "output fields (CSV, JSON and table, selected with -fields):")
+	for i, f := range knownFields {
+		fmt.Fprintf(tw, "  %d\t%s\t%s\t%s\n", i+1, f.name, f.kind, f.desc)
+	}
+
+	return tw.Flush()
+}
+
+// sinceVersion returns the output schema version that added the field.
+func (f field) sinceVersion() int {
+	if f.since == 0 {
+		return 1
+	}
+	return f.since
+}
+
+// jsonSchemaTypes maps field kinds to JSON Schema types, times are RFC 3339
+// strings, empty when unknown.
+var jsonSchemaTypes = map[string]string{
+	"string": "string",
+	"bool":   "boolean",
+	"int":    "integer",
+	"float":  "number",
+	"time":   "string",
+}
+
+// outputJSONSchema returns the JSON Schema of the -output json array, built
+// from knownFields like the output itself.
+func outputJSONSchema() map[string]any {
+	properties := make(map[string]any)
+	for _, f := range knownFields {
+		var typ any = jsonSchemaTypes[f.kind]
+		if f.optional && f.kind != "string" {
+			typ = []string{jsonSchemaTypes[f.kind], "string"}
+		}
+		properties[f.name] = map[string]any{
+			"type":        typ,
+			"description": f.desc,
+		}
+	}
+	return map[string]any{
+		"$schema":        "https://json-schema.org/draft/2020-12/schema",
+		"title":          "pkgstats output",
+		"description":    "-output json results, each object holds the fields selected with -fields",
+		"schema_version": outputSchemaVersion,
+		"type":           "array",
+		"items": map[string]any{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		},
+	}
+}
+
+// dictionaryEntry describes an output field in the column dictionary.
+type dictionaryEntry struct {
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+	Description  string `json:"description"`
+	SinceVersion int    `json:"since_version"`
+}
+
+// fieldDictionary returns the column dictionary of the output fields.
+func fieldDictionary() []dictionaryEntry {
+	dictionary := make([]dictionaryEntry, 0, len(knownFields))
+	for _, f := range knownFields {
+		dictionary = append(dictionary, dictionaryEntry{
+			Name:         f.name,
+			Type:         f.kind,
+			Description:  f.desc,
+			SinceVersion: f.sinceVersion(),
+		})
+	}
+	return dictionary
+}
+
+// runSchema is the `pkgstats schema` command, it prints the JSON Schema of
+// the JSON output or the column dictionary of the output fields.
+func runSchema(args []string) error {
+	fs := flag.NewFlagSet("schema", flag.ContinueOnError)
+	format := fs.String("format", "json", "json for a JSON Schema, csv or jsonl for a column dictionary")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	return writeSchema(os.Stdout, *format)
+}
+
+func writeSchema(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		bb, err := json.MarshalIndent(outputJSONSchema(), "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", bb)
+		return err
+	case "jsonl":
+		encoder := json.NewEncoder(w)
+		for _, entry := range fieldDictionary() {
+			if err := encoder.Encode(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "csv":
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"name", "type", "description", "since_version"})
+		for _, entry := range fieldDictionary() {
+			writer.Write([]string{entry.Name, entry.Type, entry.Description, strconv.Itoa(entry.SinceVersion)})
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return fmt.Errorf("invalid value for format: %s", format)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fullResult has every cached field set, so it writes every column.
+var fullResult = repoResult{
+	name: "a/one", used: true, stars: 10, version: "v1.2.0", rawVersion: "1.2", lowConfidence: true,
+	source: sourceCodeSearch, confidence: confidenceLow, moduleKind: moduleMain, state: statePartialScan,
+	vendorChecked: true, vendored: true, fork: "github.com/jdoe/lib@v1.2.1", module: "github.com/x/lib", tool: true,
+	staleIndirect: true, sizeKB: 2048, score: 1.5, forks: 3, archived: true,
+	pushedAt: time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), createdAt: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+	enrichedAt: time.Date(2026, 2, 3, 0, 0, 0, 0, time.UTC), recheckAfter: time.Date(2026, 3, 4, 0, 0, 0, 0, time.UTC),
+	goModPath: "go.mod", matches: []goModMatch{{path: "go.mod", rawVersion: "1.2"}}, defaultBranch: "main",
+	goModSHA: "3f1c2a9", goSumChecked: true, goSumVersions: []string{"v1.2.0"}, goSumMismatch: true, directRequires: 4,
+	usageChecked: true, usageFiles: 2, testUsageChecked: true, testOnly: true, scanDuration: 1500 * time.Millisecond,
+	ownModule: "example.com/app", hosting: "vanity", branch: "next",
+}
+
+// dumpedNames returns the names listed in a section of the schema dump.
+func dumpedNames(t *testing.T, dump, section string) []string {
+	t.Helper()
+	_, rest, ok := strings.Cut(dump, section)
+	if !ok {
+		t.Fatalf("no %q section in the dump", section)
+	}
+	var names []string
+	for _, line := range strings.Split(rest, "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			break
+		}
+		names = append(names, fields[1])
+	}
+	return names
+}
+
+func TestDumpSchema(t *testing.T) {
+	var dump bytes.Buffer
+	if err := dumpSchema(&dump); err != nil {
+		t.Fatal(err)
+	}
+
+	var cache bytes.Buffer
+	if err := writeResults(&cache, []repoResult{fullResult}); err != nil {
+		t.Fatal(err)
+	}
+	record, err := csv.NewReader(&cache).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := dumpedNames(t, dump.String(), "cache columns")
+	if len(columns) != len(record) {
+		t.Errorf("%d cache columns dumped, the cache rows have %d", len(columns), len(record))
+	}
+	if columns[0] != "name" || record[0] != fullResult.name {
+		t.Errorf("first column %s holds %q", columns[0], record[0])
+	}
+
+	var output bytes.Buffer
+	if err := writeCSV(&output, knownFields, []repoResult{fullResult}); err != nil {
+		t.Fatal(err)
+	}
+	header, err := csv.NewReader(&output).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(dumpedNames(t, dump.String(), "output fields"), ","), strings.Join(header, ","); got != want {
+		t.Errorf("output fields dumped\n%s\nthe output has\n%s", got, want)
+	}
+}
+
+// jsonType returns the JSON Schema type of a decoded JSON value.
+func jsonType(v any) string {
+	switch v := v.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// TestOutputMatchesSchema fails when a writer emits a field the schema and
+// the column dictionary don't describe.
+func TestOutputMatchesSchema(t *testing.T) {
+	results := []repoResult{fullResult, {name: "a/two", stars: 1}}
+	properties := outputJSONSchema()["items"].(map[string]any)["properties"].(map[string]any)
+
+	var out bytes.Buffer
+	if err := writeJSON(&out, knownFields, results); err != nil {
+		t.Fatal(err)
+	}
+	var objects []map[string]any
+	if err := json.Unmarshal(out.Bytes(), &objects); err != nil {
+		t.Fatal(err)
+	}
+	for _, object := range objects {
+		for key, value := range object {
+			property, ok := properties[key].(map[string]any)
+			if !ok {
+				t.Errorf("JSON output field %s missing from the schema", key)
+				continue
+			}
+			var types []string
+			switch typ := property["type"].(type) {
+			case string:
+				types = []string{typ}
+			case []string:
+				types = typ
+			}
+			got := jsonType(value)
+			// an integer is a number as well
+			if !slices.Contains(types, got) && !(got == "integer" && slices.Contains(types, "number")) {
+				t.Errorf("JSON output field %s is a %s (%v), the schema says %v", key, got, value, types)
+			}
+		}
+	}
+
+	var dictionary bytes.Buffer
+	if err := writeSchema(&dictionary, "csv"); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&dictionary).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	described := make(map[string]bool)
+	for _, row := range rows[1:] {
+		described[row[0]] = true
+	}
+	out.Reset()
+	if err := writeCSV(&out, knownFields, results); err != nil {
+		t.Fatal(err)
+	}
+	header, err := csv.NewReader(&out).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, column := range header {
+		if !described[column] {
+			t.Errorf("CSV output column %s missing from the column dictionary", column)
+		}
+	}
+}
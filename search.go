@@ -0,0 +1,963 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/go-github/v63/github"
+	"golang.org/x/mod/modfile"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// Sources a result can come from. Results found by the code search have
+// their go.mod parsed, the others are not verified.
+const (
+	sourceCodeSearch = "code-search"
+	sourceDependents = "dependents"
+	// sourceRootGoMod results only had their root go.mod checked, because
+	// the code search was unavailable
+	sourceRootGoMod = "root-go-mod"
+	// sourceRepoSearch results were only listed by the repository search,
+	// e.g. likely mirrors skipped without reading their go.mod
+	sourceRepoSearch = "repo-search"
+)
+
+// States of a result that needs attention beyond used or not used.
+const (
+	// stateAnomaly marks a result whose go.mod could not be read reliably,
+	// it is checked again on the next run
+	stateAnomaly = "anomaly"
+	// stateSkippedMirror marks a likely mirror that was not checked
+	stateSkippedMirror = "skipped (mirror)"
+	// statePartialScan marks a repository with more go.mod files than
+	// maxGoModsPerRepo, only the shallowest ones were checked
+	statePartialScan = "partial-scan"
+	// stateNotFound marks a repository that doesn't exist anymore, found
+	// by the enrichment
+	stateNotFound = "not-found"
+	// stateOversizedGoMod marks a repository not found to use the package
+	// with a go.mod over maxGoModBytes that was skipped
+	stateOversizedGoMod = "skipped (oversized go.mod)"
+	// stateSkippedSlow marks a repository due for a check that was skipped
+	// because its previous scan took longer than skipSlowerThan, it is
+	// checked on the next run without the limit
+	stateSkippedSlow = "skipped (slow)"
+)
+
+// errGoModAnomaly is returned for go.mod content that is empty, too small or
+// a Git LFS pointer instead of the actual file.
+var errGoModAnomaly = errors.New("go.mod content is empty or not a go.mod file")
+
+// errGoModTooLarge is returned for go.mod files over maxGoModBytes, they are
+// neither downloaded in full nor parsed.
+var errGoModTooLarge = errors.New("go.mod file is larger than max-gomod-bytes")
+
+// errGoModUnchanged is returned by fetchGoMod for a go.mod that still has the
+// blob SHA of the previous scan, it is not downloaded.
+var errGoModUnchanged = errors.New("go.mod unchanged since the previous scan")
+
+// minGoModSize is the size of the smallest meaningful go.mod, "module a".
+const minGoModSize = len("module a")
+
+type repoResult struct {
+	name          string
+	used          bool
+	stars         int
+	version       string
+	rawVersion    string
+	lowConfidence bool
+	source        string
+	confidence    string
+	moduleKind    string
+	state         string
+	// branch is the -branch the go.mod files were read at, empty when they
+	// were read at the default branch
+	branch string
+	// vendored is only meaningful when vendorChecked is set
+	vendorChecked bool
+	vendored      bool
+	// fork is the module@version the package is replaced with, if any
+	fork string
+	// module is the module the repository requires, one of the -pkg-owner
+	// modules or the package
+	module string
+	// tool is set when the package is used through a go.mod tool directive
+	tool bool
+	// staleIndirect is set when the go.mod requires the package as indirect
+	// but the source imports it, see -verify-imports
+	staleIndirect bool
+	// sizeKB is the repository size reported by GitHub, 0 when unknown
+	sizeKB int
+	// score is the code search relevance score of the matching go.mod
+	score float64
+	// forks, pushedAt, createdAt and archived come from the repository
+	// metadata
+	forks     int
+	pushedAt  time.Time
+	createdAt time.Time
+	archived  bool
+	// enrichedAt is when the metadata was last fetched by the enrichment
+	enrichedAt time.Time
+	// recheckAfter makes a cached result be checked again after that time,
+	// it is zero for results that are kept
+	recheckAfter time.Time
+	// goModPath is the go.mod that matched, the last one of matches
+	goModPath string
+	// matches are all the go.mod files requiring the package
+	matches []goModMatch
+	// defaultBranch is the default branch of the repository
+	defaultBranch string
+	// goSumVersions are the versions of the package the go.sum next to
+	// goModPath locks, goSumMismatch is set when the go.mod requires none
+	// of them; both are only meaningful when goSumChecked is set
+	goSumChecked  bool
+	goSumVersions []string
+	goSumMismatch bool
+	// directRequires is the number of direct requirements of the go.mod at
+	// goModPath, 0 when unknown
+	directRequires int
+	// usageFiles is the number of files importing the package, only
+	// meaningful when usageChecked is set
+	usageChecked bool
+	usageFiles   int
+	// testOnly is set when the package is only imported by _test.go files,
+	// only meaningful when testUsageChecked is set
+	testUsageChecked bool
+	testOnly         bool
+	// scanDuration is the wall time of the last inspection of the
+	// repository, sleeps aside, 0 when unknown
+	scanDuration time.Duration
+	// ownModule is the module path declared by the go.mod at goModPath,
+	// hosting tells from it whether the adopter is developed on GitHub
+	ownModule string
+	hosting   string
+	// goModSHA is the blob SHA of the go.mod the result is based on:
+	// goModPath for adopters, the root go.mod of repositories only checked
+	// through it
+	goModSHA string
+
+	// notes come from the notes file and are never stored in the cache
+	notes string
+	// org is the -org organization owning the repository, not cached
+	org string
+	// minVersion is the -require-min-version the result is classified
+	// against, not cached
+	minVersion string
+	// countTestOnly is set with -include-test-only, a test-only adopter
+	// then counts in the summaries, not cached
+	countTestOnly bool
+	// redacted results are anonymized and must not link to the repository
+	redacted bool
+}
+
+// tooSlow reports whether the previous scan of a repository took longer than
+// skipSlowerThan. Without a recorded duration it never is.
+func (s *searchResult) tooSlow(cached repoResult) bool {
+	return s.skipSlowerThan > 0 && cached.scanDuration > s.skipSlowerThan
+}
+
+// needsCheck reports whether a cached result has to be checked again. A result
+// from the dependents graph is, as its go.mod was never read.
+func (s *searchResult) needsCheck(cached repoResult) bool {
+	return cached.state == stateAnomaly || cached.source == sourceDependents ||
+		(cached.state == stateSkippedMirror && s.includeMirrors) ||
+		(cached.state == stateSkippedSlow && !s.tooSlow(cached)) ||
+		(!cached.recheckAfter.IsZero() && time.Now().After(cached.recheckAfter))
+}
+
+// knownSHA returns the blob SHA the previous scan recorded for the go.mod at
+// path, when that go.mod alone decided the result: the matching go.mod of an
+// adopter, or the root go.mod of a repository checked through it when root
+// is set. Otherwise it returns an empty string.
+func (r repoResult) knownSHA(path string, root bool) string {
+	if r.used && r.goModPath == path || root && !r.used && path == "go.mod" {
+		return r.goModSHA
+	}
+	return ""
+}
+
+// unchangedSince returns the previous result r of a repository whose go.mod
+// didn't change, with the repository metadata of the current result.
+func (r repoResult) unchangedSince(current repoResult) repoResult {
+	r.stars = current.stars
+	r.sizeKB = current.sizeKB
+	r.forks = current.forks
+	r.pushedAt = current.pushedAt
+	r.createdAt = current.createdAt
+	r.archived = current.archived
+	r.defaultBranch = current.defaultBranch
+	r.branch = current.branch
+	r.recheckAfter = time.Time{}
+	return r
+}
+
+type searchResult struct {
+	client          *github.Client
+	cache           map[string]repoResult
+	packageName     string
+	classifyModules bool
+	// branch is the -branch to read go.mod files at, missingBranch holds
+	// the repositories without it, read at their default branch
+	branch         string
+	missingBranch  map[string]bool
+	checkVendor    bool
+	includeMirrors bool
+	maxPages       int
+	// modules are the module paths to match, the package or the modules of
+	// -pkg-owner
+	modules []string
+	// maxGoModBytes is the size over which go.mod files are skipped, 0
+	// for no limit
+	maxGoModBytes int64
+	// maxGoModsPerRepo caps the go.mod files checked per repository, 0
+	// checks all of them
+	maxGoModsPerRepo int
+	// youngWindow is the age under which a repository with no code search
+	// results gets its root go.mod checked, negative results of such
+	// repositories are checked again after youngTTL
+	youngWindow time.Duration
+	youngTTL    time.Duration
+	// seen holds the repositories checked in this run, a repository can
+	// show up in more than one search
+	seen            map[string]bool
+	paginationDelay time.Duration
+	searchDelay     time.Duration
+	// bandDelay is the pause between the star bands of a sweep
+	bandDelay time.Duration
+	// timings measures where the time of the run goes
+	timings *timings
+	// progress is told about every processed repository, nil without
+	// -max-idle-time
+	progress *watchdog
+	// codeSearchFailures counts the consecutive code searches refused with
+	// 403, after maxCodeSearchFailures the code search is not used anymore
+	codeSearchFailures int
+	// createdAfter skips the candidates created before it, when set
+	createdAfter time.Time
+	// verifyImports checks whether repositories requiring the package as
+	// indirect import it anyway
+	verifyImports bool
+	// checkGoSum reads the go.sum of adopters for the locked versions
+	checkGoSum bool
+	// countUsage counts the files of adopters importing the package with
+	// an import search, usageSearches are the searches left for it and
+	// usageCapped is set once they ran out
+	countUsage    bool
+	usageSearches int
+	usageCapped   bool
+	// classifyTestUsage checks with an import search whether adopters only
+	// import the package in tests
+	classifyTestUsage bool
+	// nearMissDistance is the edit distance within which a requirement is
+	// reported as a near miss of a module searched for, 0 to disable
+	nearMissDistance int
+	nearMisses       []nearMiss
+	// skipSlowerThan skips the repositories due for a check whose previous
+	// scan took longer, 0 to check them all
+	skipSlowerThan time.Duration
+	// listings keeps the pages of the repository searches, shared by the
+	// packages of a batch, nil to always search
+	listings *repoListings
+	// onResult is told about every result as it is found, nil when the
+	// results are only stored at the end of the run
+	onResult func(result repoResult)
+	// yield is called before every repository checked, for the packages of
+	// a batch to take turns, nil for a single package
+	yield func()
+}
+
+func newSearchResult(packageName string, client *github.Client, results map[string]repoResult) *searchResult {
+	const (
+		defaultPaginationDelay = 7 * time.Second
+		defaultSearchDelay     = 7 * time.Second
+	)
+
+	return &searchResult{
+		cache:           results,
+		seen:            make(map[string]bool),
+		missingBranch:   make(map[string]bool),
+		client:          client,
+		packageName:     modulePrefix(packageName),
+		modules:         []string{packageName},
+		paginationDelay: defaultPaginationDelay,
+		searchDelay:     defaultSearchDelay,
+		timings:         &timings{},
+	}
+}
+
+func (s *searchResult) Search(ctx context.Context, query string, opts *github.SearchOptions) (map[string]repoResult, error) {
+	results := make(map[string]repoResult)
+	pages := 0
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Stop the search if the context is canceled
+			if errors.Is(ctx.Err(), context.Canceled) {
+				logln("context canceled, stopping Search...")
+				return results, nil
+			}
+			return results, ctx.Err()
+
+		default:
+			// Find matching repositories
+			page, err := s.listRepositories(ctx, query, opts)
+			if err != nil {
+				return results, fmt.Errorf("error searching repositories: %v", withRequestID(err))
+			}
+			repos := page.repos
+
+			if pages == 0 && repos.GetTotal() > searchResultCap {
+				logf("Query %q matches %d repositories, only the first %d can be listed\n", query, repos.GetTotal(), searchResultCap)
+			}
+
+			// Search in the repositories for the package usage
+			candidates := filterCandidates(candidatesFromSearch(repos))
+			repoSearchResults, err := s.searchInRepositories(ctx, candidates)
+			if err != nil {
+				logf("error searching the repositories: %v\n", err)
+				continue
+			}
+
+			// update results
+			mergeResults(results, repoSearchResults)
+
+			pages++
+			if page.nextPage == 0 {
+				return results, nil
+			}
+			if s.maxPages > 0 && pages >= s.maxPages {
+				logf("Reached the maximum of %d search pages, stopping Search...\n", s.maxPages)
+				return results, nil
+			}
+
+			opts.Page = page.nextPage
+			if !s.listings.has(query, opts) {
+				logf("Sleeping for %d seconds in Search\n", int(s.paginationDelay.Seconds()))
+				stop := s.timings.track(phaseSleep, fmt.Sprintf("%s page %d", query, pages))
+				if err := sleepWithContext(ctx, s.paginationDelay); err != nil {
+					logf("Sleep was interrupted: %v\n", err)
+				}
+				stop()
+			}
+
+			logln("Searching next page: ", opts.Page)
+		}
+	}
+}
+
+// record adds the result of a repository checked in this run to results and
+// tells onResult about it.
+func (s *searchResult) record(results map[string]repoResult, result repoResult) {
+	results[result.name] = result
+	s.seen[result.name] = true
+	if s.onResult != nil {
+		s.onResult(result)
+	}
+}
+
+// mergeResults adds the results of a page to the results of a search. A
+// repository listed again, on a later page or in another star band, never
+// loses a positive result to a negative one.
+func mergeResults(results, page map[string]repoResult) {
+	for repo, found := range page {
+		if previous, ok := results[repo]; ok && previous.used && !found.used {
+			logf("Keeping the earlier match of repository %s\n", repo)
+			continue
+		}
+		results[repo] = found
+	}
+}
+
+const (
+	// maxPerPage is the largest page size the GitHub search API accepts.
+	maxPerPage = 100
+	// searchResultCap is the number of results the search API returns at
+	// most for a query, whatever the total count.
+	searchResultCap = 1000
+)
+
+// clampPerPage keeps the page size within the limits of the search API.
+func clampPerPage(perPage int) int {
+	if perPage < 1 {
+		logf("per-page %d is too small, using 1\n", perPage)
+		return 1
+	}
+	if perPage > maxPerPage {
+		logf("per-page %d is too large, using %d\n", perPage, maxPerPage)
+		return maxPerPage
+	}
+	return perPage
+}
+
+func sleepWithContext(ctx context.Context, duration time.Duration) error {
+	select {
+	case <-time.After(duration):
+		// Sleep completed
+		return nil
+	case <-ctx.Done():
+		// Context was canceled
+		return ctx.Err()
+	}
+}
+
+func (s *searchResult) searchInRepositories(ctx context.Context, candidates []candidate) (map[string]repoResult, error) {
+	results := make(map[string]repoResult)
+
+	for _, repo := range candidates {
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.Canceled) {
+				logln("context canceled, stopping Search...")
+				return results, nil
+			}
+			return results, ctx.Err()
+
+		default:
+			if s.seen[repo.name] {
+				logf("Skipping repository: %s already checked in this run\n", repo.name)
+				continue
+			}
+
+			if !s.createdAfter.IsZero() && repo.createdAt.Before(s.createdAfter) {
+				logf("Skipping repository: %s created before %s\n", repo.name, s.createdAfter.Format(time.DateOnly))
+				continue
+			}
+
+			if !s.includeMirrors && likelyMirror(repo) {
+				logf("Skipping likely mirror repository: %s\n", repo.name)
+				s.record(results, repoResult{
+					name:       repo.name,
+					stars:      repo.stars,
+					sizeKB:     repo.sizeKB,
+					forks:      repo.forks,
+					pushedAt:   repo.pushedAt,
+					createdAt:  repo.createdAt,
+					source:     sourceRepoSearch,
+					confidence: confidenceLow,
+					state:      stateSkippedMirror,
+
+					defaultBranch: repo.defaultBranch,
+				})
+				s.progress.touch()
+				continue
+			}
+
+			// cached is the previous result of a repository checked again
+			cached, ok := s.cache[repo.name]
+			if ok && !s.needsCheck(cached) {
+				previousStateStr := "not found"
+				if cached.used {
+					previousStateStr = "found"
+				}
+				logf("Skipping repository: %s previously %s\n", repo.name, previousStateStr)
+				s.progress.touch()
+				continue
+			}
+			if ok && s.tooSlow(cached) {
+				logf("Skipping repository: %s, its last scan took %s\n", repo.name, cached.scanDuration.Round(time.Second))
+				cached.state = stateSkippedSlow
+				s.record(results, cached)
+				s.progress.touch()
+				continue
+			}
+
+			if s.yield != nil {
+				s.yield()
+			}
+			logf("Checking repository: %s\n", repo.name)
+			inspectStart := time.Now()
+
+			repoSearchResult := repoResult{
+				name:       repo.name,
+				stars:      repo.stars,
+				sizeKB:     repo.sizeKB,
+				forks:      repo.forks,
+				pushedAt:   repo.pushedAt,
+				createdAt:  repo.createdAt,
+				archived:   repo.archived,
+				used:       false,
+				source:     sourceCodeSearch,
+				confidence: confidenceHigh,
+
+				defaultBranch: repo.defaultBranch,
+			}
+
+			files, err := s.searchGoMods(ctx, repo)
+			if errors.Is(err, errCodeSearchUnavailable) {
+				// the contents API may still work, accept checking the
+				// root module only
+				files = rootGoModOnly()
+				repoSearchResult.source = sourceRootGoMod
+			} else if err != nil {
+				logf("error searching repository: %s, error: %v\n", repo.name, withRequestID(err))
+				s.timings.span("inspect", inspectStart, time.Since(inspectStart), map[string]string{"repo": repo.name, "outcome": "error"})
+				continue
+			}
+
+			goMods := files.CodeResults
+			partial := false
+			if s.maxGoModsPerRepo > 0 && len(goMods) > s.maxGoModsPerRepo {
+				logf("repository %s has %d go.mod files, checking the %d shallowest\n", repo.name, len(goMods), s.maxGoModsPerRepo)
+				goMods = shallowestGoMods(goMods, s.maxGoModsPerRepo)
+				partial = true
+			}
+
+			anomaly := false
+			// oversized is set when a go.mod was skipped for its size
+			oversized := false
+			// unchanged is set when the go.mod that decided the previous
+			// result still has the same blob SHA
+			unchanged := false
+			// indirect is the first go.mod requiring the package as an
+			// indirect dependency, checked with -verify-imports
+			var indirect goModFile
+			for _, file := range goMods {
+				f, sha, err := s.fetchGoMod(ctx, repo, file.GetPath(), cached.knownSHA(file.GetPath(), false))
+				if errors.Is(err, errGoModUnchanged) {
+					unchanged = true
+					break
+				}
+				if err != nil {
+					logf("%v\n", err)
+					anomaly = anomaly || errors.Is(err, errGoModAnomaly)
+					oversized = oversized || errors.Is(err, errGoModTooLarge)
+					continue
+				}
+				logf("parsed go.mod file: %s (score %g)\n", file.GetHTMLURL(), file.GetScore())
+
+				if module := s.matchGoMod(&repoSearchResult, file.GetPath(), f); module != "" && indirect.f == nil {
+					indirect = goModFile{path: file.GetPath(), f: f, module: module}
+				}
+				if repoSearchResult.goModPath == file.GetPath() {
+					repoSearchResult.score = file.GetScore()
+					repoSearchResult.goModSHA = sha
+				}
+			}
+
+			// An empty result with incomplete_results set, or for a young
+			// repository, means the repository may be missing from the code
+			// search index, so check the root go.mod directly before
+			// concluding the package is not used.
+			young := s.youngWindow > 0 && repo.youngerThan(s.youngWindow)
+			if !unchanged && files.GetTotal() == 0 && (files.GetIncompleteResults() || young) {
+				if young {
+					logf("repository %s is young and may not be indexed yet, checking the root go.mod\n", repo.name)
+				} else {
+					logf("code search results incomplete for repository %s, checking the root go.mod\n", repo.name)
+				}
+				f, sha, err := s.fetchGoMod(ctx, repo, "go.mod", cached.knownSHA("go.mod", true))
+				if errors.Is(err, errGoModUnchanged) {
+					unchanged = true
+				} else if err != nil {
+					logf("%v\n", err)
+					anomaly = anomaly || errors.Is(err, errGoModAnomaly)
+					oversized = oversized || errors.Is(err, errGoModTooLarge)
+					repoSearchResult.lowConfidence = true
+					repoSearchResult.confidence = confidenceLow
+				} else {
+					if module := s.matchGoMod(&repoSearchResult, "go.mod", f); module != "" && indirect.f == nil {
+						indirect = goModFile{path: "go.mod", f: f, module: module}
+					}
+					if !repoSearchResult.used || repoSearchResult.goModPath == "go.mod" {
+						repoSearchResult.goModSHA = sha
+					}
+				}
+			}
+
+			if unchanged {
+				logf("go.mod of repository %s unchanged-since blob %s, keeping the previous result\n", repo.name, shortSHA(cached.goModSHA))
+				repoSearchResult = cached.unchangedSince(repoSearchResult)
+			}
+
+			if !repoSearchResult.used && indirect.f != nil && s.verifyImports {
+				s.verifyIndirect(ctx, repo, &repoSearchResult, indirect)
+			}
+			if young && !repoSearchResult.used && s.youngTTL > 0 {
+				// the index may catch up, check again before long
+				repoSearchResult.recheckAfter = time.Now().Add(s.youngTTL)
+			}
+
+			if repoSearchResult.used && !unchanged {
+				repoSearchResult.hosting = classifyHosting(repoSearchResult.ownModule, repo.mirrorURL)
+			}
+
+			if repoSearchResult.used && s.checkVendor && !unchanged {
+				vendored, err := s.checkVendored(ctx, repo, repoSearchResult.goModPath, repoSearchResult.module)
+				if err != nil {
+					logf("%v\n", err)
+				} else {
+					logf("repository %s vendored: %t\n", repo.name, vendored)
+					repoSearchResult.vendorChecked = true
+					repoSearchResult.vendored = vendored
+				}
+			}
+
+			repoSearchResult.branch = s.goModRef(repo)
+
+			if repoSearchResult.used && s.checkGoSum && !unchanged {
+				versions, found, err := s.lockedVersions(ctx, repo, repoSearchResult.goModPath, repoSearchResult.module)
+				if err != nil {
+					logf("%v\n", err)
+				} else if !found {
+					logf("repository %s has no go.sum next to %s\n", repo.name, repoSearchResult.goModPath)
+				} else {
+					repoSearchResult.recordGoSum(versions)
+					if repoSearchResult.goSumMismatch {
+						logf("repository %s requires %s@%s but its go.sum locks %v\n", repo.name, repoSearchResult.module, repoSearchResult.rawVersion, versions)
+					}
+				}
+			}
+
+			if repoSearchResult.used && s.classifyTestUsage && !unchanged {
+				s.classifyTestOnly(ctx, repo, &repoSearchResult)
+			}
+
+			if repoSearchResult.used && s.countUsage && !unchanged {
+				s.countUsageFiles(ctx, repo, &repoSearchResult)
+			}
+
+			if partial {
+				repoSearchResult.state = statePartialScan
+			}
+			if repoSearchResult.source == sourceRootGoMod && !repoSearchResult.used {
+				// nested modules were not checked
+				repoSearchResult.confidence = confidenceMedium
+			}
+
+			if !repoSearchResult.used {
+				logf("Package %s not found in repository %s\n", s.packageName, repo.name)
+				if anomaly {
+					logf("Recording a fetch anomaly for repository %s, it will be checked again\n", repo.name)
+					repoSearchResult.state = stateAnomaly
+				} else if oversized {
+					logf("Repository %s has an oversized go.mod that was skipped\n", repo.name)
+					repoSearchResult.state = stateOversizedGoMod
+				}
+			}
+
+			repoSearchResult.scanDuration = time.Since(inspectStart)
+			s.record(results, repoSearchResult)
+			s.progress.touch()
+			s.timings.span("inspect", inspectStart, time.Since(inspectStart), map[string]string{"repo": repo.name, "outcome": inspectOutcome(repoSearchResult, unchanged)})
+
+			logf("Sleeping for %d seconds in searchInRepositories\n", int(s.searchDelay.Seconds()))
+			stop := s.timings.track(phaseSleep, repo.name)
+			if err := sleepWithContext(ctx, s.searchDelay); err != nil {
+				logf("Sleep was interrupted: %v\n", err)
+			}
+			stop()
+		}
+	}
+
+	return results, nil
+}
+
+// inspectOutcome describes the result of an inspection for its trace span.
+func inspectOutcome(r repoResult, unchanged bool) string {
+	switch {
+	case unchanged:
+		return "unchanged"
+	case r.state == stateAnomaly:
+		return stateAnomaly
+	case r.used:
+		return "used"
+	default:
+		return "not-used"
+	}
+}
+
+// goModRef returns the branch the go.mod files of the repository are read
+// at: -branch, or an empty string for the default branch when there is no
+// -branch or the repository doesn't have it.
+func (s *searchResult) goModRef(repo candidate) string {
+	if s.missingBranch[repo.name] {
+		return ""
+	}
+	return s.branch
+}
+
+// fetchGoMod downloads and parses the go.mod file at path in the repository,
+// from the configured branch if there is one, and returns its blob SHA. A
+// go.mod whose SHA is knownSHA is not downloaded, errGoModUnchanged is
+// returned instead.
+func (s *searchResult) fetchGoMod(ctx context.Context, repo candidate, path, knownSHA string) (*modfile.File, string, error) {
+	var opts *github.RepositoryContentGetOptions
+	if ref := s.goModRef(repo); ref != "" {
+		opts = &github.RepositoryContentGetOptions{Ref: ref}
+	}
+
+	// stop ends the download measurement, and later the parse one
+	stop := s.timings.track(phaseDownload, repo.name+"/"+path)
+	defer func() { stop() }()
+
+	entry, err := s.contentEntry(ctx, repo, path, opts)
+	if err != nil && opts != nil && isNotFound(err) {
+		// the file may be missing from the branch, only a missing branch
+		// falls back to the default one
+		_, resp, branchErr := s.client.Repositories.GetBranch(ctx, repo.owner, repo.repo, opts.Ref, 0)
+		// GetBranch returns a plain error with the response for statuses
+		// other than 200
+		if isNotFound(branchErr) || branchErr != nil && resp != nil && resp.StatusCode == http.StatusNotFound {
+			logf("branch %s not found in repository %s, using the default branch\n", opts.Ref, repo.name)
+			s.missingBranch[repo.name] = true
+			entry, err = s.contentEntry(ctx, repo, path, nil)
+		}
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("error downloading go.mod file: %w", withRequestID(err))
+	}
+	sha := entry.GetSHA()
+	if knownSHA != "" && sha == knownSHA {
+		return nil, sha, errGoModUnchanged
+	}
+	if s.maxGoModBytes > 0 && int64(entry.GetSize()) > s.maxGoModBytes {
+		return nil, sha, fmt.Errorf("skipping go.mod file %s of %s, %d bytes: %w", path, repo.name, entry.GetSize(), errGoModTooLarge)
+	}
+
+	bb, err := s.download(ctx, entry.GetDownloadURL(), s.maxGoModBytes)
+	if errors.Is(err, errGoModTooLarge) {
+		return nil, sha, fmt.Errorf("skipping go.mod file %s of %s: %w", path, repo.name, err)
+	}
+	if err != nil {
+		return nil, sha, fmt.Errorf("error reading go.mod file: %v", err)
+	}
+	stop()
+	stop = s.timings.track(phaseParse, repo.name+"/"+path)
+
+	trimmed := bytes.TrimSpace(bb)
+	if len(trimmed) < minGoModSize || bytes.HasPrefix(trimmed, []byte("version https://git-lfs")) {
+		return nil, sha, fmt.Errorf("error reading go.mod file %s: %w", path, errGoModAnomaly)
+	}
+
+	f, err := modfile.Parse("go.mod", bb, nil)
+	if err != nil {
+		return nil, sha, fmt.Errorf("error parsing go.mod file: %v", err)
+	}
+
+	return f, sha, nil
+}
+
+// contentEntry returns the entry of the file at path in the listing of its
+// directory, which holds its blob SHA and download URL. It is what
+// DownloadContents does before downloading.
+func (s *searchResult) contentEntry(ctx context.Context, repo candidate, filePath string, opts *github.RepositoryContentGetOptions) (*github.RepositoryContent, error) {
+	dir, name := path.Dir(filePath), path.Base(filePath)
+	_, entries, _, err := s.client.Repositories.GetContents(ctx, repo.owner, repo.repo, dir, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.GetName() != name {
+			continue
+		}
+		if entry.GetDownloadURL() == "" {
+			return nil, fmt.Errorf("no download link found for %s", filePath)
+		}
+		return entry, nil
+	}
+	return nil, fmt.Errorf("no file named %s found in %s", name, dir)
+}
+
+// download returns the content at a download URL of the contents API. Content
+// over limit bytes fails with errGoModTooLarge, a limit of 0 reads it all.
+func (s *searchResult) download(ctx context.Context, url string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if limit <= 0 {
+		return io.ReadAll(resp.Body)
+	}
+	// the listing may report a wrong size, don't rely on it
+	bb, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err == nil && int64(len(bb)) > limit {
+		return nil, errGoModTooLarge
+	}
+	return bb, err
+}
+
+// shortSHA abbreviates a Git SHA for the log.
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// matchGoMod marks the result as used if the go.mod file at path requires
+// one of the modules, the first one in s.modules wins. Otherwise it returns
+// the first module only required as an indirect dependency, if any.
+func (s *searchResult) matchGoMod(result *repoResult, path string, f *modfile.File) string {
+	s.findNearMisses(result.name, path, f)
+	indirect := ""
+	for _, pattern := range s.modules {
+		module := modulePrefix(pattern)
+		require := findRequireMatching(f, pattern)
+		if require != nil {
+			module = require.Mod.Path
+		}
+		tool := usesTool(f, modulePrefix(pattern))
+		// an indirect dependency only counts when the module runs it as a
+		// tool
+		if !tool && (require == nil || require.Indirect) {
+			if require != nil && indirect == "" {
+				indirect = module
+			}
+			continue
+		}
+
+		s.markUsed(result, module, path, f, require, tool)
+		return ""
+	}
+	return indirect
+}
+
+// wildcardSuffix ends a module pattern standing for the module and the
+// modules nested in it, e.g. github.com/org/proj/... for github.com/org/proj
+// and github.com/org/proj/api.
+const wildcardSuffix = "/..."
+
+// isWildcard reports whether the module pattern ends in /....
+func isWildcard(pattern string) bool {
+	return strings.HasSuffix(pattern, wildcardSuffix)
+}
+
+// modulePrefix returns the module path of a pattern, without /....
+func modulePrefix(pattern string) string {
+	return strings.TrimSuffix(pattern, wildcardSuffix)
+}
+
+// matchesModule reports whether a module path matches the pattern: equals
+// it, or for a wildcard is the module or nested in it at a path boundary.
+func matchesModule(pattern, path string) bool {
+	if !isWildcard(pattern) {
+		return path == pattern
+	}
+	prefix := modulePrefix(pattern)
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// findRequireMatching returns the requirement of a module matching the
+// pattern in the go.mod file, a direct one rather than an indirect one, or
+// nil if there is none.
+func findRequireMatching(f *modfile.File, pattern string) *modfile.Require {
+	var indirect *modfile.Require
+	for _, r := range f.Require {
+		if !matchesModule(pattern, r.Mod.Path) {
+			continue
+		}
+		if !r.Indirect {
+			return r
+		}
+		if indirect == nil {
+			indirect = r
+		}
+	}
+	return indirect
+}
+
+// findRequire returns the requirement of the module in the go.mod file, or
+// nil if there is none.
+func findRequire(f *modfile.File, modulePath string) *modfile.Require {
+	for _, r := range f.Require {
+		if r.Mod.Path == modulePath {
+			return r
+		}
+	}
+	return nil
+}
+
+// markUsed records the requirement of the module by the go.mod file at path
+// in the result.
+func (s *searchResult) markUsed(result *repoResult, module, path string, f *modfile.File, require *modfile.Require, tool bool) {
+	var version string
+	if require != nil {
+		version = require.Mod.Version
+	}
+	if tool {
+		logf("Found package %s@%s as a tool in repository %s\n", module, version, result.name)
+	} else {
+		logf("Found package %s@%s in repository %s\n", module, version, result.name)
+	}
+	result.used = true
+	result.module = module
+	result.tool = tool
+	result.version = normalizeVersion(version)
+	result.rawVersion = version
+	result.goModPath = path
+	result.directRequires = countDirectRequires(f)
+	if f.Module != nil {
+		result.ownModule = f.Module.Mod.Path
+	}
+	result.matches = append(result.matches, goModMatch{path: path, rawVersion: version})
+	if s.classifyModules {
+		result.moduleKind = strongerModuleKind(result.moduleKind, classifyModulePath(path))
+	}
+	if fork := forkReplacement(f, module); fork != "" {
+		logf("Repository %s uses the fork %s of package %s\n", result.name, fork, module)
+		result.fork = fork
+	}
+}
+
+// countDirectRequires returns the number of requirements of the go.mod file
+// that are not indirect.
+func countDirectRequires(f *modfile.File) int {
+	n := 0
+	for _, r := range f.Require {
+		if !r.Indirect {
+			n++
+		}
+	}
+	return n
+}
+
+// dependencyShare is the share of the package among the direct requirements
+// of the go.mod requiring it: an adopter with 8 dependencies relies more on
+// each than one with 400. It is 0 when unknown.
+func (r repoResult) dependencyShare() float64 {
+	if r.directRequires <= 0 {
+		return 0
+	}
+	return 1 / float64(r.directRequires)
+}
+
+// usesTool reports whether a tool directive of the go.mod file names the
+// package or one of its subpackages. Tool directives exist since Go 1.24.
+func usesTool(f *modfile.File, packageName string) bool {
+	for _, tool := range f.Tool {
+		if tool.Path == packageName || strings.HasPrefix(tool.Path, packageName+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// forkReplacement returns the module@version the package is replaced with
+// in the go.mod file, or an empty string if it isn't replaced by another
+// module. Replacements with a local directory are not forks.
+func forkReplacement(f *modfile.File, packageName string) string {
+	for _, replace := range f.Replace {
+		if replace.Old.Path != packageName || replace.New.Version == "" || replace.New.Path == packageName {
+			continue
+		}
+		return replace.New.Path + "@" + replace.New.Version
+	}
+	return ""
+}
+
+// isNotFound reports whether err is a 404 response from the GitHub API.
+func isNotFound(err error) bool {
+	var errResp *github.ErrorResponse
+	return errors.As(err, &errResp) && errResp.Response != nil && errResp.Response.StatusCode == http.StatusNotFound
+}
@@ -0,0 +1,795 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"github.com/google/go-github/v63/github"
+	"golang.org/x/mod/modfile"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newTestClient returns a GitHub client sending its requests to handler.
+func newTestClient(t *testing.T, handler http.Handler) *github.Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+	return client
+}
+
+// fakeRepo serves the contents and branches API of the repository o/r: the
+// files of every branch, the first one being the default branch.
+func fakeRepo(t *testing.T, defaultBranch string, branches map[string]map[string]string) *github.Client {
+	mux := http.NewServeMux()
+	var srvURL string
+	mux.HandleFunc("/repos/o/r/branches/", func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/repos/o/r/branches/")
+		if _, ok := branches[name]; !ok {
+			http.Error(w, `{"message": "Branch not found"}`, http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"name": %q}`, name)
+	})
+	mux.HandleFunc("/repos/o/r/contents/", func(w http.ResponseWriter, r *http.Request) {
+		ref := r.URL.Query().Get("ref")
+		if ref == "" {
+			ref = defaultBranch
+		}
+		files, ok := branches[ref]
+		if !ok {
+			http.Error(w, `{"message": "No commit found for the ref"}`, http.StatusNotFound)
+			return
+		}
+		var entries []map[string]any
+		for name, content := range files {
+			entries = append(entries, map[string]any{
+				"type":         "file",
+				"name":         name,
+				"path":         name,
+				"sha":          ref + "-" + name,
+				"size":         len(content),
+				"download_url": srvURL + "/raw/" + ref + "/" + name,
+			})
+		}
+		json.NewEncoder(w).Encode(entries)
+	})
+	mux.HandleFunc("/raw/", func(w http.ResponseWriter, r *http.Request) {
+		ref, name, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/raw/"), "/")
+		fmt.Fprint(w, branches[ref][name])
+	})
+	client := newTestClient(t, mux)
+	srvURL = strings.TrimSuffix(client.BaseURL.String(), "/")
+	return client
+}
+
+// fakeGitHub serves the repository search, code search, contents and
+// download APIs over the files of fake repositories.
+type fakeGitHub struct {
+	// repos are the files of the repositories by full name, then by path
+	repos map[string]map[string]string
+	// listing is the repository search result, served perPage at a time
+	listing []*github.Repository
+	// orgs are the repositories of organizations, by organization
+	orgs map[string][]*github.Repository
+	// scores are the code search scores of files, by repository/path
+	scores map[string]float64
+	// codeSearchStatus fails the code searches with the status when set
+	codeSearchStatus int
+	// incomplete marks the code search results of the repositories as
+	// incomplete and empty, as for a repository missing from the index
+	incomplete map[string]bool
+	// downloads replace the downloaded content of files, by
+	// repository/path, for files indexed with other content
+	downloads map[string]string
+	// requestID is the GitHub request ID of every response
+	requestID string
+	// login is the user authenticated by the token, the token is rejected
+	// when it is empty
+	login string
+
+	mu       sync.Mutex
+	requests []string
+}
+
+// client returns a GitHub client for the fake.
+func (f *fakeGitHub) client(t *testing.T) *github.Client {
+	t.Helper()
+	var srvURL string
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.requests = append(f.requests, r.URL.Path+"?"+r.URL.RawQuery)
+		f.mu.Unlock()
+		if f.requestID != "" {
+			w.Header().Set(requestIDHeader, f.requestID)
+		}
+
+		switch {
+		case r.URL.Path == "/search/repositories":
+			f.serveRepositories(w, r, srvURL)
+		case r.URL.Path == "/search/code":
+			f.serveCode(w, r)
+		case strings.HasPrefix(r.URL.Path, "/orgs/"):
+			org := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/orgs/"), "/repos")
+			json.NewEncoder(w).Encode(f.orgs[org])
+		case strings.HasPrefix(r.URL.Path, "/repos/"):
+			f.serveContents(w, r, srvURL)
+		case strings.HasPrefix(r.URL.Path, "/raw/"):
+			f.serveRaw(w, r)
+		case r.URL.Path == "/user" && f.login != "":
+			fmt.Fprintf(w, `{"login": %q}`, f.login)
+		case r.URL.Path == "/user":
+			http.Error(w, `{"message": "Bad credentials"}`, http.StatusUnauthorized)
+		case r.URL.Path == "/rate_limit":
+			fmt.Fprint(w, `{"resources": {"core": {"limit": 5000, "remaining": 4999}, "search": {"limit": 30, "remaining": 30}}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	srvURL = strings.TrimSuffix(client.BaseURL.String(), "/")
+	return client
+}
+
+// requested returns the number of requests to paths with the prefix.
+func (f *fakeGitHub) requested(prefix string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, path := range f.requests {
+		if strings.HasPrefix(path, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func (f *fakeGitHub) serveRepositories(w http.ResponseWriter, r *http.Request, srvURL string) {
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if perPage <= 0 {
+		perPage = 30
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	page = max(page, 1)
+	start, end := min((page-1)*perPage, len(f.listing)), min(page*perPage, len(f.listing))
+	if end < len(f.listing) {
+		next := *r.URL
+		query := next.Query()
+		query.Set("page", strconv.Itoa(page+1))
+		next.RawQuery = query.Encode()
+		w.Header().Set("Link", fmt.Sprintf(`<%s%s>; rel="next"`, srvURL, next.RequestURI()))
+	}
+	json.NewEncoder(w).Encode(map[string]any{"total_count": len(f.listing), "items": f.listing[start:end]})
+}
+
+// serveCode answers the go.mod searches, `<pkg> repo:<repo> filename:go.mod`,
+// and the import searches, `"<module>" repo:<repo> language:go`.
+func (f *fakeGitHub) serveCode(w http.ResponseWriter, r *http.Request) {
+	if f.codeSearchStatus != 0 {
+		http.Error(w, `{"message": "code search refused"}`, f.codeSearchStatus)
+		return
+	}
+	fields := strings.Fields(r.URL.Query().Get("q"))
+	term, repo := strings.Trim(fields[0], `"`), ""
+	goMods := false
+	for _, field := range fields[1:] {
+		if name, ok := strings.CutPrefix(field, "repo:"); ok {
+			repo = name
+		}
+		goMods = goMods || field == "filename:go.mod"
+	}
+
+	items := []map[string]any{}
+	incomplete := f.incomplete[repo]
+	if !incomplete {
+		for filePath, content := range f.repos[repo] {
+			isGoMod := path.Base(filePath) == "go.mod"
+			if isGoMod != goMods || !isGoMod && !strings.HasSuffix(filePath, ".go") || !strings.Contains(content, term) {
+				continue
+			}
+			items = append(items, map[string]any{"name": path.Base(filePath), "path": filePath, "score": f.scores[repo+"/"+filePath]})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i]["path"].(string) < items[j]["path"].(string) })
+	json.NewEncoder(w).Encode(map[string]any{"total_count": len(items), "incomplete_results": incomplete, "items": items})
+}
+
+func (f *fakeGitHub) serveContents(w http.ResponseWriter, r *http.Request, srvURL string) {
+	// /repos/<owner>/<repo>/contents/<dir>
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/repos/"), "/", 4)
+	if len(parts) < 3 || parts[2] != "contents" {
+		http.NotFound(w, r)
+		return
+	}
+	repo := parts[0] + "/" + parts[1]
+	files, ok := f.repos[repo]
+	if !ok {
+		http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+		return
+	}
+	dir := "."
+	if len(parts) == 4 && parts[3] != "" {
+		dir = path.Clean(parts[3])
+	}
+	entries := []map[string]any{}
+	for filePath, content := range files {
+		if path.Dir(filePath) != dir {
+			continue
+		}
+		entries = append(entries, map[string]any{
+			"type":         "file",
+			"name":         path.Base(filePath),
+			"path":         filePath,
+			"sha":          fmt.Sprintf("%x", sha1.Sum([]byte(content))),
+			"size":         len(content),
+			"download_url": srvURL + "/raw/" + repo + "/" + filePath,
+		})
+	}
+	if len(entries) == 0 {
+		http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(entries)
+}
+
+func (f *fakeGitHub) serveRaw(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/raw/"), "/", 3)
+	if content, ok := f.downloads[strings.Join(parts, "/")]; ok {
+		fmt.Fprint(w, content)
+		return
+	}
+	content, ok := f.repos[parts[0]+"/"+parts[1]][parts[2]]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	fmt.Fprint(w, content)
+}
+
+func goModRequiring(version string) string {
+	return "module example.com/app\n\ngo 1.22\n\nrequire github.com/x/lib " + version + "\n"
+}
+
+// fakeCandidate returns the candidate of a fake repository.
+func fakeCandidate(name string, stars int) candidate {
+	owner, repo, _ := strings.Cut(name, "/")
+	return candidate{name: name, owner: owner, repo: repo, stars: stars}
+}
+
+// newFakeSearch returns a search for the package on the fake, without
+// delays.
+func newFakeSearch(t *testing.T, f *fakeGitHub, packageName string) *searchResult {
+	s := newSearchResult(packageName, f.client(t), nil)
+	s.paginationDelay, s.searchDelay = 0, 0
+	return s
+}
+
+func TestSearchInRepositories(t *testing.T) {
+	f := &fakeGitHub{
+		repos: map[string]map[string]string{
+			"a/root":   {"go.mod": goModRequiring("v1.0.0")},
+			"a/nested": {"go.mod": "module example.com/nested\n", "tools/go.mod": goModRequiring("v1.2.0")},
+			"a/unused": {"go.mod": "module example.com/unused\n\nrequire github.com/x/other v1.0.0\n"},
+			"a/young":  {"go.mod": goModRequiring("v0.9.0")},
+		},
+		incomplete: map[string]bool{"a/young": true},
+	}
+	tests := []struct {
+		name        string
+		candidate   candidate
+		wantUsed    bool
+		wantVersion string
+		wantPath    string
+	}{
+		{name: "root go.mod", candidate: fakeCandidate("a/root", 10), wantUsed: true, wantVersion: "v1.0.0", wantPath: "go.mod"},
+		{name: "nested go.mod", candidate: fakeCandidate("a/nested", 10), wantUsed: true, wantVersion: "v1.2.0", wantPath: "tools/go.mod"},
+		{name: "not used", candidate: fakeCandidate("a/unused", 10)},
+		{name: "missing from the index", candidate: fakeCandidate("a/young", 10), wantUsed: true, wantVersion: "v0.9.0", wantPath: "go.mod"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeSearch(t, f, "github.com/x/lib")
+			results, err := s.searchInRepositories(context.Background(), []candidate{tt.candidate})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := results[tt.candidate.name]
+			if !ok {
+				t.Fatalf("no result for %s", tt.candidate.name)
+			}
+			if got.used != tt.wantUsed || got.rawVersion != tt.wantVersion || got.goModPath != tt.wantPath {
+				t.Errorf("got used %v, version %q at %q, want %v, %q at %q", got.used, got.rawVersion, got.goModPath, tt.wantUsed, tt.wantVersion, tt.wantPath)
+			}
+			if got.stars != tt.candidate.stars {
+				t.Errorf("got %d stars, want %d", got.stars, tt.candidate.stars)
+			}
+		})
+	}
+}
+
+func TestSearchInRepositoriesSkips(t *testing.T) {
+	f := &fakeGitHub{repos: map[string]map[string]string{
+		"a/cached":    {"go.mod": goModRequiring("v1.0.0")},
+		"mirrors/lib": {"go.mod": goModRequiring("v1.0.0")},
+	}}
+	s := newFakeSearch(t, f, "github.com/x/lib")
+	s.cache = map[string]repoResult{"a/cached": {name: "a/cached", used: true, rawVersion: "v1.0.0"}}
+
+	results, err := s.searchInRepositories(context.Background(), []candidate{fakeCandidate("a/cached", 1), fakeCandidate("mirrors/lib", 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := results["a/cached"]; ok {
+		t.Error("cached repository checked again")
+	}
+	if got := results["mirrors/lib"]; got.state != stateSkippedMirror || got.source != sourceRepoSearch {
+		t.Errorf("mirror recorded in state %q from %q, want %q from %q", got.state, got.source, stateSkippedMirror, sourceRepoSearch)
+	}
+	if n := f.requested("/search/code"); n != 0 {
+		t.Errorf("%d code searches for skipped repositories", n)
+	}
+
+	// a repository listed again in the same run isn't checked twice
+	results, err = s.searchInRepositories(context.Background(), []candidate{fakeCandidate("mirrors/lib", 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Errorf("results %v for a repository already checked", results)
+	}
+
+	// a dependents result is verified once the search finds the repository
+	s.cache["b/dependent"] = repoResult{name: "b/dependent", used: true, source: sourceDependents, confidence: confidenceMedium}
+	f.repos["b/dependent"] = map[string]string{"go.mod": goModRequiring("v1.2.0")}
+	results, err = s.searchInRepositories(context.Background(), []candidate{fakeCandidate("b/dependent", 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := results["b/dependent"]; got.source != sourceCodeSearch || got.rawVersion != "v1.2.0" {
+		t.Errorf("dependents result checked again with source %q, version %q", got.source, got.rawVersion)
+	}
+}
+
+func TestClampPerPage(t *testing.T) {
+	tests := []struct {
+		perPage int
+		want    int
+	}{
+		{perPage: -5, want: 1},
+		{perPage: 0, want: 1},
+		{perPage: 1, want: 1},
+		{perPage: 30, want: 30},
+		{perPage: maxPerPage, want: maxPerPage},
+		{perPage: maxPerPage + 1, want: maxPerPage},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.perPage), func(t *testing.T) {
+			if got := clampPerPage(tt.perPage); got != tt.want {
+				t.Errorf("clampPerPage(%d) = %d, want %d", tt.perPage, got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeRepository returns the repository search item of a fake repository.
+func fakeRepository(name string, stars int) *github.Repository {
+	owner, repo, _ := strings.Cut(name, "/")
+	return &github.Repository{
+		FullName:        github.String(name),
+		Name:            github.String(repo),
+		Owner:           &github.User{Login: github.String(owner)},
+		StargazersCount: github.Int(stars),
+	}
+}
+
+func TestSearchPages(t *testing.T) {
+	f := &fakeGitHub{repos: map[string]map[string]string{}}
+	for i := range 7 {
+		name := fmt.Sprintf("a/repo%d", i)
+		f.listing = append(f.listing, fakeRepository(name, 100-i))
+		f.repos[name] = map[string]string{"go.mod": goModRequiring("v1.0.0")}
+	}
+	tests := []struct {
+		name      string
+		perPage   int
+		maxPages  int
+		wantPages int
+		wantRepos int
+	}{
+		{name: "one page", perPage: 10, wantPages: 1, wantRepos: 7},
+		{name: "exact pages", perPage: 7, wantPages: 1, wantRepos: 7},
+		{name: "last page short", perPage: 3, wantPages: 3, wantRepos: 7},
+		{name: "one per page", perPage: 1, wantPages: 7, wantRepos: 7},
+		{name: "max pages", perPage: 2, maxPages: 2, wantPages: 2, wantRepos: 4},
+		{name: "max pages not reached", perPage: 3, maxPages: 5, wantPages: 3, wantRepos: 7},
+		{name: "max pages reached on the last page", perPage: 3, maxPages: 3, wantPages: 3, wantRepos: 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f.requests = nil
+			s := newFakeSearch(t, f, "github.com/x/lib")
+			s.maxPages = tt.maxPages
+			results, err := s.Search(context.Background(), "language:go", &github.SearchOptions{ListOptions: github.ListOptions{PerPage: tt.perPage}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := f.requested("/search/repositories"); n != tt.wantPages {
+				t.Errorf("%d pages searched, want %d", n, tt.wantPages)
+			}
+			if len(results) != tt.wantRepos {
+				t.Errorf("%d repositories checked, want %d", len(results), tt.wantRepos)
+			}
+		})
+	}
+}
+
+func TestFetchGoModBranch(t *testing.T) {
+	repo := candidate{name: "o/r", owner: "o", repo: "r"}
+	tests := []struct {
+		name        string
+		branch      string
+		branches    map[string]map[string]string
+		wantVersion string
+		wantRef     string
+		wantErr     bool
+	}{
+		{
+			name:   "default branch",
+			branch: "",
+			branches: map[string]map[string]string{
+				"main": {"go.mod": goModRequiring("v1.0.0")},
+			},
+			wantVersion: "v1.0.0",
+		},
+		{
+			name:   "named branch",
+			branch: "next",
+			branches: map[string]map[string]string{
+				"main": {"go.mod": goModRequiring("v1.0.0")},
+				"next": {"go.mod": goModRequiring("v1.1.0")},
+			},
+			wantVersion: "v1.1.0",
+			wantRef:     "next",
+		},
+		{
+			name:   "missing branch",
+			branch: "next",
+			branches: map[string]map[string]string{
+				"main": {"go.mod": goModRequiring("v1.0.0")},
+			},
+			wantVersion: "v1.0.0",
+		},
+		{
+			name:   "go.mod missing from the branch",
+			branch: "next",
+			branches: map[string]map[string]string{
+				"main": {"go.mod": goModRequiring("v1.0.0")},
+				"next": {"README.md": "moved"},
+			},
+			wantRef: "next",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSearchResult("github.com/x/lib", fakeRepo(t, "main", tt.branches), nil)
+			s.branch = tt.branch
+			f, _, err := s.fetchGoMod(context.Background(), repo, "go.mod", "")
+			if got := s.goModRef(repo); got != tt.wantRef {
+				t.Errorf("read at %q, want %q", got, tt.wantRef)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := f.Require[0].Mod.Version; got != tt.wantVersion {
+				t.Errorf("version %s, want %s", got, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestSearchInRepositoriesAnomaly(t *testing.T) {
+	tests := []struct {
+		name      string
+		download  string
+		wantState string
+		wantUsed  bool
+	}{
+		{name: "empty", download: "", wantState: stateAnomaly},
+		{name: "blank", download: " \n\t\n", wantState: stateAnomaly},
+		{name: "truncated", download: "module", wantState: stateAnomaly},
+		{name: "git-lfs pointer", download: "version https://git-lfs.github.com/spec/v1\noid sha256:4d7a\nsize 1234\n", wantState: stateAnomaly},
+		{name: "smallest go.mod", download: "module a\n"},
+		{name: "complete", download: goModRequiring("v1.0.0"), wantUsed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeGitHub{
+				repos:     map[string]map[string]string{"a/repo": {"go.mod": goModRequiring("v1.0.0")}},
+				downloads: map[string]string{"a/repo/go.mod": tt.download},
+			}
+			s := newFakeSearch(t, f, "github.com/x/lib")
+			results, err := s.searchInRepositories(context.Background(), []candidate{fakeCandidate("a/repo", 10)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := results["a/repo"]
+			if got.state != tt.wantState || got.used != tt.wantUsed {
+				t.Errorf("state %q, used %v, want %q, %v", got.state, got.used, tt.wantState, tt.wantUsed)
+			}
+			// an anomaly is checked again by the next run
+			next := newFakeSearch(t, f, "github.com/x/lib")
+			next.cache = results
+			if _, err := next.searchInRepositories(context.Background(), []candidate{fakeCandidate("a/repo", 10)}); err != nil {
+				t.Fatal(err)
+			}
+			if checked := f.requested("/search/code") == 2; checked != (tt.wantState == stateAnomaly) {
+				t.Errorf("checked again: %v, want %v", checked, tt.wantState == stateAnomaly)
+			}
+		})
+	}
+}
+
+func TestSearchInRepositoriesRequestID(t *testing.T) {
+	tests := []struct {
+		name string
+		fake *fakeGitHub
+	}{
+		{name: "code search error", fake: &fakeGitHub{repos: map[string]map[string]string{"a/repo": {"go.mod": goModRequiring("v1.0.0")}}, codeSearchStatus: http.StatusBadGateway}},
+		{name: "go.mod download error", fake: &fakeGitHub{repos: map[string]map[string]string{}, incomplete: map[string]bool{"a/repo": true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logOutput = &buf
+			defer func() { logOutput = io.Discard }()
+
+			tt.fake.requestID = "C0DE:5EA2C4:1F"
+			s := newFakeSearch(t, tt.fake, "github.com/x/lib")
+			if _, err := s.searchInRepositories(context.Background(), []candidate{fakeCandidate("a/repo", 10)}); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(buf.String(), "(request id: C0DE:5EA2C4:1F)") {
+				t.Errorf("request id missing from the log:\n%s", buf.String())
+			}
+		})
+	}
+}
+
+func TestForkReplacement(t *testing.T) {
+	tests := []struct {
+		name    string
+		replace string
+		want    string
+	}{
+		{name: "fork", replace: "replace github.com/x/lib => github.com/jdoe/lib v1.0.1-fix", want: "github.com/jdoe/lib@v1.0.1-fix"},
+		{name: "fork of a version", replace: "replace github.com/x/lib v1.0.0 => github.com/jdoe/lib v1.0.1", want: "github.com/jdoe/lib@v1.0.1"},
+		{name: "local directory", replace: "replace github.com/x/lib => ../lib"},
+		{name: "same module", replace: "replace github.com/x/lib => github.com/x/lib v1.1.0"},
+		{name: "other module", replace: "replace github.com/x/other => github.com/jdoe/other v1.0.0"},
+		{name: "no replace"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := goModRequiring("v1.0.0") + tt.replace + "\n"
+			f, err := modfile.Parse("go.mod", []byte(content), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := forkReplacement(f, "github.com/x/lib"); got != tt.want {
+				t.Errorf("forkReplacement = %q, want %q", got, tt.want)
+			}
+
+			// the fork is reported with the result
+			fake := &fakeGitHub{repos: map[string]map[string]string{"a/repo": {"go.mod": content}}}
+			s := newFakeSearch(t, fake, "github.com/x/lib")
+			results, err := s.searchInRepositories(context.Background(), []candidate{fakeCandidate("a/repo", 10)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := results["a/repo"]; !got.used || got.fork != tt.want {
+				t.Errorf("result used %v with fork %q, want a fork %q", got.used, got.fork, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchInRepositoriesScore(t *testing.T) {
+	f := &fakeGitHub{
+		repos: map[string]map[string]string{
+			"a/root":   {"go.mod": goModRequiring("v1.0.0")},
+			"a/nested": {"go.mod": "module example.com/nested\n\nrequire github.com/x/libx v1.0.0\n", "tools/go.mod": goModRequiring("v1.2.0")},
+			"a/unused": {"go.mod": "module example.com/unused\n\nrequire github.com/x/libx v1.0.0\n"},
+		},
+		scores: map[string]float64{"a/root/go.mod": 12.5, "a/nested/go.mod": 9.25, "a/nested/tools/go.mod": 3.75, "a/unused/go.mod": 7},
+	}
+	tests := []struct {
+		repo      string
+		wantScore float64
+	}{
+		{repo: "a/root", wantScore: 12.5},
+		{repo: "a/nested", wantScore: 3.75},
+		// the score is that of a matching go.mod
+		{repo: "a/unused"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.repo, func(t *testing.T) {
+			s := newFakeSearch(t, f, "github.com/x/lib")
+			results, err := s.searchInRepositories(context.Background(), []candidate{fakeCandidate(tt.repo, 10)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := results[tt.repo].score; got != tt.wantScore {
+				t.Errorf("score %g, want %g", got, tt.wantScore)
+			}
+		})
+	}
+}
+
+func TestMatchGoModTool(t *testing.T) {
+	tests := []struct {
+		name     string
+		goMod    string
+		wantUsed bool
+		wantTool bool
+	}{
+		{name: "tool", goMod: "module example.com/app\n\ngo 1.24\n\ntool github.com/x/lib/cmd/gen\n\nrequire github.com/x/lib v1.3.0 // indirect\n", wantUsed: true, wantTool: true},
+		{name: "module as a tool", goMod: "module example.com/app\n\ngo 1.24\n\ntool github.com/x/lib\n\nrequire github.com/x/lib v1.3.0 // indirect\n", wantUsed: true, wantTool: true},
+		{name: "tool block", goMod: "module example.com/app\n\ngo 1.24\n\ntool (\n\tgolang.org/x/tools/cmd/stringer\n\tgithub.com/x/lib/cmd/gen\n)\n\nrequire github.com/x/lib v1.3.0 // indirect\n", wantUsed: true, wantTool: true},
+		{name: "direct require", goMod: goModRequiring("v1.3.0"), wantUsed: true},
+		{name: "indirect require only", goMod: "module example.com/app\n\nrequire github.com/x/lib v1.3.0 // indirect\n"},
+		{name: "other tool", goMod: "module example.com/app\n\ngo 1.24\n\ntool github.com/x/library/cmd/gen\n\nrequire github.com/x/library v1.0.0 // indirect\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := modfile.Parse("go.mod", []byte(tt.goMod), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := newSearchResult("github.com/x/lib", nil, nil)
+			result := repoResult{name: "a/repo"}
+			s.matchGoMod(&result, "go.mod", f)
+			if result.used != tt.wantUsed || result.tool != tt.wantTool {
+				t.Errorf("used %v, tool %v, want %v, %v", result.used, result.tool, tt.wantUsed, tt.wantTool)
+			}
+			if tt.wantTool && result.rawVersion != "v1.3.0" {
+				t.Errorf("version %q, want the required v1.3.0", result.rawVersion)
+			}
+		})
+	}
+}
+
+func TestDirectRequires(t *testing.T) {
+	f := &fakeGitHub{repos: map[string]map[string]string{
+		"a/app": {"go.mod": `module example.com/app
+
+require (
+	github.com/x/lib v1.0.0
+	github.com/y/one v1.0.0
+	github.com/y/two v1.0.0
+	github.com/y/three v1.0.0
+	github.com/y/four v1.0.0 // indirect
+)
+`},
+		// the count is the one of the matching go.mod, not a sum over the
+		// modules of the repository
+		"a/mono": {
+			"go.mod":       "module example.com/mono\n\nrequire (\n\tgithub.com/y/one v1.0.0\n\tgithub.com/y/two v1.0.0\n)\n",
+			"tools/go.mod": "module example.com/mono/tools\n\nrequire (\n\tgithub.com/x/lib v1.0.0\n\tgithub.com/y/one v1.0.0\n)\n",
+		},
+	}}
+	s := newFakeSearch(t, f, "github.com/x/lib")
+	results, err := s.searchInRepositories(context.Background(), []candidate{fakeCandidate("a/app", 10), fakeCandidate("a/mono", 10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		repo      string
+		wantCount int
+		wantShare float64
+	}{
+		{repo: "a/app", wantCount: 4, wantShare: 0.25},
+		{repo: "a/mono", wantCount: 2, wantShare: 0.5},
+	}
+	for _, tt := range tests {
+		got := results[tt.repo]
+		if got.directRequires != tt.wantCount || got.dependencyShare() != tt.wantShare {
+			t.Errorf("%s: %d direct requirements, share %g, want %d, %g", tt.repo, got.directRequires, got.dependencyShare(), tt.wantCount, tt.wantShare)
+		}
+	}
+
+	// -sort dependency-share ranks the adopters relying most on the package
+	// first
+	ranked := []repoResult{results["a/app"], {name: "a/unknown", used: true, stars: 50}, results["a/mono"]}
+	less := sortKeys["dependency-share"]
+	sort.SliceStable(ranked, func(i, j int) bool { return less(ranked[i], ranked[j]) })
+	if ranked[0].name != "a/mono" || ranked[2].name != "a/unknown" {
+		t.Errorf("ranked %s, %s, %s, want a/mono first and the unknown share last", ranked[0].name, ranked[1].name, ranked[2].name)
+	}
+}
+
+func TestMergeResults(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous repoResult
+		found    repoResult
+		want     repoResult
+	}{
+		{name: "new", found: repoResult{name: "a/one", used: true, stars: 3}, want: repoResult{name: "a/one", used: true, stars: 3}},
+		{name: "upgraded", previous: repoResult{name: "a/one", stars: 3}, found: repoResult{name: "a/one", used: true, stars: 3, version: "v1.0.0"}, want: repoResult{name: "a/one", used: true, stars: 3, version: "v1.0.0"}},
+		{name: "replaced", previous: repoResult{name: "a/one", used: true, stars: 3, version: "v1.0.0"}, found: repoResult{name: "a/one", used: true, stars: 4, version: "v1.1.0"}, want: repoResult{name: "a/one", used: true, stars: 4, version: "v1.1.0"}},
+		{name: "not downgraded", previous: repoResult{name: "a/one", used: true, stars: 3, version: "v1.0.0"}, found: repoResult{name: "a/one", stars: 4}, want: repoResult{name: "a/one", used: true, stars: 3, version: "v1.0.0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := map[string]repoResult{"b/other": {name: "b/other", used: true}}
+			if tt.previous.name != "" {
+				results[tt.previous.name] = tt.previous
+			}
+			mergeResults(results, map[string]repoResult{tt.found.name: tt.found})
+			if got := results[tt.want.name]; got.used != tt.want.used || got.stars != tt.want.stars || got.version != tt.want.version {
+				t.Errorf("merged as %+v, want %+v", got, tt.want)
+			}
+			if _, ok := results["b/other"]; !ok {
+				t.Error("b/other, not on the page, dropped")
+			}
+		})
+	}
+}
+
+func TestMaxGoModBytes(t *testing.T) {
+	// large is a go.mod requiring the package, padded over the limit
+	large := goModRequiring("v1.0.0") + strings.Repeat("// padding\n", 50)
+	tests := []struct {
+		name          string
+		files         map[string]string
+		downloads     map[string]string
+		maxBytes      int64
+		wantUsed      bool
+		wantState     string
+		wantDownloads int
+	}{
+		{name: "within limit", files: map[string]string{"go.mod": goModRequiring("v1.0.0")}, maxBytes: 200, wantUsed: true, wantDownloads: 1},
+		{name: "no limit", files: map[string]string{"go.mod": large}, wantUsed: true, wantDownloads: 1},
+		{name: "listed over limit", files: map[string]string{"go.mod": large}, maxBytes: 200, wantState: stateOversizedGoMod},
+		{name: "downloaded over limit", files: map[string]string{"go.mod": goModRequiring("v1.0.0")}, downloads: map[string]string{"a/r/go.mod": large}, maxBytes: 200, wantState: stateOversizedGoMod, wantDownloads: 1},
+		{name: "used by another go.mod", files: map[string]string{"go.mod": large, "tools/go.mod": goModRequiring("v1.0.0")}, maxBytes: 200, wantUsed: true, wantDownloads: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeGitHub{repos: map[string]map[string]string{"a/r": tt.files}, downloads: tt.downloads}
+			s := newFakeSearch(t, f, "github.com/x/lib")
+			s.maxGoModBytes = tt.maxBytes
+
+			results, err := s.searchInRepositories(context.Background(), []candidate{fakeCandidate("a/r", 1)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := results["a/r"]
+			if got.used != tt.wantUsed || got.state != tt.wantState {
+				t.Errorf("used: %v in state %q, want %v in state %q", got.used, got.state, tt.wantUsed, tt.wantState)
+			}
+			// a go.mod listed over the limit isn't downloaded
+			if n := f.requested("/raw/"); n != tt.wantDownloads {
+				t.Errorf("%d downloads, want %d", n, tt.wantDownloads)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/google/go-github/v63/github"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// runInit is the `pkgstats init` command. It checks that a run can work:
+// a token is found and accepted by the API, the cache directory is writable
+// and a tiny search succeeds, then prints the commands to go on with.
+func runInit(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	var (
+		token    string
+		pkg      string
+		cacheDir string
+		smoke    bool
+	)
+	fs.StringVar(&token, "token", "", "GitHub access token, $GITHUB_TOKEN or the gh CLI token by default")
+	fs.StringVar(&pkg, "pkg", "github.com/stretchr/testify", "package to run the smoke scan for")
+	fs.StringVar(&cacheDir, "cache-dir", paths.state, "directory to create for the caches")
+	fs.BoolVar(&smoke, "smoke", true, "run a smoke scan of two repositories")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	token, source := findToken(token)
+	if token == "" {
+		return fmt.Errorf("no GitHub token found, pass -token, set GITHUB_TOKEN or log in with `gh auth login`")
+	}
+	logf("token: found in %s\n", source)
+
+	return initialize(ctx, newClient(ctx, token, rateLimits{}), pkg, cacheDir, smoke)
+}
+
+// initialize validates the token of the client, shows its rate limits,
+// creates the cache directory and runs the smoke scan.
+func initialize(ctx context.Context, client *github.Client, pkg, cacheDir string, smoke bool) error {
+	user, _, err := client.Users.Get(ctx, "")
+	if err != nil {
+		return fmt.Errorf("error validating the token: %v", withRequestID(err))
+	}
+	logf("token: valid, authenticated as %s\n", user.GetLogin())
+
+	limits, _, err := client.RateLimit.Get(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading the rate limits: %v", withRequestID(err))
+	}
+	logRateLimit("core", limits.GetCore())
+	logRateLimit("search", limits.GetSearch())
+	logRateLimit("code search", limits.GetCodeSearch())
+
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return fmt.Errorf("error creating cache directory: %v", err)
+	}
+	if err := checkWritable(cacheDir); err != nil {
+		return fmt.Errorf("error checking the cache directory: %v", err)
+	}
+	logf("cache directory: %s is writable\n", cacheDir)
+
+	if smoke {
+		s := newSearchResult(pkg, client, make(map[string]repoResult))
+		s.maxPages = 1
+		s.searchDelay = time.Second
+		results, err := s.Search(ctx, "language:go stars:>1000", &github.SearchOptions{
+			ListOptions: github.ListOptions{PerPage: 2},
+		})
+		if err != nil {
+			return fmt.Errorf("error in the smoke scan: %v", err)
+		}
+		logf("smoke scan: checked %d repositories for %s\n", len(results), pkg)
+	}
+
+	logln("pkgstats is ready, next steps:")
+	logf("  go run . -pkg %s -token \"$GITHUB_TOKEN\" -max-pages 1\n", pkg)
+	logf("  go run . -pkg %s -token \"$GITHUB_TOKEN\" -output table\n", pkg)
+	return nil
+}
+
+// findToken returns the token and where it was found: the flag, the
+// GITHUB_TOKEN environment variable or the gh CLI.
+func findToken(flagToken string) (string, string) {
+	if flagToken != "" {
+		return flagToken, "-token"
+	}
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		return token, "GITHUB_TOKEN"
+	}
+	out, err := exec.Command("gh", "auth", "token").Output()
+	if err == nil && strings.TrimSpace(string(out)) != "" {
+		return strings.TrimSpace(string(out)), "gh auth token"
+	}
+	return "", ""
+}
+
+func logRateLimit(name string, rate *github.Rate) {
+	if rate == nil {
+		return
+	}
+	logf("rate limit %s: %d of %d remaining, resets at %s\n", name, rate.Remaining, rate.Limit, rate.Reset.Format(time.TimeOnly))
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"github.com/google/go-github/v63/github"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInitialize(t *testing.T) {
+	tests := []struct {
+		name         string
+		login        string
+		smoke        bool
+		wantErr      string
+		wantSearches int
+		wantCacheDir bool
+		// blocked puts a file where the cache directory goes
+		blocked bool
+	}{
+		{name: "ready", login: "octocat", wantCacheDir: true},
+		{name: "smoke scan", login: "octocat", smoke: true, wantSearches: 1, wantCacheDir: true},
+		{name: "bad token", wantErr: "error validating the token"},
+		{name: "cache directory blocked", login: "octocat", smoke: true, blocked: true, wantErr: "error creating cache directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeGitHub{
+				repos:   map[string]map[string]string{"a/app": {"go.mod": goModRequiring("v1.0.0")}},
+				listing: []*github.Repository{fakeRepository("a/app", 2000)},
+				login:   tt.login,
+			}
+			cacheDir := filepath.Join(t.TempDir(), "state", "pkgstats")
+			if tt.blocked {
+				if err := os.MkdirAll(filepath.Dir(cacheDir), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(cacheDir, nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := initialize(context.Background(), f.client(t), "github.com/x/lib", cacheDir, tt.smoke)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if n := f.requested("/search/repositories"); n != tt.wantSearches {
+				t.Errorf("%d repository searches, want %d", n, tt.wantSearches)
+			}
+			if info, err := os.Stat(cacheDir); (err == nil && info.IsDir()) != tt.wantCacheDir {
+				t.Errorf("cache directory created: %v, want %v", err == nil && info.IsDir(), tt.wantCacheDir)
+			}
+		})
+	}
+}
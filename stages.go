@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/google/go-github/v63/github"
+	"github.com/samber/lo"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// candidateRecord is a candidate in the file written by `pkgstats
+// enumerate` and read by `pkgstats inspect`.
+type candidateRecord struct {
+	ID            int64     `json:"id"`
+	Name          string    `json:"name"`
+	Owner         string    `json:"owner"`
+	Repo          string    `json:"repo"`
+	Stars         int       `json:"stars"`
+	SizeKB        int       `json:"size_kb"`
+	Forks         int       `json:"forks"`
+	PushedAt      time.Time `json:"pushed_at"`
+	CreatedAt     time.Time `json:"created_at"`
+	Archived      bool      `json:"archived"`
+	Disabled      bool      `json:"disabled"`
+	Fork          bool      `json:"fork"`
+	Description   string    `json:"description,omitempty"`
+	MirrorURL     string    `json:"mirror_url,omitempty"`
+	DefaultBranch string    `json:"default_branch,omitempty"`
+}
+
+func newCandidateRecord(c candidate) candidateRecord {
+	return candidateRecord{
+		ID:            c.id,
+		Name:          c.name,
+		Owner:         c.owner,
+		Repo:          c.repo,
+		Stars:         c.stars,
+		SizeKB:        c.sizeKB,
+		Forks:         c.forks,
+		PushedAt:      c.pushedAt,
+		CreatedAt:     c.createdAt,
+		Archived:      c.archived,
+		Disabled:      c.disabled,
+		Fork:          c.fork,
+		Description:   c.description,
+		MirrorURL:     c.mirrorURL,
+		DefaultBranch: c.defaultBranch,
+	}
+}
+
+func (r candidateRecord) candidate() candidate {
+	return candidate{
+		id:            r.ID,
+		name:          r.Name,
+		owner:         r.Owner,
+		repo:          r.Repo,
+		stars:         r.Stars,
+		sizeKB:        r.SizeKB,
+		forks:         r.Forks,
+		pushedAt:      r.PushedAt,
+		createdAt:     r.CreatedAt,
+		archived:      r.Archived,
+		disabled:      r.Disabled,
+		fork:          r.Fork,
+		description:   r.Description,
+		mirrorURL:     r.MirrorURL,
+		defaultBranch: r.DefaultBranch,
+	}
+}
+
+// writeCandidates writes the candidates as a JSON array sorted by
+// repository ID.
+func writeCandidates(w io.Writer, candidates []candidate) error {
+	records := lo.Map(candidates, func(c candidate, _ int) candidateRecord { return newCandidateRecord(c) })
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(records)
+}
+
+// readCandidates reads a file written by `pkgstats enumerate`.
+func readCandidates(fileName string) ([]candidate, error) {
+	bb, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the candidates: %v", err)
+	}
+	var records []candidateRecord
+	if err := json.Unmarshal(bb, &records); err != nil {
+		return nil, fmt.Errorf("error parsing the candidates of %s: %v", fileName, err)
+	}
+	return lo.Map(records, func(r candidateRecord, _ int) candidate { return r.candidate() }), nil
+}
+
+// shard is the part k of n of the candidates a `pkgstats inspect` run
+// inspects, the zero shard is all of them.
+type shard struct {
+	k, n int
+}
+
+// parseShard parses a k/n shard, 1 <= k <= n.
+func parseShard(spec string) (shard, error) {
+	if spec == "" {
+		return shard{}, nil
+	}
+	kStr, nStr, ok := strings.Cut(spec, "/")
+	k, kErr := strconv.Atoi(kStr)
+	n, nErr := strconv.Atoi(nStr)
+	if !ok || kErr != nil || nErr != nil || n < 1 || k < 1 || k > n {
+		return shard{}, fmt.Errorf("%q is not k/n with 1 <= k <= n", spec)
+	}
+	return shard{k: k, n: n}, nil
+}
+
+// contains reports whether the candidate belongs to the shard. Candidates are
+// split by repository ID, which doesn't change with renames or star counts,
+// so the shards of the same file never overlap.
+func (s shard) contains(c candidate) bool {
+	return s.n == 0 || c.id%int64(s.n) == int64(s.k-1)
+}
+
+// shardResults returns the results of the candidates of a shard, dropping
+// the rows of other shards a cache file may hold.
+func shardResults(results map[string]repoResult, selected []candidate) map[string]repoResult {
+	kept := make(map[string]repoResult)
+	for _, c := range selected {
+		if r, ok := results[c.name]; ok {
+			kept[c.name] = r
+		}
+	}
+	return kept
+}
+
+// enumerateCandidates lists the candidates of the repository search, every
+// page of it up to maxPages, 0 for no limit.
+func (s *searchResult) enumerateCandidates(ctx context.Context, query string, maxPages int) ([]candidate, error) {
+	opts := &github.SearchOptions{
+		Sort:        "stars",
+		Order:       "desc",
+		ListOptions: github.ListOptions{PerPage: maxPerPage},
+	}
+	var candidates []candidate
+	for pages := 1; ; pages++ {
+		page, err := s.listRepositories(ctx, query, opts)
+		if err != nil {
+			return candidates, fmt.Errorf("error searching repositories: %v", withRequestID(err))
+		}
+		if pages == 1 && page.repos.GetTotal() > searchResultCap {
+			logf("Query %q matches %d repositories, only the first %d can be listed\n", query, page.repos.GetTotal(), searchResultCap)
+		}
+		candidates = append(candidates, candidatesFromSearch(page.repos)...)
+		if page.nextPage == 0 || (maxPages > 0 && pages >= maxPages) {
+			return candidates, nil
+		}
+		if err := sleepWithContext(ctx, s.paginationDelay); err != nil {
+			return candidates, err
+		}
+		opts.Page = page.nextPage
+	}
+}
+
+// runEnumerate is the `pkgstats enumerate` command: it lists the candidate
+// repositories of a search to a file, for `pkgstats inspect` to check later.
+func runEnumerate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("enumerate", flag.ContinueOnError)
+	var (
+		token    string
+		query    string
+		output   string
+		maxPages int
+	)
+	fs.StringVar(&token, "token", "", "GitHub access token, $GITHUB_TOKEN or the gh CLI token by default")
+	fs.StringVar(&query, "query", "language:go stars:>1000", "repository search listing the candidates")
+	fs.StringVar(&output, "o", "-", "file to write the candidates to, - for stdout")
+	fs.IntVar(&maxPages, "max-pages", 0, "maximum number of search pages, 0 for no limit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if maxPages < 0 {
+		return fmt.Errorf("invalid value for max-pages: %d", maxPages)
+	}
+	token, _ = findToken(token)
+	if token == "" {
+		return fmt.Errorf("no GitHub token found, pass -token, set GITHUB_TOKEN or log in with `gh auth login`")
+	}
+
+	s := newSearchResult("", newClient(ctx, token, rateLimits{}), nil)
+	candidates, err := s.enumerateCandidates(ctx, query, maxPages)
+	if err != nil {
+		return err
+	}
+	logf("found %d candidates for %q\n", len(candidates), query)
+
+	if output == "-" {
+		return writeCandidates(os.Stdout, candidates)
+	}
+	file, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("error creating the candidates file: %v", err)
+	}
+	defer file.Close()
+	if err := writeCandidates(file, candidates); err != nil {
+		return fmt.Errorf("error writing the candidates: %v", err)
+	}
+	return file.Close()
+}
+
+// runInspect is the `pkgstats inspect` command: it checks the candidates of
+// a `pkgstats enumerate` file, or a shard of them, for the package and merges
+// the results into a cache. The cache of a shard only keeps the rows of the
+// candidates of the shard, so the caches of the shards of a file hold
+// disjoint rows and concatenating them gives the cache of the whole file.
+func runInspect(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	var (
+		token      string
+		pkg        string
+		candidates string
+		shardSpec  string
+		fileName   string
+	)
+	fs.StringVar(&token, "token", "", "GitHub access token, $GITHUB_TOKEN or the gh CLI token by default")
+	fs.StringVar(&pkg, "pkg", "", "package to search for")
+	fs.StringVar(&candidates, "candidates", "", "candidates file written by pkgstats enumerate")
+	fs.StringVar(&shardSpec, "shard", "", "inspect only the part k/n of the candidates, e.g. 2/4, split by repository ID")
+	fs.StringVar(&fileName, "cache-file", "", "cache file to merge the results into instead of the one of -pkg")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if pkg == "" || candidates == "" {
+		return fmt.Errorf("inspect requires -pkg and -candidates")
+	}
+	sh, err := parseShard(shardSpec)
+	if err != nil {
+		return fmt.Errorf("invalid value for shard: %v", err)
+	}
+	if sh.n > 0 && fileName == "" {
+		return fmt.Errorf("inspect -shard requires -cache-file, the cache of a shard only holds the shard")
+	}
+	if fileName == "" {
+		fileName = defaultCacheFile(pkg)
+		if err := os.MkdirAll(paths.state, 0755); err != nil {
+			return fmt.Errorf("error creating cache directory: %v", err)
+		}
+	}
+	token, _ = findToken(token)
+	if token == "" {
+		return fmt.Errorf("no GitHub token found, pass -token, set GITHUB_TOKEN or log in with `gh auth login`")
+	}
+
+	all, err := readCandidates(candidates)
+	if err != nil {
+		return err
+	}
+	selected := lo.Filter(all, func(c candidate, _ int) bool { return sh.contains(c) })
+	if sh.n > 0 {
+		logf("shard %d/%d: %d of %d candidates\n", sh.k, sh.n, len(selected), len(all))
+	}
+
+	// the results of a run with -cache-log may still be in its log
+	store := &logStore{fileName: fileName}
+	results, err := store.load(ctx)
+	if err != nil {
+		return err
+	}
+	if sh.n > 0 {
+		results = shardResults(results, selected)
+	}
+	s := newSearchResult(pkg, newClient(ctx, token, rateLimits{}), results)
+	inspected, inspectErr := s.searchInRepositories(ctx, filterCandidates(selected))
+	for name, r := range inspected {
+		results[name] = r
+	}
+
+	sorted := lo.Values(results)
+	sortResults(sorted, "name")
+	if err := store.compact(sorted); err != nil {
+		return err
+	}
+	if inspectErr != nil {
+		return fmt.Errorf("error inspecting the candidates, saved %d results: %v", len(inspected), inspectErr)
+	}
+	logf("%s: inspected %d repositories\n", fileName, len(inspected))
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"github.com/samber/lo"
+	"slices"
+	"testing"
+)
+
+func TestShardResults(t *testing.T) {
+	candidates := []candidate{{id: 1, name: "a/one"}, {id: 2, name: "a/two"}, {id: 3, name: "a/three"}, {id: 4, name: "a/four"}}
+	results := map[string]repoResult{
+		"a/one":   {name: "a/one", used: true},
+		"a/two":   {name: "a/two"},
+		"a/three": {name: "a/three", used: true},
+		"b/gone":  {name: "b/gone", used: true},
+	}
+
+	var all []string
+	for k := 1; k <= 2; k++ {
+		sh := shard{k: k, n: 2}
+		selected := lo.Filter(candidates, func(c candidate, _ int) bool { return sh.contains(c) })
+		kept := lo.Keys(shardResults(results, selected))
+		for _, name := range kept {
+			if !slices.ContainsFunc(selected, func(c candidate) bool { return c.name == name }) {
+				t.Errorf("shard %d/2 keeps %s of another shard", k, name)
+			}
+		}
+		all = append(all, kept...)
+	}
+	slices.Sort(all)
+	if want := []string{"a/one", "a/three", "a/two"}; !slices.Equal(all, want) {
+		t.Errorf("shards keep %v, want %v once each", all, want)
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/samber/lo"
+	"io"
+	"os"
+	"time"
+)
+
+// cacheStore is where the results of a package are kept between runs.
+type cacheStore interface {
+	// load returns the stored results keyed by repository full name, none
+	// when nothing is stored yet.
+	load(ctx context.Context) (map[string]repoResult, error)
+	// save stores the results of a run, replacing the stored results.
+	save(ctx context.Context, results []repoResult) error
+}
+
+// resultAppender is a cacheStore that keeps results as soon as they are
+// found, so an interrupted run doesn't lose them.
+type resultAppender interface {
+	appendResult(result repoResult) error
+}
+
+// saveOrDump saves the results to the store. When that fails, the rows are
+// written to dump so the results of a long run aren't lost, and the error is
+// returned.
+func saveOrDump(ctx context.Context, store cacheStore, results []repoResult, dump io.Writer) error {
+	err := store.save(ctx, results)
+	if err == nil {
+		return nil
+	}
+	logf("error saving the cache, dumping the results: %v\n", err)
+	if err := writeResults(dump, results); err != nil {
+		logf("error dumping the results: %v\n", err)
+	}
+	return err
+}
+
+// fileStore keeps the results in a CSV cache file, rewritten by every run.
+type fileStore struct {
+	fileName string
+	// lock is the lock of the run on the cache, nil when it takes none
+	lock *cacheLock
+}
+
+func (s *fileStore) load(ctx context.Context) (map[string]repoResult, error) {
+	file, err := os.Open(s.fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return make(map[string]repoResult), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %v", err)
+	}
+	defer file.Close()
+
+	results, err := readResults(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %v", err)
+	}
+	return results, nil
+}
+
+func (s *fileStore) save(ctx context.Context, results []repoResult) error {
+	if err := s.lock.check(); err != nil {
+		return err
+	}
+	return saveCache(s.fileName, results)
+}
+
+// logStore keeps the results in a snapshot, the CSV cache file, and a log
+// of the results changed since, appended to as they are found. The log is
+// compacted into the snapshot once it grows over maxBytes or the snapshot
+// gets older than maxAge, so a long run doesn't rewrite the whole cache
+// for every change.
+type logStore struct {
+	fileName string
+	// maxBytes is the log size over which it is compacted, 0 for no limit
+	maxBytes int64
+	// maxAge is the snapshot age over which the log is compacted, 0 for no
+	// limit
+	maxAge time.Duration
+	// rows are the last stored CSV rows by repository, a result is only
+	// appended when its row changed
+	rows map[string]string
+	// lock is the lock of the run on the cache, nil when it takes none
+	lock *cacheLock
+}
+
+// cacheLogFile returns the log of the results of a cache file.
+func cacheLogFile(cacheFile string) string {
+	return trimCacheExt(cacheFile) + ".log"
+}
+
+func (s *logStore) load(ctx context.Context) (map[string]repoResult, error) {
+	results, err := (&fileStore{fileName: s.fileName}).load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	replayed, complete, err := replayLog(cacheLogFile(s.fileName), results)
+	if err != nil {
+		return nil, err
+	}
+	if replayed > 0 {
+		logf("replayed %d results from the log: %s\n", replayed, cacheLogFile(s.fileName))
+	}
+
+	s.rows = make(map[string]string, len(results))
+	for name, result := range results {
+		row, err := cacheRow(result)
+		if err != nil {
+			return nil, err
+		}
+		s.rows[name] = row
+	}
+
+	// rows appended after a torn one would never be read, start over from
+	// what was recovered
+	if !complete {
+		recovered := lo.Values(results)
+		sortResults(recovered, "name")
+		if err := s.compact(recovered); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// replayLog applies the results of a log to results, in the order they were
+// appended, and returns their number. A log ends with a torn row when a run
+// was killed while appending it, the rows up to it are kept and complete is
+// false.
+func replayLog(logFile string, results map[string]repoResult) (replayed int, complete bool, err error) {
+	file, err := os.Open(logFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, true, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("error opening the cache log: %v", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return replayed, true, nil
+		}
+		var line int
+		if err == nil {
+			var result repoResult
+			if result, err = parseRecord(record); err == nil {
+				results[result.name] = result
+				replayed++
+				continue
+			}
+			line, _ = reader.FieldPos(0)
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			line = parseErr.StartLine
+		}
+		logf("warning: ignoring the cache log %s from line %d: %v\n", logFile, line, err)
+		return replayed, false, nil
+	}
+}
+
+// appendResult appends a result to the log, synced to disk before it
+// returns, unless it is stored as it is already.
+func (s *logStore) appendResult(result repoResult) error {
+	row, err := cacheRow(result)
+	if err != nil {
+		return err
+	}
+	if stored, ok := s.rows[result.name]; ok && stored == row {
+		return nil
+	}
+	if err := s.lock.check(); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(cacheLogFile(s.fileName), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening the cache log: %v", err)
+	}
+	if _, err := io.WriteString(file, row); err != nil {
+		file.Close()
+		return fmt.Errorf("error appending to the cache log: %v", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("error syncing the cache log: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error closing the cache log: %v", err)
+	}
+
+	if s.rows == nil {
+		s.rows = make(map[string]string)
+	}
+	s.rows[result.name] = row
+	return nil
+}
+
+func (s *logStore) save(ctx context.Context, results []repoResult) error {
+	due, err := s.compactionDue()
+	if err != nil {
+		return err
+	}
+	// a log can only add results, one dropped needs a new snapshot
+	kept := lo.SliceToMap(results, func(result repoResult) (string, bool) { return result.name, true })
+	dropped := lo.SomeBy(lo.Keys(s.rows), func(name string) bool { return !kept[name] })
+	if due || dropped {
+		return s.compact(results)
+	}
+	for _, result := range results {
+		if err := s.appendResult(result); err != nil {
+			return err
+		}
+	}
+	logf("appended to the cache log: %s\n", cacheLogFile(s.fileName))
+	return nil
+}
+
+// compactionDue reports whether the log is over maxBytes or the snapshot
+// older than maxAge. A missing snapshot is always due.
+func (s *logStore) compactionDue() (bool, error) {
+	snapshot, err := os.Stat(s.fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error checking the cache: %v", err)
+	}
+	if s.maxAge > 0 && time.Since(snapshot.ModTime()) > s.maxAge {
+		return true, nil
+	}
+
+	log, err := os.Stat(cacheLogFile(s.fileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error checking the cache log: %v", err)
+	}
+	return s.maxBytes > 0 && log.Size() > s.maxBytes, nil
+}
+
+// compact writes the results to the snapshot and removes the log. A run
+// killed in between replays a log the snapshot already holds, which changes
+// nothing.
+func (s *logStore) compact(results []repoResult) error {
+	if err := s.lock.check(); err != nil {
+		return err
+	}
+	if err := saveCache(s.fileName, results); err != nil {
+		return err
+	}
+	if err := os.Remove(cacheLogFile(s.fileName)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error removing the compacted cache log: %v", err)
+	}
+	s.rows = make(map[string]string, len(results))
+	for _, result := range results {
+		row, err := cacheRow(result)
+		if err != nil {
+			return err
+		}
+		s.rows[result.name] = row
+	}
+	return nil
+}
+
+// cacheRow returns the CSV cache row of a result, with its line break.
+func cacheRow(result repoResult) (string, error) {
+	var buf bytes.Buffer
+	if err := writeResults(&buf, []repoResult{result}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
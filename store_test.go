@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLogStoreAppend(t *testing.T) {
+	ctx := context.Background()
+	fileName := filepath.Join(t.TempDir(), "pkg.csv")
+	if err := (&fileStore{fileName: fileName}).save(ctx, []repoResult{{name: "a/one", stars: 10}}); err != nil {
+		t.Fatal(err)
+	}
+
+	store := &logStore{fileName: fileName}
+	if _, err := store.load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range []repoResult{
+		{name: "a/one", stars: 10},
+		{name: "a/two", used: true, stars: 5, version: "v1.0.0"},
+		{name: "a/one", used: true, stars: 11, version: "v1.1.0"},
+	} {
+		if err := store.appendResult(result); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the unchanged a/one isn't appended
+	rows, err := (&fileStore{fileName: cacheLogFile(fileName)}).load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Errorf("%d rows in the log, want 2", len(rows))
+	}
+
+	results, err := (&logStore{fileName: fileName}).load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := results["a/one"]; !got.used || got.version != "v1.1.0" {
+		t.Errorf("a/one replayed as %+v, want the last appended row", got)
+	}
+	if _, ok := results["a/two"]; !ok {
+		t.Error("a/two not replayed")
+	}
+}
+
+func TestLogStoreCompaction(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxBytes    int64
+		maxAge      time.Duration
+		snapshotAge time.Duration
+		results     []repoResult
+		wantLog     bool
+	}{
+		{name: "within limits", maxBytes: 1 << 20, maxAge: time.Hour, results: []repoResult{{name: "a/one", stars: 10}, {name: "a/two", stars: 3}}, wantLog: true},
+		{name: "no limits", results: []repoResult{{name: "a/one", stars: 10}, {name: "a/two", stars: 3}}, wantLog: true},
+		{name: "log too large", maxBytes: 1, results: []repoResult{{name: "a/one", stars: 10}, {name: "a/two", stars: 3}}},
+		{name: "snapshot too old", maxAge: time.Hour, snapshotAge: 2 * time.Hour, results: []repoResult{{name: "a/one", stars: 10}, {name: "a/two", stars: 3}}},
+		{name: "result dropped", results: []repoResult{{name: "a/two", stars: 3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			fileName := filepath.Join(t.TempDir(), "pkg.csv")
+			if err := (&fileStore{fileName: fileName}).save(ctx, []repoResult{{name: "a/one", stars: 10}}); err != nil {
+				t.Fatal(err)
+			}
+			modTime := time.Now().Add(-tt.snapshotAge)
+			if err := os.Chtimes(fileName, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+
+			store := &logStore{fileName: fileName, maxBytes: tt.maxBytes, maxAge: tt.maxAge}
+			if _, err := store.load(ctx); err != nil {
+				t.Fatal(err)
+			}
+			// a first append so the size limit has a log to measure
+			if err := store.appendResult(repoResult{name: "a/one", stars: 12}); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.save(ctx, tt.results); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := os.Stat(cacheLogFile(fileName))
+			if hasLog := err == nil; hasLog != tt.wantLog {
+				t.Errorf("log kept: %v, want %v", hasLog, tt.wantLog)
+			}
+			if !tt.wantLog {
+				snapshot, err := (&fileStore{fileName: fileName}).load(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(snapshot) != len(tt.results) {
+					t.Errorf("%d results in the snapshot, want %d", len(snapshot), len(tt.results))
+				}
+			}
+
+			results, err := (&logStore{fileName: fileName}).load(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != len(tt.results) {
+				t.Errorf("%d results loaded, want %d", len(results), len(tt.results))
+			}
+			for _, want := range tt.results {
+				if got := results[want.name]; got.stars != want.stars {
+					t.Errorf("%s loaded with %d stars, want %d", want.name, got.stars, want.stars)
+				}
+			}
+		})
+	}
+}
+
+func TestLogStoreRecovery(t *testing.T) {
+	tests := []struct {
+		name      string
+		snapshot  string
+		log       string
+		want      map[string]int
+		wantClean bool
+	}{
+		{name: "log only", log: "a/one,true,10\n", want: map[string]int{"a/one": 10}, wantClean: true},
+		{name: "snapshot and log", snapshot: "a/one,false,10\na/two,false,4\n", log: "a/one,true,11\n", want: map[string]int{"a/one": 11, "a/two": 4}, wantClean: true},
+		{name: "torn row", snapshot: "a/one,false,10\n", log: "a/two,true,4\n\"a/three,tr", want: map[string]int{"a/one": 10, "a/two": 4}},
+		{name: "bad row", snapshot: "a/one,false,10\n", log: "a/two,true,many\na/three,true,1\n", want: map[string]int{"a/one": 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), "pkg.csv")
+			if tt.snapshot != "" {
+				if err := os.WriteFile(fileName, []byte(tt.snapshot), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.WriteFile(cacheLogFile(fileName), []byte(tt.log), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			results, err := (&logStore{fileName: fileName}).load(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != len(tt.want) {
+				t.Errorf("%d results recovered, want %d", len(results), len(tt.want))
+			}
+			for name, stars := range tt.want {
+				if got, ok := results[name]; !ok || got.stars != stars {
+					t.Errorf("%s recovered as %+v, want %d stars", name, got, stars)
+				}
+			}
+
+			// a torn log is compacted away, so rows appended next are read
+			_, err = os.Stat(cacheLogFile(fileName))
+			if hasLog := err == nil; hasLog != tt.wantClean {
+				t.Errorf("log kept: %v, want %v", hasLog, tt.wantClean)
+			}
+		})
+	}
+}
+
+func TestSaveOrDump(t *testing.T) {
+	results := []repoResult{{name: "a/one", used: true, stars: 10, version: "v1.0.0"}}
+	tests := []struct {
+		name     string
+		store    cacheStore
+		dump     *failingWriter
+		wantErr  bool
+		wantDump bool
+	}{
+		{name: "saved", store: &fileStore{fileName: filepath.Join(t.TempDir(), "pkg.csv")}},
+		{name: "missing directory", store: &fileStore{fileName: filepath.Join(t.TempDir(), "missing", "pkg.csv")}, wantErr: true, wantDump: true},
+		{name: "failing bucket", store: &remoteStore{objects: &fakeObjects{err: errDiskFull}, key: "pkg.csv"}, wantErr: true, wantDump: true},
+		{name: "failing dump", store: &remoteStore{objects: &fakeObjects{err: errDiskFull}, key: "pkg.csv"}, dump: &failingWriter{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dump bytes.Buffer
+			var w io.Writer = &dump
+			if tt.dump != nil {
+				w = tt.dump
+			}
+			err := saveOrDump(context.Background(), tt.store, results, w)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want one: %v", err, tt.wantErr)
+			}
+			dumped, err := readResults(&dump)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(dumped) == 1; got != tt.wantDump {
+				t.Errorf("results dumped: %v, want %v", got, tt.wantDump)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"github.com/samber/lo"
+	"sort"
+	"strings"
+)
+
+// summary holds the aggregate numbers of a run.
+type summary struct {
+	repositories int
+	// adopters and the numbers about them only count high-confidence
+	// results, byConfidence counts the adopters of every level
+	adopters      int
+	byConfidence  map[string]int
+	lowConfidence int
+	anomalies     int
+	forks         int
+	mirrors       int
+	partialScans  int
+	oversized     int
+	slow          int
+	staleIndirect int
+	// vendorChecked adopters were checked for vendoring, vendored of them
+	// vendor the package
+	vendorChecked int
+	vendored      int
+	// goSumChecked adopters had their go.sum read, goSumMismatches of them
+	// lock none of the required version
+	goSumChecked    int
+	goSumMismatches int
+	// testUsageChecked adopters were classified by -classify-test-usage,
+	// testOnly of them only import the package in tests and are left out of
+	// adopters unless testOnlyCounted
+	testUsageChecked int
+	testOnly         int
+	testOnlyCounted  bool
+	// reach is the total number of stars of the adopters
+	reach int
+	// sizeTiers counts the adopters per size tier label
+	sizeTiers map[string]int
+	// byModule counts the adopters per required module
+	byModule map[string]int
+	// byHosting counts the adopters per hosting, the ones classified
+	byHosting map[string]int
+	// atMinVersion adopters require minVersion or later
+	minVersion   string
+	atMinVersion int
+}
+
+// sizeTiers group repositories by their size, the first matching tier wins.
+var sizeTiers = []struct {
+	label string
+	minKB int
+}{
+	{label: ">1GB", minKB: 1 << 20},
+	{label: "100MB-1GB", minKB: 100 << 10},
+	{label: "10-100MB", minKB: 10 << 10},
+	{label: "1-10MB", minKB: 1 << 10},
+	{label: "<1MB", minKB: 1},
+	{label: "unknown", minKB: 0},
+}
+
+// sizeTier returns the label of the size tier of a repository.
+func sizeTier(sizeKB int) string {
+	for _, tier := range sizeTiers {
+		if sizeKB >= tier.minKB {
+			return tier.label
+		}
+	}
+	return "unknown"
+}
+
+// testOnlyExcluded reports whether a result is left out of the adopters of
+// the summaries for only using the package in tests, which
+// -include-test-only turns off.
+func (r repoResult) testOnlyExcluded() bool {
+	return r.testUsageChecked && r.testOnly && !r.countTestOnly
+}
+
+// isAdopter reports whether a result counts as an adopter in the summaries:
+// a high-confidence use of the package, not only in tests.
+func (r repoResult) isAdopter() bool {
+	return r.used && r.confidence == confidenceHigh && !r.testOnlyExcluded()
+}
+
+func summarize(results []repoResult) summary {
+	s := summary{byConfidence: make(map[string]int), byModule: make(map[string]int), byHosting: make(map[string]int), sizeTiers: make(map[string]int)}
+	for _, r := range results {
+		s.repositories++
+		if r.used && !r.testOnlyExcluded() {
+			s.byConfidence[r.confidence]++
+		}
+		// the classified adopters include the test-only ones, counted or not
+		if r.used && r.confidence == confidenceHigh && r.testUsageChecked {
+			s.testUsageChecked++
+			if r.testOnly {
+				s.testOnly++
+				s.testOnlyCounted = r.countTestOnly
+			}
+		}
+		if r.isAdopter() {
+			s.adopters++
+			s.reach += r.stars
+			if r.module != "" {
+				s.byModule[r.module]++
+			}
+			if r.hosting != "" {
+				s.byHosting[r.hosting]++
+			}
+			if r.minVersion != "" {
+				s.minVersion = r.minVersion
+				if r.meetsMinVersion() {
+					s.atMinVersion++
+				}
+			}
+			s.sizeTiers[sizeTier(r.sizeKB)]++
+			if r.fork != "" {
+				s.forks++
+			}
+			if r.staleIndirect {
+				s.staleIndirect++
+			}
+			if r.vendorChecked {
+				s.vendorChecked++
+				if r.vendored {
+					s.vendored++
+				}
+			}
+			if r.goSumChecked {
+				s.goSumChecked++
+				if r.goSumMismatch {
+					s.goSumMismatches++
+				}
+			}
+		}
+		if r.lowConfidence {
+			s.lowConfidence++
+		}
+		switch r.state {
+		case stateAnomaly:
+			s.anomalies++
+		case stateSkippedMirror:
+			s.mirrors++
+		case statePartialScan:
+			s.partialScans++
+		case stateOversizedGoMod:
+			s.oversized++
+		case stateSkippedSlow:
+			s.slow++
+		}
+	}
+	return s
+}
+
+func (s summary) print() {
+	logf("repositories: %d, adopters: %d, reach: %d, low-confidence results: %d, anomalies: %d\n",
+		s.repositories, s.adopters, s.reach, s.lowConfidence, s.anomalies)
+	var levels []string
+	for _, level := range confidenceLevels {
+		levels = append(levels, fmt.Sprintf("%s: %d", level, s.byConfidence[level]))
+	}
+	logf("adopters by confidence: %s\n", strings.Join(levels, ", "))
+	if len(s.byModule) > 1 {
+		modules := lo.Keys(s.byModule)
+		sort.Strings(modules)
+		var counts []string
+		for _, module := range modules {
+			counts = append(counts, fmt.Sprintf("%s: %d", module, s.byModule[module]))
+		}
+		logf("adopters by module: %s\n", strings.Join(counts, ", "))
+	}
+	if len(s.byHosting) > 0 {
+		var counts []string
+		for _, hosting := range hostings {
+			counts = append(counts, fmt.Sprintf("%s: %d", hosting, s.byHosting[hosting]))
+		}
+		logf("adopters by hosting: %s\n", strings.Join(counts, ", "))
+	}
+	if s.mirrors > 0 {
+		logf("skipped likely mirrors: %d\n", s.mirrors)
+	}
+	if s.partialScans > 0 {
+		logf("repositories with too many go.mod files, partially scanned: %d\n", s.partialScans)
+	}
+	if s.slow > 0 {
+		logf("repositories skipped as too slow to scan: %d\n", s.slow)
+	}
+	if s.oversized > 0 {
+		logf("repositories with an oversized go.mod, skipped: %d\n", s.oversized)
+	}
+	if s.staleIndirect > 0 {
+		logf("adopters importing the package with a stale // indirect requirement: %d\n", s.staleIndirect)
+	}
+	if s.forks > 0 {
+		logf("adopters using a fork: %d\n", s.forks)
+	}
+	if s.adopters > 0 {
+		var tiers []string
+		for _, tier := range sizeTiers {
+			if n := s.sizeTiers[tier.label]; n > 0 {
+				tiers = append(tiers, fmt.Sprintf("%s: %d", tier.label, n))
+			}
+		}
+		logf("adopters by size: %s\n", strings.Join(tiers, ", "))
+	}
+	if s.minVersion != "" {
+		logf("adopters on %s or later: %d of %d (%s)\n", s.minVersion, s.atMinVersion, s.adopters, formatPercent(s.atMinVersion, s.adopters))
+	}
+	if s.vendorChecked > 0 {
+		logf("vendored: %d of %d checked adopters (%s)\n", s.vendored, s.vendorChecked, formatPercent(s.vendored, s.vendorChecked))
+	}
+	if s.testUsageChecked > 0 {
+		counted := "not counted as adopters"
+		if s.testOnlyCounted {
+			counted = "counted as adopters"
+		}
+		logf("importing the package in tests only: %d of %d classified adopters, %s\n", s.testOnly, s.testUsageChecked, counted)
+	}
+	if s.goSumChecked > 0 {
+		logf("go.sum not locking the required version: %d of %d checked adopters\n", s.goSumMismatches, s.goSumChecked)
+	}
+}
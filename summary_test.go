@@ -0,0 +1,65 @@
+package main
+
+import "testing"
+
+func TestSummarizeTestOnly(t *testing.T) {
+	results := []repoResult{
+		{name: "a/prod", used: true, stars: 100, confidence: confidenceHigh, testUsageChecked: true},
+		{name: "a/tests", used: true, stars: 10, confidence: confidenceHigh, testUsageChecked: true, testOnly: true},
+		{name: "a/unclassified", used: true, stars: 1, confidence: confidenceHigh},
+		{name: "a/unused", stars: 1000, confidence: confidenceHigh},
+	}
+	tests := []struct {
+		name          string
+		countTestOnly bool
+		wantAdopters  int
+		wantReach     int
+	}{
+		{name: "default", wantAdopters: 2, wantReach: 101},
+		{name: "include-test-only", countTestOnly: true, wantAdopters: 3, wantReach: 111},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := append([]repoResult(nil), results...)
+			for i := range rows {
+				rows[i].countTestOnly = tt.countTestOnly
+			}
+			s := summarize(rows)
+			if s.adopters != tt.wantAdopters || s.reach != tt.wantReach {
+				t.Errorf("adopters %d, reach %d, want %d and %d", s.adopters, s.reach, tt.wantAdopters, tt.wantReach)
+			}
+			if s.testUsageChecked != 2 || s.testOnly != 1 {
+				t.Errorf("%d test-only of %d classified, want 1 of 2", s.testOnly, s.testUsageChecked)
+			}
+			if got := computeFunnel(rows, "v1.0.0").adopters; got != tt.wantAdopters {
+				t.Errorf("funnel adopters %d, want %d", got, tt.wantAdopters)
+			}
+		})
+	}
+}
+
+func TestSummarizeSizeTiers(t *testing.T) {
+	results := []repoResult{
+		{name: "a/unknown", used: true, confidence: confidenceHigh},
+		{name: "a/tiny", used: true, sizeKB: 1, confidence: confidenceHigh},
+		{name: "a/small", used: true, sizeKB: 1023, confidence: confidenceHigh},
+		{name: "a/medium", used: true, sizeKB: 1024, confidence: confidenceHigh},
+		{name: "a/large", used: true, sizeKB: 50 << 10, confidence: confidenceHigh},
+		{name: "a/larger", used: true, sizeKB: 100 << 10, confidence: confidenceHigh},
+		{name: "a/monorepo", used: true, sizeKB: 3 << 20, confidence: confidenceHigh},
+		// only adopters are counted
+		{name: "a/unused", sizeKB: 3 << 20, confidence: confidenceHigh},
+		{name: "a/unverified", used: true, sizeKB: 3 << 20, confidence: confidenceMedium},
+	}
+	want := map[string]int{"unknown": 1, "<1MB": 2, "1-10MB": 1, "10-100MB": 1, "100MB-1GB": 1, ">1GB": 1}
+
+	s := summarize(results)
+	if len(s.sizeTiers) != len(want) {
+		t.Errorf("size tiers %v, want %v", s.sizeTiers, want)
+	}
+	for tier, n := range want {
+		if s.sizeTiers[tier] != n {
+			t.Errorf("%d adopters in tier %s, want %d", s.sizeTiers[tier], tier, n)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/go-github/v63/github"
+	"strconv"
+	"strings"
+)
+
+// parseStarSweep parses a comma separated list of increasing positive star
+// counts, the lower bounds of the star bands.
+func parseStarSweep(spec string) ([]int, error) {
+	var bounds []int
+	for _, part := range strings.Split(spec, ",") {
+		bound, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || bound <= 0 {
+			return nil, fmt.Errorf("invalid star-sweep bound %q: must be a positive integer", part)
+		}
+		if len(bounds) > 0 && bound <= bounds[len(bounds)-1] {
+			return nil, fmt.Errorf("invalid star-sweep bound %d: bounds must be increasing", bound)
+		}
+		bounds = append(bounds, bound)
+	}
+	return bounds, nil
+}
+
+// starsQualifier returns the star qualifier of the repository search for at
+// least atLeast stars and at most atMost, 0 for no maximum. Both bounds are
+// inclusive, like the bands of starBands.
+func starsQualifier(atLeast, atMost int) string {
+	if atMost == 0 {
+		return fmt.Sprintf("stars:>=%d", atLeast)
+	}
+	return fmt.Sprintf("stars:%d..%d", atLeast, atMost)
+}
+
+// starBands turns the bounds into star qualifiers, from the most starred band
+// down, e.g. 1000,5000 gives "stars:>=5000" and "stars:1000..4999".
+func starBands(bounds []int) []string {
+	bands := make([]string, 0, len(bounds))
+	for i := len(bounds) - 1; i >= 0; i-- {
+		if i == len(bounds)-1 {
+			bands = append(bands, fmt.Sprintf("stars:>=%d", bounds[i]))
+			continue
+		}
+		bands = append(bands, fmt.Sprintf("stars:%d..%d", bounds[i], bounds[i+1]-1))
+	}
+	return bands
+}
+
+// SearchSweep runs the search once per star band, most starred band first,
+// so an interrupted run has covered the most prominent repositories. It
+// sleeps s.bandDelay between two bands.
+func (s *searchResult) SearchSweep(ctx context.Context, baseQuery string, bands []string, opts *github.SearchOptions) (map[string]repoResult, error) {
+	results := make(map[string]repoResult)
+
+	for i, band := range bands {
+		if ctx.Err() != nil {
+			break
+		}
+
+		if i > 0 && s.bandDelay > 0 {
+			logf("Sleeping for %s before star band %d/%d\n", s.bandDelay, i+1, len(bands))
+			stop := s.timings.track(phaseSleep, "before "+band)
+			err := sleepWithContext(ctx, s.bandDelay)
+			stop()
+			if err != nil {
+				logf("Sleep was interrupted: %v\n", err)
+				break
+			}
+		}
+
+		logf("Searching star band %d/%d: %s\n", i+1, len(bands), band)
+		opts.Page = 0
+		bandResults, err := s.Search(ctx, baseQuery+" "+band, opts)
+		mergeResults(results, bandResults)
+		logf("Finished star band %d/%d: %s, %d repositories checked\n", i+1, len(bands), band, len(bandResults))
+		if err != nil {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"github.com/google/go-github/v63/github"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStarsQualifier(t *testing.T) {
+	tests := []struct {
+		atLeast, atMost int
+		want            string
+	}{
+		{atLeast: 1001, want: "stars:>=1001"},
+		{atLeast: 0, want: "stars:>=0"},
+		{atLeast: 100, atMost: 1000, want: "stars:100..1000"},
+		{atLeast: 5, atMost: 5, want: "stars:5..5"},
+	}
+	for _, tt := range tests {
+		if got := starsQualifier(tt.atLeast, tt.atMost); got != tt.want {
+			t.Errorf("starsQualifier(%d, %d) = %s, want %s", tt.atLeast, tt.atMost, got, tt.want)
+		}
+	}
+}
+
+func TestStarBands(t *testing.T) {
+	tests := []struct {
+		sweep string
+		want  []string
+	}{
+		{sweep: "1000", want: []string{"stars:>=1000"}},
+		{sweep: "1000,5000,20000", want: []string{"stars:>=20000", "stars:5000..19999", "stars:1000..4999"}},
+	}
+	for _, tt := range tests {
+		bounds, err := parseStarSweep(tt.sweep)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := starBands(bounds); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.sweep, got, tt.want)
+		}
+	}
+}
+
+func TestSearchSweepDelay(t *testing.T) {
+	bands := starBands([]int{10, 100, 1000})
+	tests := []struct {
+		name  string
+		delay time.Duration
+	}{
+		{name: "no delay"},
+		{name: "delay", delay: 30 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeGitHub{repos: map[string]map[string]string{"a/one": {"go.mod": goModRequiring("v1.0.0")}}, listing: []*github.Repository{fakeRepository("a/one", 500)}}
+			s := newFakeSearch(t, f, "github.com/x/lib")
+			s.bandDelay = tt.delay
+			results, err := s.SearchSweep(context.Background(), "language:go", bands, &github.SearchOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != 1 {
+				t.Errorf("results %v, want a/one", results)
+			}
+
+			// the measurements are in the order the phases ended: a listing
+			// of every band, and a pause before every band but the first
+			var order []string
+			for _, m := range s.timings.measurements {
+				switch m.phase {
+				case phaseRepoSearch:
+					order = append(order, "search")
+				case phaseSleep:
+					if !strings.HasPrefix(m.subject, "before stars:") {
+						// the pause after a repository
+						continue
+					}
+					order = append(order, "sleep")
+					if m.duration < tt.delay {
+						t.Errorf("slept %s %s, want %s", m.duration, m.subject, tt.delay)
+					}
+				}
+			}
+			want := "search,search,search"
+			if tt.delay > 0 {
+				want = "search,sleep,search,sleep,search"
+			}
+			if got := strings.Join(order, ","); got != want {
+				t.Errorf("phases %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestSearchSweepDelayCanceled(t *testing.T) {
+	f := &fakeGitHub{listing: []*github.Repository{}}
+	s := newFakeSearch(t, f, "github.com/x/lib")
+	s.bandDelay = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := s.SearchSweep(ctx, "language:go", starBands([]int{10, 100}), &github.SearchOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("canceled sweep returned after %s", elapsed)
+	}
+	if n := f.requested("/search/repositories"); n != 1 {
+		t.Errorf("%d bands listed, want the first one only", n)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/samber/lo"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Phases of a run that are timed, in the order they are summarized.
+const (
+	phaseRepoSearch = "repo-search"
+	phaseCodeSearch = "code-search"
+	phaseDownload   = "download"
+	phaseParse      = "parse"
+	phaseSleep      = "sleep"
+)
+
+var timingPhases = []string{phaseRepoSearch, phaseCodeSearch, phaseDownload, phaseParse, phaseSleep}
+
+// measurement is the duration of one phase for a page or a repository.
+type measurement struct {
+	phase    string
+	subject  string
+	start    time.Time
+	duration time.Duration
+}
+
+// timings collects the measurements of a run. It is cheap enough to be always
+// on: one slice append per API call or sleep.
+type timings struct {
+	mu           sync.Mutex
+	measurements []measurement
+	// spans also receives every measurement, nil without -otel-endpoint
+	spans spanSink
+}
+
+// track starts measuring a phase and returns the function that stops it.
+func (t *timings) track(phase, subject string) func() {
+	start := time.Now()
+	return func() {
+		duration := time.Since(start)
+		t.span(phase, start, duration, map[string]string{"subject": subject})
+
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.measurements = append(t.measurements, measurement{
+			phase:    phase,
+			subject:  subject,
+			start:    start,
+			duration: duration,
+		})
+	}
+}
+
+// percentile returns the p-th percentile of sorted durations, using the
+// nearest rank.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// print logs the count, total and percentiles of every phase that was
+// measured.
+func (t *timings) print() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	byPhase := make(map[string][]time.Duration)
+	for _, m := range t.measurements {
+		byPhase[m.phase] = append(byPhase[m.phase], m.duration)
+	}
+	for _, phase := range timingPhases {
+		durations := byPhase[phase]
+		if len(durations) == 0 {
+			continue
+		}
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		var total time.Duration
+		for _, d := range durations {
+			total += d
+		}
+		logf("%s: %d calls, total %s, p50 %s, p90 %s, p99 %s, max %s\n", phase, len(durations),
+			total.Round(time.Millisecond),
+			percentile(durations, 50).Round(time.Millisecond),
+			percentile(durations, 90).Round(time.Millisecond),
+			percentile(durations, 99).Round(time.Millisecond),
+			durations[len(durations)-1].Round(time.Millisecond))
+	}
+}
+
+// slowestCount is the number of repositories printSlowest lists.
+const slowestCount = 10
+
+// printSlowest logs the repositories whose last scan took the longest, the
+// candidates for -skip-slower-than.
+func printSlowest(results []repoResult) {
+	timed := lo.Filter(results, func(r repoResult, _ int) bool { return r.scanDuration > 0 })
+	if len(timed) == 0 {
+		return
+	}
+	sort.Slice(timed, func(i, j int) bool { return timed[i].scanDuration > timed[j].scanDuration })
+	logln("slowest repositories:")
+	for _, r := range timed[:min(len(timed), slowestCount)] {
+		logf("  %s: %s\n", r.name, r.scanDuration.Round(time.Millisecond))
+	}
+}
+
+// writeCSV writes the raw measurements with a header row.
+func (t *timings) writeCSV(w io.Writer) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"phase", "subject", "start", "duration_ms"}); err != nil {
+		return err
+	}
+	for _, m := range t.measurements {
+		err := writer.Write([]string{
+			m.phase,
+			m.subject,
+			m.start.UTC().Format(time.RFC3339Nano),
+			strconv.FormatFloat(float64(m.duration)/float64(time.Millisecond), 'f', 3, 64),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeTimingsFile writes the raw measurements to the file at path.
+func writeTimingsFile(path string, t *timings) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating the timings file: %v", err)
+	}
+	if err := t.writeCSV(f); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing the timings file: %v", err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// tracingShutdownTimeout bounds the export of the spans left at the end of
+// a run, canceled or not.
+const tracingShutdownTimeout = 10 * time.Second
+
+// spanSink receives the measured phases and the repository inspections of a
+// run as spans of one trace, see -otel-endpoint. Spans are recorded once
+// they are over, with their start time, so none is left open when a run is
+// canceled. startTracing returns the OpenTelemetry one in binaries built
+// with the otel tag.
+type spanSink interface {
+	span(name string, start time.Time, duration time.Duration, attrs map[string]string)
+	// shutdown ends the trace and exports what is left
+	shutdown(ctx context.Context) error
+}
+
+// span forwards a measurement to the span sink of the run, if any.
+func (t *timings) span(name string, start time.Time, duration time.Duration, attrs map[string]string) {
+	if t == nil || t.spans == nil {
+		return
+	}
+	t.spans.span(name, start, duration, attrs)
+}
+
+// shutdownTracing ends the trace of the run, even when ctx is canceled.
+func shutdownTracing(ctx context.Context, spans spanSink) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), tracingShutdownTimeout)
+	defer cancel()
+	if err := spans.shutdown(ctx); err != nil {
+		logf("error exporting the trace: %v\n", err)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !otel
+
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// startTracing fails, the default binary doesn't include the OpenTelemetry
+// SDK.
+func startTracing(ctx context.Context, endpoint, packageName string) (spanSink, error) {
+	return nil, errors.New("otel-endpoint requires a binary built with -tags otel")
+}
@@ -0,0 +1,57 @@
+//go:build otel
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+// otelSpans exports the spans of a run over OTLP/HTTP, as children of a
+// root span covering the whole run.
+type otelSpans struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+	root     trace.Span
+	rootCtx  context.Context
+}
+
+// startTracing starts the trace of the run, exported to the OTLP/HTTP
+// endpoint, e.g. http://localhost:4318.
+func startTracing(ctx context.Context, endpoint, packageName string) (spanSink, error) {
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("error creating the OTLP exporter: %v", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName("pkgstats"), semconv.ServiceVersion(toolVersion()))),
+	)
+	return newOtelSpans(provider, packageName), nil
+}
+
+func newOtelSpans(provider *sdktrace.TracerProvider, packageName string) *otelSpans {
+	tracer := provider.Tracer("github.com/xesina/pkgstats")
+	rootCtx, root := tracer.Start(context.Background(), "pkgstats", trace.WithAttributes(attribute.String("pkgstats.package", packageName)))
+	return &otelSpans{provider: provider, tracer: tracer, root: root, rootCtx: rootCtx}
+}
+
+func (o *otelSpans) span(name string, start time.Time, duration time.Duration, attrs map[string]string) {
+	_, span := o.tracer.Start(o.rootCtx, name, trace.WithTimestamp(start))
+	for key, value := range attrs {
+		span.SetAttributes(attribute.String("pkgstats."+key, value))
+	}
+	span.End(trace.WithTimestamp(start.Add(duration)))
+}
+
+func (o *otelSpans) shutdown(ctx context.Context) error {
+	o.root.End()
+	return o.provider.Shutdown(ctx)
+}
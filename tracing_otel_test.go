@@ -0,0 +1,93 @@
+//go:build otel
+
+package main
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+// spanAttr returns the value of a string attribute of a span.
+func spanAttr(span tracetest.SpanStub, key string) string {
+	for _, kv := range span.Attributes {
+		if kv.Key == attribute.Key(key) {
+			return kv.Value.AsString()
+		}
+	}
+	return ""
+}
+
+func TestOtelSpans(t *testing.T) {
+	tests := []struct {
+		name     string
+		canceled bool
+	}{
+		{name: "complete run"},
+		// the spans are still exported when the run was interrupted
+		{name: "canceled run", canceled: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// unlike the in-memory exporter, the recorder keeps the spans
+			// after the shutdown
+			recorder := tracetest.NewSpanRecorder()
+			spans := newOtelSpans(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)), "github.com/x/lib")
+
+			f := &fakeGitHub{repos: map[string]map[string]string{
+				"a/used":   {"go.mod": goModRequiring("v1.0.0")},
+				"a/unused": {"go.mod": "module example.com/unused\n"},
+			}}
+			s := newFakeSearch(t, f, "github.com/x/lib")
+			s.timings.spans = spans
+			ctx, cancel := context.WithCancel(context.Background())
+			if _, err := s.searchInRepositories(ctx, []candidate{fakeCandidate("a/used", 10), fakeCandidate("a/unused", 10)}); err != nil {
+				t.Fatal(err)
+			}
+			if tt.canceled {
+				cancel()
+			}
+			shutdownTracing(ctx, spans)
+			cancel()
+
+			stubs := tracetest.SpanStubsFromReadOnlySpans(recorder.Ended())
+			var root tracetest.SpanStub
+			byName := make(map[string][]tracetest.SpanStub)
+			for _, span := range stubs {
+				byName[span.Name] = append(byName[span.Name], span)
+				if span.Name == "pkgstats" {
+					root = span
+				}
+			}
+			if !root.SpanContext.IsValid() || spanAttr(root, "pkgstats.package") != "github.com/x/lib" {
+				t.Fatalf("no root span for the package in %d spans", len(stubs))
+			}
+			for _, span := range stubs {
+				if span.SpanContext.TraceID() != root.SpanContext.TraceID() {
+					t.Errorf("span %s in another trace", span.Name)
+				}
+				if span.Name != "pkgstats" && span.Parent.SpanID() != root.SpanContext.SpanID() {
+					t.Errorf("span %s is not a child of the root span", span.Name)
+				}
+				if span.EndTime.Before(span.StartTime) || span.EndTime.IsZero() {
+					t.Errorf("span %s not ended", span.Name)
+				}
+			}
+
+			outcomes := make(map[string]string)
+			for _, span := range byName["inspect"] {
+				outcomes[spanAttr(span, "pkgstats.repo")] = spanAttr(span, "pkgstats.outcome")
+			}
+			if outcomes["a/used"] != "used" || outcomes["a/unused"] != "not-used" || len(outcomes) != 2 {
+				t.Errorf("inspect spans with outcomes %v", outcomes)
+			}
+			for _, phase := range []string{phaseCodeSearch, phaseDownload} {
+				if len(byName[phase]) == 0 || spanAttr(byName[phase][0], "pkgstats.subject") == "" {
+					t.Errorf("no %s span with its subject", phase)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// checkVendored reports whether the module of the go.mod at goModPath
+// vendors the required module, by looking for it in vendor/modules.txt next
+// to it.
+func (s *searchResult) checkVendored(ctx context.Context, repo candidate, goModPath, module string) (bool, error) {
+	modulesPath := path.Join(path.Dir(goModPath), "vendor", "modules.txt")
+
+	defer s.timings.track(phaseDownload, repo.name+"/"+modulesPath)()
+
+	reader, _, err := s.client.Repositories.DownloadContents(ctx, repo.owner, repo.repo, modulesPath, nil)
+	if err != nil {
+		// DownloadContents reports a missing file in an existing directory
+		// with a plain error, and a missing directory with a 404
+		if isNotFound(err) || strings.HasPrefix(err.Error(), "no file named") {
+			return false, nil
+		}
+		return false, fmt.Errorf("error downloading %s: %v", modulesPath, withRequestID(err))
+	}
+	defer reader.Close()
+
+	bb, err := io.ReadAll(reader)
+	if err != nil {
+		return false, fmt.Errorf("error reading %s: %v", modulesPath, err)
+	}
+
+	return modulesTxtContains(bb, module), nil
+}
+
+// modulesTxtContains reports whether a vendor/modules.txt lists the module.
+func modulesTxtContains(modulesTxt []byte, modulePath string) bool {
+	prefix := "# " + modulePath + " "
+	scanner := bufio.NewScanner(bytes.NewReader(modulesTxt))
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), prefix) {
+			return true
+		}
+	}
+	return false
+}
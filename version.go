@@ -0,0 +1,39 @@
+package main
+
+import (
+	"golang.org/x/mod/semver"
+	"strings"
+)
+
+// normalizeVersion returns the canonical form of a required version, so
+// versions group together in reports. Build metadata is stripped, except for
+// +incompatible which is part of the module version. Versions that are not
+// valid semver are returned trimmed but otherwise unchanged.
+func normalizeVersion(raw string) string {
+	v := strings.TrimSpace(raw)
+	if v == "" {
+		return ""
+	}
+
+	// older toolchains and hand-edited files sometimes omit the v prefix
+	if v[0] >= '0' && v[0] <= '9' {
+		v = "v" + v
+	}
+
+	if !semver.IsValid(v) {
+		return strings.TrimSpace(raw)
+	}
+
+	canonical := semver.Canonical(v)
+	if semver.Build(v) == "+incompatible" {
+		canonical += "+incompatible"
+	}
+	return canonical
+}
+
+// meetsMinVersion reports whether the result requires r.minVersion or later.
+// Pseudo-versions sort after the release they are based on and before the
+// next one, +incompatible is ignored.
+func (r repoResult) meetsMinVersion() bool {
+	return r.used && semver.IsValid(r.version) && semver.Compare(r.version, r.minVersion) >= 0
+}
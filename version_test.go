@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNormalizeVersion(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{raw: "v1.2.3", want: "v1.2.3"},
+		{raw: " v1.2.3\t", want: "v1.2.3"},
+		{raw: "1.2.3", want: "v1.2.3"},
+		{raw: "v1.2", want: "v1.2.0"},
+		{raw: "v2", want: "v2.0.0"},
+		{raw: "v1.2.3-rc.1", want: "v1.2.3-rc.1"},
+		{raw: "v1.2.3+build.5", want: "v1.2.3"},
+		{raw: "v2.0.0+incompatible", want: "v2.0.0+incompatible"},
+		{raw: "v0.0.0-20240102150405-abcdef123456", want: "v0.0.0-20240102150405-abcdef123456"},
+		{raw: "v1.2.4-0.20240102150405-abcdef123456", want: "v1.2.4-0.20240102150405-abcdef123456"},
+		{raw: "", want: ""},
+		{raw: "   ", want: ""},
+		{raw: "latest", want: "latest"},
+		{raw: "master", want: "master"},
+		{raw: "v1.2.3.4", want: "v1.2.3.4"},
+		{raw: "V1.2.3", want: "V1.2.3"},
+		{raw: " 1.2.x ", want: "1.2.x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			if got := normalizeVersion(tt.raw); got != tt.want {
+				t.Errorf("normalizeVersion(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMeetsMinVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		unused  bool
+		want    bool
+	}{
+		{name: "above", version: "v1.3.0", want: true},
+		{name: "equal", version: "v1.2.0", want: true},
+		{name: "below", version: "v1.1.9", want: false},
+		{name: "prerelease of the minimum", version: "v1.2.0-rc.1", want: false},
+		{name: "pseudo-version after the minimum", version: "v1.2.1-0.20240102150405-abcdef123456", want: true},
+		{name: "pseudo-version before the minimum", version: "v1.1.1-0.20240102150405-abcdef123456", want: false},
+		{name: "incompatible above", version: "v2.0.0+incompatible", want: true},
+		{name: "incompatible below", version: "v1.0.0+incompatible", want: false},
+		{name: "not semver", version: "master", want: false},
+		{name: "not an adopter", version: "v1.3.0", unused: true, want: false},
+	}
+	var results []repoResult
+	adopters := 0
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := repoResult{name: tt.name, used: !tt.unused, confidence: confidenceHigh, version: tt.version, minVersion: "v1.2.0"}
+			if got := r.meetsMinVersion(); got != tt.want {
+				t.Errorf("%s meets v1.2.0: %v, want %v", tt.version, got, tt.want)
+			}
+			results = append(results, r)
+			if tt.want {
+				adopters++
+			}
+		})
+	}
+
+	s := summarize(results)
+	if s.minVersion != "v1.2.0" || s.atMinVersion != adopters {
+		t.Errorf("%d adopters on %s or later in the summary, want %d on v1.2.0", s.atMinVersion, s.minVersion, adopters)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// errIdle is the cause of the cancellation of a run that made no progress
+// for -max-idle-time.
+var errIdle = errors.New("no repository processed within the maximum idle time")
+
+// watchdog cancels a run when no repository has been processed for maxIdle,
+// e.g. because every request keeps being rate limited. A nil watchdog does
+// nothing.
+type watchdog struct {
+	maxIdle time.Duration
+	// last is the time of the last progress, in Unix nanoseconds
+	last atomic.Int64
+}
+
+func newWatchdog(maxIdle time.Duration) *watchdog {
+	w := &watchdog{maxIdle: maxIdle}
+	w.touch()
+	return w
+}
+
+// touch records progress.
+func (w *watchdog) touch() {
+	if w == nil {
+		return
+	}
+	w.last.Store(time.Now().UnixNano())
+}
+
+// idle returns the time since the last progress.
+func (w *watchdog) idle() time.Duration {
+	return time.Since(time.Unix(0, w.last.Load()))
+}
+
+// watch cancels the context with errIdle once the run is idle for maxIdle.
+// It returns when the context is done.
+func (w *watchdog) watch(ctx context.Context, cancel context.CancelCauseFunc) {
+	// check often enough to fire at most a tenth of maxIdle late
+	ticker := time.NewTicker(max(w.maxIdle/10, time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if idle := w.idle(); idle >= w.maxIdle {
+				logf("no repository processed for %s, stopping the run\n", idle.Round(time.Second))
+				cancel(errIdle)
+				return
+			}
+		}
+	}
+}
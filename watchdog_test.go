@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchdog(t *testing.T) {
+	// the code search of a/stuck never answers, as for a run stuck waiting
+	// on the rate limit
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/search/code" && strings.Contains(r.URL.Query().Get("q"), "repo:a/stuck ") {
+			<-r.Context().Done()
+			return
+		}
+		fmt.Fprint(w, `{"total_count": 0, "items": []}`)
+	}))
+	s := newSearchResult("github.com/x/lib", client, nil)
+	s.paginationDelay, s.searchDelay = 0, 0
+	s.progress = newWatchdog(50 * time.Millisecond)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	go s.progress.watch(ctx, cancel)
+
+	start := time.Now()
+	results, err := s.searchInRepositories(ctx, []candidate{fakeCandidate("a/one", 10), fakeCandidate("a/stuck", 10), fakeCandidate("a/after", 10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(context.Cause(ctx), errIdle) {
+		t.Errorf("run stopped by %v, want errIdle", context.Cause(ctx))
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("watchdog fired after %s", elapsed)
+	}
+	// the results before the stuck repository are kept for the partial save
+	if _, ok := results["a/one"]; !ok {
+		t.Error("result of a/one lost")
+	}
+	if _, ok := results["a/after"]; ok {
+		t.Error("a/after checked after the watchdog fired")
+	}
+}
+
+func TestWatchdogProgress(t *testing.T) {
+	w := newWatchdog(100 * time.Millisecond)
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	go w.watch(ctx, cancel)
+
+	// progress keeps the run going past maxIdle
+	for i := 0; i < 6; i++ {
+		time.Sleep(30 * time.Millisecond)
+		w.touch()
+	}
+	if err := context.Cause(ctx); err != nil {
+		t.Fatalf("run making progress stopped by %v", err)
+	}
+}